@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+func authCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage the personal access token used to access Jira",
+	}
+	cmd.AddCommand(
+		authLoginCmd(log, clientOpts),
+		authStatusCmd(log, clientOpts),
+		authLogoutCmd(log, clientOpts),
+	)
+	return cmd
+}
+
+func authLoginCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	var encrypt bool
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Store a personal access token",
+		Long: `Store a personal access token.
+
+If a credential profile is selected with --profile, or matches the config's
+jiraBaseURL, the token is stored in the profile's tokenFile.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			authLog := log.WithName("auth")
+			profileFile, err := profileTokenFile(authLog, *clientOpts)
+			if err != nil {
+				exitError(authLog, "resolve credential profile", err)
+			}
+			if profileFile != "" && encrypt {
+				exitError(authLog, "store personal access token", fmt.Errorf("the tokenFile of a credential profile cannot be encrypted"))
+			}
+			token, err := readToken()
+			if err != nil {
+				exitError(authLog, "read personal access token", err)
+			}
+			if profileFile != "" {
+				if err := stalebot.StoreProfileToken(profileFile, token); err != nil {
+					exitError(authLog, "store personal access token", err)
+				}
+				fmt.Printf("Personal access token stored in %s\n", profileFile)
+				return
+			}
+
+			var passphrase string
+			if encrypt {
+				if passphrase, err = stalebot.ReadPassphrase(); err != nil {
+					exitError(authLog, "read passphrase", err)
+				}
+				if passphrase == "" {
+					exitError(authLog, "read passphrase", fmt.Errorf("passphrase must not be empty"))
+				}
+			}
+
+			path, err := stalebot.StorePersonalAccessToken(token, passphrase)
+			if err != nil {
+				exitError(authLog, "store personal access token", err)
+			}
+			fmt.Printf("Personal access token stored in %s\n", path)
+		},
+	}
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the stored token with a passphrase")
+	return cmd
+}
+
+func authStatusCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Verify the stored personal access token",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			authLog := log.WithName("auth")
+			cfg, cl := setupClient(log.WithName("setup"), *clientOpts)
+
+			user, resp, err := cl.User.GetSelf(cmd.Context())
+			if err != nil {
+				if resp != nil {
+					err = fmt.Errorf("%v (HTTP %d)", err, resp.StatusCode)
+				}
+				exitError(authLog, "verify personal access token", err)
+			}
+			fmt.Printf("Logged in to %s as %s (%s)\n", cfg.JiraBaseURL, user.Name, user.DisplayName)
+
+			tokens, err := stalebot.ListPersonalAccessTokens(cmd.Context(), cl)
+			if err != nil {
+				fmt.Println("Token expiry: unknown (personal access token API unavailable)")
+				return
+			}
+			t, ok := stalebot.CurrentPersonalAccessToken(tokens)
+			if !ok {
+				fmt.Println("Token expiry: unknown (token in use not found)")
+				return
+			}
+			expiry := t.ExpiringAt
+			if expiry == "" {
+				expiry = "never"
+			}
+			fmt.Printf("Token %q expires: %s\n", t.Name, expiry)
+		},
+	}
+}
+
+func authLogoutCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Remove the stored personal access token",
+		Long: `Remove the stored personal access token.
+
+If a credential profile is selected with --profile, or matches the config's
+jiraBaseURL, the profile's tokenFile is removed.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			authLog := log.WithName("auth")
+			profileFile, err := profileTokenFile(authLog, *clientOpts)
+			if err != nil {
+				exitError(authLog, "resolve credential profile", err)
+			}
+			var removed []string
+			if profileFile != "" {
+				if err := os.Remove(profileFile); err == nil {
+					removed = append(removed, profileFile)
+				} else if !os.IsNotExist(err) {
+					exitError(authLog, "remove personal access token", err)
+				}
+			} else if removed, err = stalebot.DeletePersonalAccessTokens(); err != nil {
+				exitError(authLog, "remove personal access token", err)
+			}
+			if len(removed) == 0 {
+				fmt.Println("No stored personal access token found")
+			}
+			for _, path := range removed {
+				fmt.Printf("Removed %s\n", path)
+			}
+		},
+	}
+}
+
+// profileTokenFile returns the token file of the credential profile selected
+// with --profile, or matching the config's jiraBaseURL, or an empty string if
+// no profile is used. The config is optional for managing tokens, so if it
+// cannot be loaded, only a profile selected with --profile is used.
+func profileTokenFile(log logr.Logger, opts clientOptions) (string, error) {
+	var baseURL string
+	if cfg, err := stalebot.LoadConfig(opts.configFile); err == nil {
+		baseURL = cfg.JiraBaseURL
+	}
+	return stalebot.ProfileTokenFile(log, baseURL, opts.profile)
+}
+
+// readToken reads a token from stdin, without echoing it if stdin is a
+// terminal.
+func readToken() (string, error) {
+	var token string
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Personal access token: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		token = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		token = line
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("token must not be empty")
+	}
+	return token, nil
+}
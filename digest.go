@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+func digestCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	var (
+		within string
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "digest",
+		Short: "Send a digest of the issues that will soon be closed",
+		Long: `Send a digest of the issues that will soon be closed.
+
+Issues that will be closed within the digest window if they see no further
+activity are grouped by assignee and/or component lead, rendered with the
+digest templates, and delivered with the notifiers in the config's digest
+section.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			digestLog := log.WithName("digest")
+			cfg, cl := setupClient(log.WithName("setup"), *clientOpts)
+			if cfg.Digest == nil {
+				cfg.Digest = &stalebot.DigestConfig{}
+				if !dryRun {
+					exitError(digestLog, "send digest", fmt.Errorf("config has no digest section"))
+				}
+			}
+			if within != "" {
+				d, err := stalebot.ParseDuration(within)
+				if err != nil {
+					exitError(digestLog, "parse --within", err)
+				}
+				cfg.Digest.Within = &stalebot.Duration{Duration: d}
+			}
+			bot := stalebot.Stalebot{
+				Client: cl,
+				Config: *cfg,
+				Logger: digestLog,
+			}
+			digest, err := bot.Digest(cmd.Context(), time.Now())
+			if err != nil {
+				exitError(digestLog, "collect digest", err)
+			}
+			if dryRun {
+				msg, err := bot.RenderDigest(digest)
+				if err != nil {
+					exitError(digestLog, "render digest", err)
+				}
+				fmt.Printf("Subject: %s\n\n%s", msg.Subject, msg.Body)
+				personal, err := bot.RenderPersonalDigests(digest)
+				if err != nil {
+					exitError(digestLog, "render personal digests", err)
+				}
+				for _, msg := range personal {
+					fmt.Printf("\n---\nTo: %s\nSubject: %s\n\n%s", strings.Join(msg.To, ", "), msg.Subject, msg.Body)
+				}
+				return
+			}
+			if err := bot.SendDigest(cmd.Context(), digest); err != nil {
+				exitError(digestLog, "send digest", err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&within, "within", "", "Include issues that will be closed within this duration (overrides the config)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the digest instead of sending it")
+	return cmd
+}
@@ -0,0 +1,107 @@
+// Package jiratest provides a fake Jira server for tests.
+package jiratest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   map[string]interface{}
+}
+
+// Server is a minimal Jira server that serves canned search results and
+// issues, and records all requests. Its account is named "stalebot".
+type Server struct {
+	*httptest.Server
+
+	// Issues are returned by searches, and by issue requests for their ID
+	// or key.
+	Issues []map[string]interface{}
+	// Handlers override the default response for a method and path, e.g.
+	// "PUT /rest/api/2/issue/10000".
+	Handlers map[string]http.HandlerFunc
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewServer starts a Server. Callers must close it when done.
+func NewServer() *Server {
+	s := &Server{Handlers: map[string]http.HandlerFunc{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// JiraClient returns a Jira client for the server.
+func (s *Server) JiraClient() *jira.Client {
+	cl, err := jira.NewClient(s.URL, s.Client())
+	if err != nil {
+		panic(err)
+	}
+	return cl
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	req := Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery}
+	body, _ := io.ReadAll(r.Body)
+	if len(body) > 0 {
+		_ = json.Unmarshal(body, &req.Body)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	handler := s.Handlers[r.Method+" "+r.URL.Path]
+	issues := s.Issues
+	s.mu.Unlock()
+
+	if handler != nil {
+		handler(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/myself":
+		_, _ = w.Write([]byte(`{"name": "stalebot"}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/search":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"startAt":    0,
+			"maxResults": len(issues),
+			"total":      len(issues),
+			"issues":     issues,
+		})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		id := strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/")
+		for _, i := range issues {
+			if i["id"] == id || i["key"] == id {
+				_ = json.NewEncoder(w).Encode(i)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errorMessages": ["Issue does not exist"]}`))
+	case r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,237 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+type FieldActionType string
+
+const (
+	Unassign          FieldActionType = "unassign"
+	ClearSprint       FieldActionType = "clearSprint"
+	SetPriority       FieldActionType = "setPriority"
+	DecrementPriority FieldActionType = "decrementPriority"
+	AddComponent      FieldActionType = "addComponent"
+	SetCustomField    FieldActionType = "setCustomField"
+)
+
+// FieldAction is an additional field mutation applied to an issue when it is
+// marked stale or closed.
+type FieldAction struct {
+	Type FieldActionType `json:"type"`
+
+	// Field is the ID of the field to mutate (e.g. "customfield_12310940").
+	// It is required for clearSprint and setCustomField.
+	Field string `json:"field,omitempty"`
+
+	// Value is the value to set. It is required for setPriority,
+	// addComponent and setCustomField.
+	Value string `json:"value,omitempty"`
+}
+
+func (a FieldAction) validate() error {
+	switch a.Type {
+	case Unassign, DecrementPriority:
+	case ClearSprint:
+		if a.Field == "" {
+			return fmt.Errorf("action %q requires a field", a.Type)
+		}
+	case SetPriority, AddComponent:
+		if a.Value == "" {
+			return fmt.Errorf("action %q requires a value", a.Type)
+		}
+	case SetCustomField:
+		if a.Field == "" || a.Value == "" {
+			return fmt.Errorf("action %q requires a field and a value", a.Type)
+		}
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+	return nil
+}
+
+// fieldsFor returns the issue fields that must be fetched in order to record
+// the previous values of the fields mutated by actions.
+func fieldsFor(actions []FieldAction) []string {
+	fields := []string{}
+	for _, a := range actions {
+		switch a.Type {
+		case Unassign:
+			fields = append(fields, "assignee")
+		case SetPriority, DecrementPriority:
+			fields = append(fields, "priority")
+		case AddComponent:
+			fields = append(fields, "components")
+		case ClearSprint, SetCustomField:
+			fields = append(fields, a.Field)
+		}
+	}
+	return fields
+}
+
+// fieldMutations is the result of applying a set of field actions to an issue.
+type fieldMutations struct {
+	Fields     map[string]interface{}
+	Components []componentUpdate
+
+	// Previous holds the value of each mutated field before the mutation, keyed
+	// by field name, so that the mutation can be reverted. If several actions
+	// mutate the same field, it holds the value before the first of them.
+	Previous map[string]string
+}
+
+// recordPrevious records the value of a field before its first mutation.
+func (m fieldMutations) recordPrevious(field, value string) {
+	if _, ok := m.Previous[field]; !ok {
+		m.Previous[field] = value
+	}
+}
+
+// priority returns the name of the issue's priority after the mutations so
+// far, or an empty string if it has none.
+func (m fieldMutations) priority(issue *jira.Issue) string {
+	if p, ok := m.Fields["priority"].(map[string]string); ok {
+		return p["name"]
+	}
+	if issue.Fields.Priority != nil {
+		return issue.Fields.Priority.Name
+	}
+	return ""
+}
+
+func (m fieldMutations) isEmpty() bool {
+	return len(m.Fields) == 0 && len(m.Components) == 0
+}
+
+// fieldNames returns the names of the mutated fields.
+func (m fieldMutations) fieldNames() []string {
+	names := make([]string, 0, len(m.Fields)+1)
+	for f := range m.Fields {
+		names = append(names, f)
+	}
+	if len(m.Components) > 0 {
+		names = append(names, "components")
+	}
+	return names
+}
+
+// previousValuesNote renders the previous values of the mutated fields so that
+// they can be recorded alongside the comment for the operation.
+func (m fieldMutations) previousValuesNote() string {
+	if len(m.Previous) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(m.Previous))
+	for k := range m.Previous {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vals := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vals = append(vals, fmt.Sprintf("%s=%q", k, m.Previous[k]))
+	}
+	return fmt.Sprintf("Previous values: %s", strings.Join(vals, ", "))
+}
+
+// fieldMutations computes the mutations of actions from the given state of an
+// issue. Relative actions, like decrementPriority, are computed from the
+// issue's current state, so that they build on the latest value.
+func (bot *Stalebot) fieldMutations(ctx context.Context, issue *jira.Issue, actions []FieldAction) (fieldMutations, error) {
+	m := fieldMutations{
+		Fields:   map[string]interface{}{},
+		Previous: map[string]string{},
+	}
+	for _, a := range actions {
+		switch a.Type {
+		case Unassign:
+			if issue.Fields.Assignee == nil {
+				continue
+			}
+			m.recordPrevious("assignee", issue.Fields.Assignee.Name)
+			m.Fields["assignee"] = map[string]interface{}{"name": nil}
+		case ClearSprint:
+			prev, ok := issue.Fields.Unknowns[a.Field]
+			if !ok {
+				// Jira omits unknown fields instead of failing the request.
+				bot.Logger.Error(fmt.Errorf("field %q not found on issue", a.Field), "skipping action", "key", issue.Key, "action", a.Type)
+				continue
+			}
+			if prev == nil {
+				continue
+			}
+			m.recordPrevious(a.Field, fmt.Sprint(prev))
+			m.Fields[a.Field] = nil
+		case SetPriority:
+			if m.priority(issue) == a.Value {
+				continue
+			}
+			if issue.Fields.Priority != nil {
+				m.recordPrevious("priority", issue.Fields.Priority.Name)
+			}
+			m.Fields["priority"] = map[string]string{"name": a.Value}
+		case DecrementPriority:
+			current := m.priority(issue)
+			if current == "" {
+				continue
+			}
+			next, err := bot.lowerPriority(ctx, current)
+			if err != nil {
+				return m, err
+			}
+			if next == "" {
+				continue
+			}
+			if issue.Fields.Priority != nil {
+				m.recordPrevious("priority", issue.Fields.Priority.Name)
+			}
+			m.Fields["priority"] = map[string]string{"name": next}
+		case AddComponent:
+			names := make([]string, 0, len(issue.Fields.Components))
+			for _, c := range issue.Fields.Components {
+				if c.Name == a.Value {
+					names = nil
+					break
+				}
+				names = append(names, c.Name)
+			}
+			if names == nil {
+				continue
+			}
+			m.recordPrevious("components", strings.Join(names, ","))
+			m.Components = append(m.Components, componentUpdate{Add: &jira.Component{Name: a.Value}})
+		case SetCustomField:
+			if prev, ok := issue.Fields.Unknowns[a.Field]; ok && prev != nil {
+				m.recordPrevious(a.Field, fmt.Sprint(prev))
+			}
+			m.Fields[a.Field] = a.Value
+		}
+	}
+	return m, nil
+}
+
+// lowerPriority returns the name of the priority directly below the named
+// priority, or an empty string if it is already the lowest priority.
+func (bot *Stalebot) lowerPriority(ctx context.Context, name string) (string, error) {
+	if bot.priorities == nil {
+		priorities, _, err := bot.Client.Priority.GetList(ctx)
+		if err != nil {
+			return "", fmt.Errorf("get priorities: %v", err)
+		}
+		bot.priorities = priorities
+	}
+	// Jira returns priorities ordered from highest to lowest.
+	for i, p := range bot.priorities {
+		if p.Name == name {
+			if i+1 < len(bot.priorities) {
+				return bot.priorities[i+1].Name, nil
+			}
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("unknown priority %q", name)
+}
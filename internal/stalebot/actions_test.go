@@ -0,0 +1,211 @@
+package stalebot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+)
+
+var _ = Describe("Field actions", func() {
+	var (
+		fake  *jiratest.Server
+		bot   *Stalebot
+		issue *jira.Issue
+	)
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		fake.Handlers["GET /rest/api/2/priority"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`[{"name": "Critical"}, {"name": "Major"}, {"name": "Minor"}]`))
+		}
+		fake.Handlers["GET /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"transitions": [{"id": "2", "name": "Close", "to": {"name": "Closed"}}]}`))
+		}
+		fake.Issues = append(fake.Issues, map[string]interface{}{
+			"id":  "TEST-1",
+			"key": "TEST-1",
+			"fields": map[string]interface{}{
+				"labels":        []string{},
+				"status":        map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+				"assignee":      map[string]interface{}{"name": "jdoe"},
+				"priority":      map[string]interface{}{"name": "Critical"},
+				"components":    []interface{}{map[string]interface{}{"name": "api"}},
+				"customfield_1": "Sprint 7",
+				"customfield_2": "old",
+			},
+		})
+		bot = &Stalebot{
+			Client: fake.JiraClient(),
+			Config: Config{
+				JiraBaseURL: fake.URL,
+				Project:     "TEST",
+				CloseStatus: "Closed",
+			},
+			Logger: logr.Discard(),
+		}
+		bot.Config.setDefaults()
+
+		issue = &jira.Issue{ID: "TEST-1", Key: "TEST-1", Fields: &jira.IssueFields{
+			Assignee:   &jira.User{Name: "jdoe"},
+			Priority:   &jira.Priority{Name: "Critical"},
+			Components: []*jira.Component{{Name: "api"}},
+			Unknowns:   map[string]interface{}{"customfield_1": "Sprint 7", "customfield_2": "old"},
+		}}
+	})
+
+	DescribeTable("computes mutations and previous values",
+		func(actions []FieldAction, fields map[string]interface{}, components []componentUpdate, previous map[string]string) {
+			m, err := bot.fieldMutations(context.Background(), issue, actions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Fields).To(Equal(fields))
+			Expect(m.Components).To(Equal(components))
+			Expect(m.Previous).To(Equal(previous))
+		},
+		Entry("unassign",
+			[]FieldAction{{Type: Unassign}},
+			map[string]interface{}{"assignee": map[string]interface{}{"name": nil}}, nil,
+			map[string]string{"assignee": "jdoe"}),
+		Entry("clear sprint",
+			[]FieldAction{{Type: ClearSprint, Field: "customfield_1"}},
+			map[string]interface{}{"customfield_1": nil}, nil,
+			map[string]string{"customfield_1": "Sprint 7"}),
+		Entry("set priority",
+			[]FieldAction{{Type: SetPriority, Value: "Major"}},
+			map[string]interface{}{"priority": map[string]string{"name": "Major"}}, nil,
+			map[string]string{"priority": "Critical"}),
+		Entry("decrement priority",
+			[]FieldAction{{Type: DecrementPriority}},
+			map[string]interface{}{"priority": map[string]string{"name": "Major"}}, nil,
+			map[string]string{"priority": "Critical"}),
+		Entry("set and then decrement priority",
+			[]FieldAction{{Type: SetPriority, Value: "Major"}, {Type: DecrementPriority}},
+			map[string]interface{}{"priority": map[string]string{"name": "Minor"}}, nil,
+			map[string]string{"priority": "Critical"}),
+		Entry("decrement below the lowest priority",
+			[]FieldAction{{Type: SetPriority, Value: "Minor"}, {Type: DecrementPriority}},
+			map[string]interface{}{"priority": map[string]string{"name": "Minor"}}, nil,
+			map[string]string{"priority": "Critical"}),
+		Entry("add component",
+			[]FieldAction{{Type: AddComponent, Value: "stale"}},
+			map[string]interface{}{}, []componentUpdate{{Add: &jira.Component{Name: "stale"}}},
+			map[string]string{"components": "api"}),
+		Entry("add existing component",
+			[]FieldAction{{Type: AddComponent, Value: "api"}},
+			map[string]interface{}{}, nil,
+			map[string]string{}),
+		Entry("set custom field",
+			[]FieldAction{{Type: SetCustomField, Field: "customfield_2", Value: "new"}},
+			map[string]interface{}{"customfield_2": "new"}, nil,
+			map[string]string{"customfield_2": "old"}),
+	)
+
+	It("applies mark actions with the label update and records the previous values", func() {
+		store, err := OpenStore(filepath.Join(GinkgoT().TempDir(), "state.json"))
+		Expect(err).NotTo(HaveOccurred())
+		bot.Store = store
+		bot.Config.MarkActions = []FieldAction{{Type: Unassign}, {Type: DecrementPriority}}
+
+		Expect(bot.perform(context.Background(), &PlannedOperation{Issue: *issue, Operation: AddStaleLabel})).To(Succeed())
+		var put jiratest.Request
+		for _, r := range fake.Requests() {
+			if r.Method == http.MethodPut {
+				put = r
+			}
+		}
+		Expect(put.Body).To(HaveKeyWithValue("fields", Equal(map[string]interface{}{
+			"assignee": map[string]interface{}{"name": nil},
+			"priority": map[string]interface{}{"name": "Major"},
+		})))
+		Expect(store.History("TEST-1")).To(ConsistOf(HaveField("Previous", Equal(map[string]string{
+			"assignee": "jdoe",
+			"priority": "Critical",
+		}))))
+	})
+
+	It("computes relative actions from the current state of the issue", func() {
+		bot.Config.MarkActions = []FieldAction{{Type: DecrementPriority}}
+		fake.Issues[0]["fields"].(map[string]interface{})["priority"] = map[string]interface{}{"name": "Major"}
+
+		Expect(bot.addStaleLabel(context.Background(), issue)).To(Succeed())
+		Expect(fake.Requests()[len(fake.Requests())-1].Body).To(HaveKeyWithValue("fields", Equal(map[string]interface{}{
+			"priority": map[string]interface{}{"name": "Minor"},
+		})))
+	})
+
+	It("logs and skips clearing a sprint field the issue does not have", func() {
+		var logged []string
+		bot.Logger = funcr.New(func(prefix, args string) { logged = append(logged, args) }, funcr.Options{})
+		m, err := bot.fieldMutations(context.Background(), issue, []FieldAction{{Type: ClearSprint, Field: "customfield_9"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.isEmpty()).To(BeTrue())
+		Expect(logged).To(ConsistOf(ContainSubstring(`field \"customfield_9\" not found on issue`)))
+	})
+
+	Context("closing", func() {
+		var calls func() []string
+		BeforeEach(func() {
+			bot.Config.CloseActions = []FieldAction{{Type: ClearSprint, Field: "customfield_1"}}
+			calls = func() []string {
+				var out []string
+				for _, r := range fake.Requests() {
+					if r.Method != http.MethodGet {
+						out = append(out, r.Method+" "+r.Path)
+					}
+				}
+				return out
+			}
+		})
+		It("applies close actions with the close transition", func() {
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+			Expect(fake.Requests()).To(ContainElement(HaveField("Body", And(
+				HaveKeyWithValue("transition", HaveKeyWithValue("id", "2")),
+				HaveKeyWithValue("fields", HaveKeyWithValue("customfield_1", BeNil())),
+			))))
+		})
+		It("applies close actions with the comment before a transition that rejects them", func() {
+			fake.Handlers["POST /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+				if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"customfield_1"`) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors": {"customfield_1": "Field 'customfield_1' cannot be set. It is not on the appropriate screen, or unknown."}}`))
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"POST /rest/api/2/issue/TEST-1/transitions",
+				"PUT /rest/api/2/issue/TEST-1",
+				"POST /rest/api/2/issue/TEST-1/transitions",
+			}))
+			Expect(fake.Requests()).To(ContainElement(And(
+				HaveField("Method", http.MethodPut),
+				HaveField("Body", And(
+					HaveKeyWithValue("fields", HaveKeyWithValue("customfield_1", BeNil())),
+					HaveKeyWithValue("update", HaveKey("comment")),
+				)),
+			)))
+		})
+		It("does not apply close actions again once the close comment was posted", func() {
+			bot.Config.CloseActions = []FieldAction{{Type: DecrementPriority}}
+			fake.Issues[0]["fields"].(map[string]interface{})["comment"] = map[string]interface{}{"comments": []interface{}{
+				map[string]interface{}{"id": "10", "body": "Closing.\n{anchor:jira-stalebot-close-0}"},
+			}}
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+			Expect(fake.Requests()[len(fake.Requests())-1].Body).NotTo(HaveKeyWithValue("fields", HaveKey("priority")))
+		})
+	})
+})
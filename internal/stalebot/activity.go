@@ -0,0 +1,195 @@
+package stalebot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type ActivitySource string
+
+const (
+	// UpdatedActivity counts any change to an issue, as reflected by its
+	// updated time, as activity.
+	UpdatedActivity ActivitySource = "updated"
+	// CommentsActivity counts comments by humans as activity.
+	CommentsActivity ActivitySource = "comments"
+	// ChangelogActivity counts changelog entries by humans as activity.
+	ChangelogActivity ActivitySource = "changelog"
+)
+
+// botCommentPrefix starts stalebot's default comments.
+const botCommentPrefix = "[STALEBOT COMMENT]"
+
+// jiraTimeLayout is the layout of timestamps in Jira's REST API.
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+func (s ActivitySource) validate() error {
+	switch s {
+	case UpdatedActivity, CommentsActivity, ChangelogActivity:
+		return nil
+	}
+	return fmt.Errorf("unknown activity source %q", s)
+}
+
+// activitySources returns the configured activity sources, which default to
+// updated.
+func (c *Config) activitySources() sets.String {
+	if len(c.ActivitySources) == 0 {
+		return sets.NewString(string(UpdatedActivity))
+	}
+	sources := sets.NewString()
+	for _, s := range c.ActivitySources {
+		sources.Insert(string(s))
+	}
+	return sources
+}
+
+// activityFields returns the issue fields needed to compute the activity of
+// issues from the configured sources.
+func (c *Config) activityFields() []string {
+	sources := c.activitySources()
+	var fields []string
+	if sources.Has(string(CommentsActivity)) {
+		fields = append(fields, "comment")
+	}
+	if !sources.Has(string(UpdatedActivity)) {
+		fields = append(fields, "created")
+	}
+	return fields
+}
+
+// issueActivity returns the time of the latest activity on an issue from the
+// configured activity sources. Issues without any activity from the sources
+// were last active when they were created.
+func (c *Config) issueActivity(i *jira.Issue) time.Time {
+	sources := c.activitySources()
+	if sources.Has(string(UpdatedActivity)) {
+		return time.Time(i.Fields.Updated)
+	}
+	latest := time.Time(i.Fields.Created)
+	if sources.Has(string(CommentsActivity)) {
+		if t := c.lastHumanComment(i); t.After(latest) {
+			latest = t
+		}
+	}
+	if sources.Has(string(ChangelogActivity)) {
+		if t := c.lastHumanChange(i); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// relativeActivity returns the time of the latest activity on a child or
+// linked issue from the configured activity sources. Unlike for the issue
+// itself, the updated source only counts updates that were not made by
+// stalebot or a bot account, or by a label migration, so that stalebot marking
+// a relative is not activity on the issue.
+func (c *Config) relativeActivity(i *jira.Issue) time.Time {
+	if !c.activitySources().Has(string(UpdatedActivity)) {
+		return c.issueActivity(i)
+	}
+	updated := time.Time(i.Fields.Updated)
+	if i.Changelog == nil {
+		return updated
+	}
+	bots := c.botAccounts()
+	var lastChange, lastHumanChange time.Time
+	for _, h := range i.Changelog.Histories {
+		t, err := h.CreatedTime()
+		if err != nil {
+			continue
+		}
+		if t.After(lastChange) {
+			lastChange = t
+		}
+		if !c.isLabelMigration(h) && !bots.Has(h.Author.Name) && t.After(lastHumanChange) {
+			lastHumanChange = t
+		}
+	}
+	// Like in updatedSince, an updated time later than the last changelog
+	// history stems from an update that left no history, like a comment.
+	if lastChange.IsZero() || updated.After(lastChange.Add(updateTolerance)) {
+		return updated
+	}
+	return lastHumanChange
+}
+
+// lastHumanComment returns the time of the latest comment that was neither
+// posted by stalebot nor by a bot account.
+func (c *Config) lastHumanComment(i *jira.Issue) time.Time {
+	var latest time.Time
+	if i.Fields.Comments == nil {
+		return latest
+	}
+	bots := c.botAccounts()
+	for _, comment := range i.Fields.Comments.Comments {
+		if !isHumanComment(comment, bots) {
+			continue
+		}
+		if t := commentTime(comment); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// isHumanComment returns true if a comment was posted neither by stalebot nor
+// by one of the bots.
+func isHumanComment(comment *jira.Comment, bots sets.String) bool {
+	return comment != nil && !bots.Has(comment.Author.Name) && !isStalebotComment(comment.Body)
+}
+
+// commentTime returns the time a comment was last created or edited.
+func commentTime(comment *jira.Comment) time.Time {
+	var latest time.Time
+	for _, ts := range []string{comment.Created, comment.Updated} {
+		if t, err := time.Parse(jiraTimeLayout, ts); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// isStalebotComment returns true if a comment was posted by stalebot, as
+// indicated by the default comment prefix or a comment marker.
+func isStalebotComment(body string) bool {
+	return strings.HasPrefix(strings.TrimSpace(body), botCommentPrefix) || strings.Contains(body, commentMarkerPrefix)
+}
+
+// lastHumanChange returns the time of the latest changelog history that was
+// made neither by stalebot nor by a bot account.
+func (c *Config) lastHumanChange(i *jira.Issue) time.Time {
+	var latest time.Time
+	if i.Changelog == nil {
+		return latest
+	}
+	bots := c.botAccounts()
+	for _, h := range i.Changelog.Histories {
+		if bots.Has(h.Author.Name) {
+			continue
+		}
+		if t, err := h.CreatedTime(); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// botAccounts returns the accounts whose comments and changes are not human
+// activity: the configured bot accounts, stalebot's own account if it is
+// known, and in simulations, the author of the synthesized changes.
+func (c *Config) botAccounts() sets.String {
+	bots := sets.NewString(c.BotAccounts...)
+	if c.account != "" {
+		bots.Insert(c.account)
+	}
+	if c.simulation {
+		bots.Insert(simulatedAuthor)
+	}
+	return bots
+}
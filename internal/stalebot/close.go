@@ -0,0 +1,233 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type CloseStrategy string
+
+const (
+	// TransitionStrategy closes issues by transitioning them to CloseStatus.
+	TransitionStrategy CloseStrategy = "transition"
+
+	// ArchiveStrategy leaves issues open, but marks them with ArchiveLabel
+	// (and optionally sets ArchiveField to ArchiveValue). Archived issues are
+	// no longer eligible for stalebot processing.
+	ArchiveStrategy CloseStrategy = "archive"
+
+	// MoveStrategy moves issues to MoveProject. The Jira REST API does not
+	// support moving an issue between projects, so the issue is cloned into
+	// MoveProject, linked to the clone, and then transitioned to CloseStatus.
+	MoveStrategy CloseStrategy = "move"
+)
+
+const defaultMoveLinkType = "Cloners"
+
+func (s CloseStrategy) validate() error {
+	switch s {
+	case TransitionStrategy, ArchiveStrategy, MoveStrategy:
+		return nil
+	}
+	return fmt.Errorf("unknown close strategy %q", s)
+}
+
+// prepareClose performs the steps of the close strategy that precede the
+// close comment. It returns a note describing the outcome to be appended to
+// the close comment, if any. For the move strategy, the issue is cloned,
+// unless current shows it was already cloned by an earlier run.
+func (bot *Stalebot) prepareClose(ctx context.Context, issue, current *jira.Issue) (string, error) {
+	if bot.Config.CloseStrategy != MoveStrategy {
+		return "", nil
+	}
+	cloneKey := bot.existingClone(current)
+	if cloneKey == "" {
+		clone, err := bot.cloneIssue(ctx, issue)
+		if err != nil {
+			return "", err
+		}
+		cloneKey = clone.Key
+	}
+	return fmt.Sprintf("This issue has been moved to %s.", cloneKey), nil
+}
+
+// finishClose performs the final close step of the close strategy, and
+// applies mutations and posts comment, unless it is empty, in the same
+// request.
+func (bot *Stalebot) finishClose(ctx context.Context, issue *jira.Issue, mutations fieldMutations, comment string) error {
+	if bot.Config.CloseStrategy == ArchiveStrategy {
+		return bot.archiveIssue(ctx, issue, mutations, comment)
+	}
+	return bot.transitionIssue(ctx, issue, mutations, comment)
+}
+
+// commentUpdate returns the update operation adding comment.
+func (c *Config) commentUpdate(comment string) []commentUpdate {
+	return []commentUpdate{{Add: commentAdd{Body: comment, Visibility: c.restrictedVisibility()}}}
+}
+
+// addCloseComment posts the close comment of an issue that was closed without
+// it.
+func (bot *Stalebot) addCloseComment(ctx context.Context, issue *jira.Issue, comment string) error {
+	if comment == "" {
+		return nil
+	}
+	if _, resp, err := bot.Client.Issue.AddComment(ctx, issue.ID, bot.Config.newComment(comment)); err != nil {
+		return fmt.Errorf("add close comment to closed issue: %v", jira.NewJiraError(resp, err))
+	}
+	return nil
+}
+
+// existingClone returns the key of the issue's clone in MoveProject, if it
+// has one.
+func (bot *Stalebot) existingClone(issue *jira.Issue) string {
+	if issue.Fields == nil {
+		return ""
+	}
+	for _, l := range issue.Fields.IssueLinks {
+		if l == nil || l.OutwardIssue == nil || l.Type.Name != bot.Config.MoveLinkType {
+			continue
+		}
+		if strings.HasPrefix(l.OutwardIssue.Key, bot.Config.MoveProject+"-") {
+			return l.OutwardIssue.Key
+		}
+	}
+	return ""
+}
+
+// transitionIssue transitions an issue to the close status. If the transition
+// rejects mutations or comment, e.g. because it has no screen, mutations are
+// applied with comment in an edit before the transition, and comment alone is
+// posted after it.
+func (bot *Stalebot) transitionIssue(ctx context.Context, issue *jira.Issue, mutations fieldMutations, comment string) error {
+	transitions, _, err := bot.Client.Issue.GetTransitions(ctx, issue.ID)
+	if err != nil {
+		return fmt.Errorf("get transitions for issue: %v", err)
+	}
+	tID, err := transitionID(transitions, bot.Config.CloseStatus)
+	if err != nil {
+		return fmt.Errorf("get transition ID: %v", err)
+	}
+
+	upd := update{Components: mutations.Components}
+	if (comment != "" || !mutations.isEmpty()) && !bot.separateTransitionUpdates {
+		withComment := upd
+		if comment != "" {
+			withComment.Comment = bot.Config.commentUpdate(comment)
+		}
+		reqBody := map[string]interface{}{
+			"transition": map[string]string{"id": tID},
+			"update":     withComment,
+		}
+		if len(mutations.Fields) > 0 {
+			reqBody["fields"] = mutations.Fields
+		}
+		// DoTransitionWithPayload returns Jira errors already parsed.
+		resp, err := bot.Client.Issue.DoTransitionWithPayload(ctx, issue.ID, reqBody)
+		if err == nil {
+			return nil
+		}
+		if !updateRejected(resp, err, append(mutations.fieldNames(), "comment")...) {
+			return fmt.Errorf("transition to status %q: %v", bot.Config.CloseStatus, err)
+		}
+		bot.Logger.Info("jira rejected fields or comment in close transition, applying them separately", "reason", err.Error())
+		bot.separateTransitionUpdates = true
+	}
+
+	if !mutations.isEmpty() {
+		// A retrying run finds the comment by its marker and does not apply the
+		// mutations again.
+		if err := bot.updateIssueWithComment(ctx, issue.ID, upd, mutations.Fields, comment); err != nil {
+			return fmt.Errorf("apply close actions to issue: %v", err)
+		}
+		comment = ""
+	}
+	if _, err := bot.Client.Issue.DoTransition(ctx, issue.ID, tID); err != nil {
+		return fmt.Errorf("transition to status %q: %v", bot.Config.CloseStatus, err)
+	}
+	return bot.addCloseComment(ctx, issue, comment)
+}
+
+// archiveIssue adds the archive label and field to an issue. If the instance
+// rejects comment in the same edit, it is posted after the edit.
+func (bot *Stalebot) archiveIssue(ctx context.Context, issue *jira.Issue, mutations fieldMutations, comment string) error {
+	reqBody := func(comment string) map[string]interface{} {
+		upd := update{Labels: []labels{{Add: bot.Config.ArchiveLabel}}, Components: mutations.Components}
+		if comment != "" {
+			upd.Comment = bot.Config.commentUpdate(comment)
+		}
+		fields := map[string]interface{}{}
+		for f, v := range mutations.Fields {
+			fields[f] = v
+		}
+		if bot.Config.ArchiveField != "" {
+			fields[bot.Config.ArchiveField] = bot.Config.ArchiveValue
+		}
+		body := map[string]interface{}{"update": upd}
+		if len(fields) > 0 {
+			body["fields"] = fields
+		}
+		return body
+	}
+
+	if comment != "" && !bot.separateComments {
+		resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, reqBody(comment))
+		if err == nil {
+			return nil
+		}
+		err = jira.NewJiraError(resp, err)
+		if !commentRejected(resp, err) {
+			return fmt.Errorf("archive issue: %v", err)
+		}
+		bot.Logger.Info("jira rejected comment in issue update, posting comments separately", "reason", err.Error())
+		bot.separateComments = true
+	}
+
+	if resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, reqBody("")); err != nil {
+		return fmt.Errorf("archive issue: %v", jira.NewJiraError(resp, err))
+	}
+	return bot.addCloseComment(ctx, issue, comment)
+}
+
+func (bot *Stalebot) cloneIssue(ctx context.Context, issue *jira.Issue) (*jira.Issue, error) {
+	staleLabels := sets.NewString(bot.Config.staleLabels(time.Now())...)
+	cloneLabels := make([]string, 0, len(issue.Fields.Labels))
+	for _, l := range issue.Fields.Labels {
+		if !staleLabels.Has(l) {
+			cloneLabels = append(cloneLabels, l)
+		}
+	}
+	clone, resp, err := bot.Client.Issue.Create(ctx, &jira.Issue{
+		Fields: &jira.IssueFields{
+			Project:     jira.Project{Key: bot.Config.MoveProject},
+			Type:        jira.IssueType{Name: issue.Fields.Type.Name},
+			Summary:     issue.Fields.Summary,
+			Description: issue.Fields.Description,
+			Labels:      cloneLabels,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("clone issue into project %q: %v", bot.Config.MoveProject, jira.NewJiraError(resp, err))
+	}
+
+	link := &jira.IssueLink{
+		Type:         jira.IssueLinkType{Name: bot.Config.MoveLinkType},
+		OutwardIssue: &jira.Issue{Key: clone.Key},
+		InwardIssue:  &jira.Issue{Key: issue.Key},
+	}
+	if resp, err := bot.Client.Issue.AddLink(ctx, link); err != nil {
+		err = fmt.Errorf("link issue to clone %q: %v", clone.Key, jira.NewJiraError(resp, err))
+		// Without the link, a retry cannot find the clone and would create
+		// another one, so the clone is deleted again.
+		if resp, delErr := bot.Client.Issue.Delete(ctx, clone.ID); delErr != nil {
+			return nil, fmt.Errorf("%v; delete unlinked clone %q: %v", err, clone.Key, jira.NewJiraError(resp, delErr))
+		}
+		return nil, err
+	}
+	return clone, nil
+}
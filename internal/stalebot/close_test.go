@@ -0,0 +1,228 @@
+package stalebot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+)
+
+var _ = Describe("Close strategies", func() {
+	var (
+		fake  *jiratest.Server
+		bot   *Stalebot
+		issue *jira.Issue
+	)
+	// calls returns the method and path of the requests that modify issues.
+	calls := func() []string {
+		var out []string
+		for _, r := range fake.Requests() {
+			if r.Method != http.MethodGet {
+				out = append(out, r.Method+" "+r.Path)
+			}
+		}
+		return out
+	}
+	// body returns the body of the first request with the given method and path.
+	body := func(method, path string) map[string]interface{} {
+		for _, r := range fake.Requests() {
+			if r.Method == method && r.Path == path {
+				return r.Body
+			}
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		fake.Handlers["GET /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"transitions": [{"id": "1", "name": "Start", "to": {"name": "In Progress"}}, {"id": "2", "name": "Close", "to": {"name": "Closed"}}]}`))
+		}
+		fake.Issues = append(fake.Issues, map[string]interface{}{
+			"id":  "TEST-1",
+			"key": "TEST-1",
+			"fields": map[string]interface{}{
+				"labels": []string{"lifecycle-stale", "backend"},
+				"status": map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+		})
+		bot = &Stalebot{
+			Client: fake.JiraClient(),
+			Config: Config{
+				JiraBaseURL:  fake.URL,
+				Project:      "TEST",
+				CloseStatus:  "Closed",
+				CloseComment: "Closing stale issue.",
+			},
+			Logger: logr.Discard(),
+		}
+		issue = &jira.Issue{ID: "TEST-1", Key: "TEST-1", Fields: &jira.IssueFields{
+			Type:        jira.IssueType{Name: "Bug"},
+			Summary:     "Something is broken",
+			Description: "Steps to reproduce",
+			Labels:      []string{"lifecycle-stale", "backend"},
+		}}
+	})
+	JustBeforeEach(func() {
+		bot.Config.setDefaults()
+	})
+
+	Context("transition", func() {
+		It("transitions the issue to the close status with the comment", func() {
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+			Expect(body(http.MethodPost, "/rest/api/2/issue/TEST-1/transitions")).To(And(
+				HaveKeyWithValue("transition", HaveKeyWithValue("id", "2")),
+				HaveKeyWithValue("update", HaveKeyWithValue("comment", ConsistOf(HaveKeyWithValue("add", HaveKeyWithValue("body", HavePrefix("Closing stale issue."))))))),
+			)
+		})
+		It("comments after the transition if the transition does not take comments", func() {
+			fake.Handlers["POST /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+				if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"comment"`) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors": {"comment": "Field 'comment' cannot be set. It is not on the appropriate screen, or unknown."}}`))
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"POST /rest/api/2/issue/TEST-1/transitions",
+				"POST /rest/api/2/issue/TEST-1/transitions",
+				"POST /rest/api/2/issue/TEST-1/comment",
+			}))
+		})
+		It("does not comment if the transition fails", func() {
+			fake.Handlers["POST /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+				if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"comment"`) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors": {"comment": "Field 'comment' cannot be set. It is not on the appropriate screen, or unknown."}}`))
+					return
+				}
+				http.Error(w, `{"errorMessages": ["boom"]}`, http.StatusInternalServerError)
+			}
+			Expect(bot.closeIssue(context.Background(), issue)).To(MatchError(ContainSubstring(`transition to status "Closed"`)))
+			Expect(calls()).To(Equal([]string{
+				"POST /rest/api/2/issue/TEST-1/transitions",
+				"POST /rest/api/2/issue/TEST-1/transitions",
+			}))
+		})
+		It("fails if there is no transition to the close status", func() {
+			bot.Config.CloseStatus = "Done"
+			Expect(bot.closeIssue(context.Background(), issue)).To(MatchError(ContainSubstring(`no transition found to status "Done"`)))
+		})
+	})
+
+	Context("archive", func() {
+		BeforeEach(func() {
+			bot.Config.CloseStrategy = ArchiveStrategy
+			bot.Config.ArchiveLabel = "archived"
+			bot.Config.ArchiveField = "customfield_3"
+			bot.Config.ArchiveValue = "yes"
+		})
+		It("adds the archive label and field with the comment without transitioning", func() {
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{"PUT /rest/api/2/issue/TEST-1"}))
+			Expect(body(http.MethodPut, "/rest/api/2/issue/TEST-1")).To(And(
+				HaveKeyWithValue("update", And(
+					HaveKeyWithValue("labels", []interface{}{map[string]interface{}{"add": "archived"}}),
+					HaveKeyWithValue("comment", ConsistOf(HaveKeyWithValue("add", HaveKeyWithValue("body", HavePrefix("Closing stale issue."))))),
+				)),
+				HaveKeyWithValue("fields", map[string]interface{}{"customfield_3": "yes"}),
+			))
+		})
+	})
+
+	Context("move", func() {
+		BeforeEach(func() {
+			bot.Config.CloseStrategy = MoveStrategy
+			bot.Config.MoveProject = "ICE"
+			fake.Handlers["POST /rest/api/2/issue"] = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"id": "20", "key": "ICE-1"}`))
+			}
+		})
+		It("clones the issue into the move project, links it and closes the original", func() {
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"POST /rest/api/2/issue",
+				"POST /rest/api/2/issueLink",
+				"POST /rest/api/2/issue/TEST-1/transitions",
+			}))
+			Expect(body(http.MethodPost, "/rest/api/2/issue")).To(HaveKeyWithValue("fields", And(
+				HaveKeyWithValue("project", HaveKeyWithValue("key", "ICE")),
+				HaveKeyWithValue("issuetype", HaveKeyWithValue("name", "Bug")),
+				HaveKeyWithValue("summary", "Something is broken"),
+				HaveKeyWithValue("description", "Steps to reproduce"),
+				HaveKeyWithValue("labels", []interface{}{"backend"}),
+			)))
+			Expect(body(http.MethodPost, "/rest/api/2/issueLink")).To(And(
+				HaveKeyWithValue("type", HaveKeyWithValue("name", "Cloners")),
+				HaveKeyWithValue("inwardIssue", HaveKeyWithValue("key", "TEST-1")),
+				HaveKeyWithValue("outwardIssue", HaveKeyWithValue("key", "ICE-1")),
+			))
+			Expect(body(http.MethodPost, "/rest/api/2/issue/TEST-1/transitions")).To(HaveKeyWithValue("update", HaveKeyWithValue("comment",
+				ConsistOf(HaveKeyWithValue("add", HaveKeyWithValue("body", ContainSubstring("This issue has been moved to ICE-1.")))))))
+		})
+		It("deletes the clone if it cannot be linked", func() {
+			fake.Handlers["POST /rest/api/2/issueLink"] = func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"errorMessages": ["No issue link type with name 'Cloners' found."]}`, http.StatusNotFound)
+			}
+			Expect(bot.closeIssue(context.Background(), issue)).To(MatchError(ContainSubstring(`link issue to clone "ICE-1"`)))
+			Expect(calls()).To(Equal([]string{
+				"POST /rest/api/2/issue",
+				"POST /rest/api/2/issueLink",
+				"DELETE /rest/api/2/issue/20",
+			}))
+		})
+		It("reports a clone that could neither be linked nor deleted", func() {
+			fake.Handlers["POST /rest/api/2/issueLink"] = func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"errorMessages": ["boom"]}`, http.StatusInternalServerError)
+			}
+			fake.Handlers["DELETE /rest/api/2/issue/20"] = func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"errorMessages": ["forbidden"]}`, http.StatusForbidden)
+			}
+			Expect(bot.closeIssue(context.Background(), issue)).To(MatchError(ContainSubstring(`delete unlinked clone "ICE-1"`)))
+		})
+		It("reuses an existing linked clone", func() {
+			fake.Issues[0]["fields"].(map[string]interface{})["issuelinks"] = []interface{}{map[string]interface{}{
+				"type":         map[string]interface{}{"name": "Cloners"},
+				"outwardIssue": map[string]interface{}{"key": "ICE-7"},
+			}}
+			Expect(bot.closeIssue(context.Background(), issue)).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+		})
+	})
+
+	Context("cascade", func() {
+		var parent *jira.Issue
+		BeforeEach(func() {
+			bot.Config.CascadeClose = true
+			bot.Config.StaleLabel = "lifecycle-stale"
+			bot.Prompt = true
+			parent = &jira.Issue{Key: "TEST-0", Fields: &jira.IssueFields{}}
+			issue.Fields.Status = &jira.Status{StatusCategory: jira.StatusCategory{Key: "new"}}
+		})
+		It("closes stale children confirmed at the prompt", func() {
+			bot.prompter = newPrompter(strings.NewReader("y\n"), io.Discard, fake.URL, time.Now())
+			Expect(bot.cascadeClose(context.Background(), parent, &Relatives{Children: []jira.Issue{*issue}})).To(Succeed())
+			Expect(calls()).To(ContainElement("POST /rest/api/2/issue/TEST-1/transitions"))
+		})
+		It("skips stale children declined at the prompt", func() {
+			bot.prompter = newPrompter(strings.NewReader("n\n"), io.Discard, fake.URL, time.Now())
+			Expect(bot.cascadeClose(context.Background(), parent, &Relatives{Children: []jira.Issue{*issue}})).To(Succeed())
+			Expect(calls()).To(BeEmpty())
+		})
+	})
+})
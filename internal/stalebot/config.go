@@ -1,11 +1,17 @@
 package stalebot
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
 )
 
@@ -13,20 +19,101 @@ type Config struct {
 	JiraBaseURL string `json:"jiraBaseURL"`
 	Project     string `json:"project"`
 
+	// TokenCommand, if set, is a shell command whose output is used as the
+	// personal access token (e.g. "pass show jira").
+	TokenCommand string `json:"tokenCommand"`
+
+	// DaysUntilStale and DaysUntilClose are the integer-day forms of StaleAfter
+	// and CloseAfter. Zero means unset.
 	DaysUntilStale int `json:"daysUntilStale"`
 	DaysUntilClose int `json:"daysUntilClose"`
 
+	// StaleAfter is how long an issue must be inactive before it is marked
+	// stale, and CloseAfter is how long a stale issue must remain inactive
+	// before it is closed. Unlike the integer-day fields, they may be zero.
+	StaleAfter *Duration `json:"staleAfter,omitempty"`
+	CloseAfter *Duration `json:"closeAfter,omitempty"`
+
 	OnlyLabels   []string `json:"onlyLabels"`
 	ExemptLabels []string `json:"exemptLabels"`
 
-	StaleLabel    string `json:"staleLabel"`
-	MarkComment   string `json:"markComment"`
-	UnmarkComment string `json:"unmarkComment"`
+	StaleLabel    string        `json:"staleLabel"`
+	MarkComment   string        `json:"markComment"`
+	MarkActions   []FieldAction `json:"markActions"`
+	UnmarkComment string        `json:"unmarkComment"`
+
+	// LabelMigration, if set, recognises the previous stale label while issues
+	// are migrated to StaleLabel with the migrate-label command.
+	LabelMigration *LabelMigration `json:"labelMigration,omitempty"`
+
+	// CommentVisibility, if set, restricts the mark, unmark and close comments
+	// to a project role or group.
+	CommentVisibility *CommentVisibility `json:"commentVisibility,omitempty"`
+
+	CloseStatus  string        `json:"closeStatus"`
+	CloseComment string        `json:"closeComment"`
+	CloseActions []FieldAction `json:"closeActions"`
+
+	CloseStrategy CloseStrategy `json:"closeStrategy"`
+	ArchiveLabel  string        `json:"archiveLabel"`
+	ArchiveField  string        `json:"archiveField"`
+	ArchiveValue  string        `json:"archiveValue"`
+	MoveProject   string        `json:"moveProject"`
+	MoveLinkType  string        `json:"moveLinkType"`
+
+	// ChildActivity treats an issue as active if any of its children (the
+	// issues in an epic, or the sub-tasks of an issue) were recently updated.
+	ChildActivity bool `json:"childActivity"`
+	// EpicLinkField is the ID of the custom field linking issues to epics. It
+	// is required to find the children of epics.
+	EpicLinkField string `json:"epicLinkField"`
+	// SubtasksInheritParent keeps sub-tasks of open parents from going stale
+	// while their parent is not stale, and unmarks them when their parent is
+	// unmarked. Under a stale parent, sub-tasks are marked and closed by their
+	// own activity.
+	SubtasksInheritParent bool `json:"subtasksInheritParent"`
+	// CascadeClose closes the stale children of an issue when it is closed.
+	CascadeClose bool `json:"cascadeClose"`
 
-	CloseStatus  string `json:"closeStatus"`
-	CloseComment string `json:"closeComment"`
+	// ActivityLinkTypes lists the issue link types (by name, e.g. "Blocks", or
+	// by relation, e.g. "is blocked by") whose linked issues' activity counts as
+	// activity on the issue itself.
+	ActivityLinkTypes []string `json:"activityLinkTypes"`
+
+	// ActivitySources lists what counts as activity on an issue: "updated"
+	// (any change, the default), "comments" (comments by humans) and
+	// "changelog" (changelog entries by humans). The latest activity from any
+	// of the sources is used. Comments and changes by bot accounts and by
+	// stalebot itself are not human activity.
+	ActivitySources []ActivitySource `json:"activitySources,omitempty"`
+
+	// BotAccounts lists the user names of automation accounts whose updates
+	// are not considered human activity.
+	BotAccounts []string `json:"botAccounts"`
+	// UnmarkMinHumanActions is the number of distinct people who must change
+	// or comment on an issue after it was marked stale before it is unmarked.
+	// Zero means any update unmarks the issue.
+	UnmarkMinHumanActions int `json:"unmarkMinHumanActions"`
+	// CloseAfterCycles closes an issue instead of marking it stale once it has
+	// been marked stale this many times. Zero disables escalation.
+	CloseAfterCycles int `json:"closeAfterCycles"`
+
+	// Digest configures the digest of issues that will soon be closed.
+	Digest *DigestConfig `json:"digest,omitempty"`
+	// RunNotifications configures the notifications posted after each run.
+	RunNotifications *RunNotificationsConfig `json:"runNotifications,omitempty"`
+	// Tracing configures the export of OpenTelemetry traces.
+	Tracing *TracingConfig `json:"tracing,omitempty"`
 
 	LimitPerRun int `json:"limitPerRun"`
+
+	// account is the user name of stalebot's own Jira account, which is looked
+	// up before issues are evaluated. Its changes are not human activity.
+	account string
+
+	// simulation is set on the config used by Simulate, whose synthesized
+	// changes are not human activity either.
+	simulation bool
 }
 
 const (
@@ -38,9 +125,9 @@ const (
 
 var (
 	defaultMarkCommentFunc = func(c Config) string {
-		return fmt.Sprintf("[STALEBOT COMMENT] This issue is stale because it has not had activity for %d days. "+
-			"Comment, remove label %q, or make any another update to this issue to avoid closure in %d days.",
-			c.DaysUntilStale, c.StaleLabel, c.DaysUntilClose)
+		return fmt.Sprintf("[STALEBOT COMMENT] This issue is stale because it has not had activity for %s. "+
+			"Comment, remove label %q, or make any another update to this issue to avoid closure in %s.",
+			describeDuration(c.StaleThreshold()), c.StaleLabel, describeDuration(c.CloseThreshold()))
 	}
 	defaultUnmarkCommentFunc = func(c Config) string {
 		return fmt.Sprintf("[STALEBOT COMMENT] A recent update was detected, so this issue is no longer stale. "+
@@ -48,15 +135,28 @@ var (
 	}
 )
 
+// LoadConfig loads, defaults and validates the config in configFile.
+//
+// References to environment variables of the form ${VAR} in string values are
+// expanded after the file is parsed, so that variable values are never parsed
+// as YAML. The top-level "include" key lists config fragments
+// (relative to the including file) that are loaded first; keys in the
+// including file override keys from its includes. Unknown keys are rejected.
 func LoadConfig(configFile string) (*Config, error) {
-	configData, err := os.ReadFile(configFile)
+	raw, err := loadConfigMap(configFile, sets.NewString())
 	if err != nil {
 		return nil, err
 	}
-	c := &Config{}
-	if err := yaml.Unmarshal(configData, c); err != nil {
+	configData, err := json.Marshal(raw)
+	if err != nil {
 		return nil, err
 	}
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(configData))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("decode config file %q: %v", configFile, err)
+	}
 
 	c.setDefaults()
 
@@ -66,25 +166,193 @@ func LoadConfig(configFile string) (*Config, error) {
 	return c, nil
 }
 
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} references in the string values of v, a value
+// parsed from JSON, with the value of the environment variable VAR. The names
+// of unset variables are added to missing.
+func expandEnv(v interface{}, missing sets.String) interface{} {
+	switch v := v.(type) {
+	case string:
+		return envVarRegexp.ReplaceAllStringFunc(v, func(ref string) string {
+			name := envVarRegexp.FindStringSubmatch(ref)[1]
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				missing.Insert(name)
+			}
+			return val
+		})
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = expandEnv(e, missing)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = expandEnv(e, missing)
+		}
+	}
+	return v
+}
+
+// loadConfigMap loads the config file at path, and the fragments it includes,
+// into a single map of top-level config keys.
+func loadConfigMap(path string, loading sets.String) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if loading.Has(abs) {
+		return nil, fmt.Errorf("config file %q includes itself", path)
+	}
+	loading.Insert(abs)
+	defer loading.Delete(abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %q: %v", path, err)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(jsonData, &m); err != nil {
+		return nil, fmt.Errorf("parse config file %q: %v", path, err)
+	}
+	missing := sets.NewString()
+	expandEnv(m, missing)
+	if missing.Len() > 0 {
+		return nil, fmt.Errorf("config file %q: undefined environment variables: %s", path, strings.Join(missing.List(), ", "))
+	}
+
+	includes, err := includePaths(m["include"])
+	if err != nil {
+		return nil, fmt.Errorf("config file %q: %v", path, err)
+	}
+	delete(m, "include")
+
+	merged := map[string]interface{}{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		fragment, err := loadConfigMap(include, loading)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range fragment {
+			merged[k] = v
+		}
+	}
+	for k, v := range m {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+func includePaths(v interface{}) ([]string, error) {
+	switch include := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{include}, nil
+	case []interface{}:
+		paths := make([]string, 0, len(include))
+		for _, p := range include {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("include must be a path or a list of paths")
+			}
+			paths = append(paths, s)
+		}
+		return paths, nil
+	}
+	return nil, fmt.Errorf("include must be a path or a list of paths")
+}
+
 func (c *Config) setDefaults() {
 	if c.StaleLabel == "" {
 		c.StaleLabel = defaultStaleLabel
 	}
-	if c.DaysUntilStale <= 0 {
+	if c.StaleAfter == nil && c.DaysUntilStale <= 0 {
 		c.DaysUntilStale = defaultDaysUntilStale
 	}
-	if c.DaysUntilClose <= 0 {
+	if c.CloseAfter == nil && c.DaysUntilClose <= 0 {
 		c.DaysUntilClose = defaultDaysUntilClose
 	}
 	if c.LimitPerRun <= 0 {
 		c.LimitPerRun = defaultLimitPerRun
 	}
+	if c.CloseStrategy == "" {
+		c.CloseStrategy = TransitionStrategy
+	}
+	if c.CloseStrategy == MoveStrategy && c.MoveLinkType == "" {
+		c.MoveLinkType = defaultMoveLinkType
+	}
 	if c.MarkComment == "" {
 		c.MarkComment = defaultMarkCommentFunc(*c)
 	}
 	if c.UnmarkComment == "" {
 		c.UnmarkComment = defaultUnmarkCommentFunc(*c)
 	}
+	if c.Digest != nil {
+		c.Digest.setDefaults()
+	}
+	if c.RunNotifications != nil {
+		c.RunNotifications.setDefaults()
+	}
+}
+
+// StaleThreshold returns how long an issue must be inactive before it is
+// marked stale.
+func (c *Config) StaleThreshold() time.Duration {
+	if c.StaleAfter != nil {
+		return c.StaleAfter.Duration
+	}
+	return days(c.DaysUntilStale)
+}
+
+// CloseThreshold returns how long a stale issue must remain inactive before it
+// is closed.
+func (c *Config) CloseThreshold() time.Duration {
+	if c.CloseAfter != nil {
+		return c.CloseAfter.Duration
+	}
+	return days(c.DaysUntilClose)
+}
+
+// MarkCommentData is the data available to the markComment template.
+type MarkCommentData struct {
+	// Cycle is the number of times the issue has been marked stale, including
+	// this time.
+	Cycle int
+	// DaysUntilStale and DaysUntilClose are the thresholds in whole days.
+	DaysUntilStale int
+	DaysUntilClose int
+	// StaleAfter and CloseAfter are the thresholds formatted for humans,
+	// e.g. "90 days".
+	StaleAfter string
+	CloseAfter string
+	StaleLabel string
+}
+
+func (c *Config) renderMarkComment(cycle int) (string, error) {
+	tmpl, err := template.New("markComment").Parse(c.MarkComment)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, MarkCommentData{
+		Cycle:          cycle,
+		DaysUntilStale: int(c.StaleThreshold() / day),
+		DaysUntilClose: int(c.CloseThreshold() / day),
+		StaleAfter:     describeDuration(c.StaleThreshold()),
+		CloseAfter:     describeDuration(c.CloseThreshold()),
+		StaleLabel:     c.StaleLabel,
+	}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
 func (c *Config) EligibleIssuesQuery() string {
@@ -93,9 +361,29 @@ func (c *Config) EligibleIssuesQuery() string {
 		fmt.Sprintf("statusCategory != Done"),
 	}
 	ands = append(ands, c.exemptOrOnlyLabels()...)
+	if c.CloseStrategy == ArchiveStrategy {
+		ands = append(ands, fmt.Sprintf("(labels != %s OR labels is EMPTY)", c.ArchiveLabel))
+	}
 	return completeQuery(ands)
 }
 
+// SearchFields returns the issue fields that must be fetched for eligible
+// issues to determine and perform their operations.
+func (c *Config) SearchFields() []string {
+	fields := []string{"key", "issuetype", "summary", "labels", "status", "changelog", "updated", "assignee"}
+	fields = append(fields, fieldsFor(c.MarkActions)...)
+	fields = append(fields, fieldsFor(c.CloseActions)...)
+	if c.CloseStrategy == MoveStrategy {
+		fields = append(fields, "description")
+	}
+	fields = append(fields, c.activityFields()...)
+	fields = append(fields, c.hierarchyFields()...)
+	if len(c.ActivityLinkTypes) > 0 {
+		fields = append(fields, "issuelinks")
+	}
+	return sets.NewString(fields...).List()
+}
+
 func (c *Config) exemptOrOnlyLabels() []string {
 	ands := make([]string, 0)
 	if len(c.ExemptLabels) > 0 {
@@ -138,9 +426,84 @@ func (c *Config) Validate() error {
 		validateErrors = append(validateErrors, fmt.Errorf("config must not specify invalid staleLabel `%s`", c.StaleLabel))
 	}
 
-	if !isValidStatusName(c.CloseStatus) {
+	if c.CloseStrategy != "" {
+		if err := c.CloseStrategy.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid closeStrategy: %v", err))
+		}
+	}
+	if c.CloseStrategy != ArchiveStrategy && !isValidStatusName(c.CloseStatus) {
 		validateErrors = append(validateErrors, fmt.Errorf("config must not specify invalid closeStatus `%s`", c.CloseStatus))
 	}
+	if c.CloseStrategy == ArchiveStrategy && !isValidLabel(c.ArchiveLabel) {
+		validateErrors = append(validateErrors, fmt.Errorf("config must specify valid archiveLabel when closeStrategy is %q", ArchiveStrategy))
+	}
+	if c.CloseStrategy == MoveStrategy && !isValidProjectKey(c.MoveProject) {
+		validateErrors = append(validateErrors, fmt.Errorf("config must specify valid moveProject when closeStrategy is %q", MoveStrategy))
+	}
+
+	if c.StaleAfter != nil && c.DaysUntilStale != 0 {
+		validateErrors = append(validateErrors, fmt.Errorf("config must not specify both daysUntilStale and staleAfter"))
+	}
+	if c.CloseAfter != nil && c.DaysUntilClose != 0 {
+		validateErrors = append(validateErrors, fmt.Errorf("config must not specify both daysUntilClose and closeAfter"))
+	}
+	if c.StaleThreshold() <= 0 {
+		validateErrors = append(validateErrors, fmt.Errorf("config must specify a positive stale threshold"))
+	}
+	if c.CloseThreshold() < 0 {
+		validateErrors = append(validateErrors, fmt.Errorf("config must not specify a negative close threshold"))
+	}
+
+	if _, err := c.renderMarkComment(1); err != nil {
+		validateErrors = append(validateErrors, fmt.Errorf("config contains invalid markComment template: %v", err))
+	}
+	if c.UnmarkMinHumanActions < 0 {
+		validateErrors = append(validateErrors, fmt.Errorf("config must not specify negative unmarkMinHumanActions"))
+	}
+	if c.CloseAfterCycles < 0 {
+		validateErrors = append(validateErrors, fmt.Errorf("config must not specify negative closeAfterCycles"))
+	}
+
+	for _, a := range c.MarkActions {
+		if err := a.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid markActions entry: %v", err))
+		}
+	}
+	for _, a := range c.CloseActions {
+		if err := a.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid closeActions entry: %v", err))
+		}
+	}
+	if c.LabelMigration != nil {
+		if err := c.LabelMigration.validate(c.StaleLabel); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid labelMigration: %v", err))
+		}
+	}
+	for _, s := range c.ActivitySources {
+		if err := s.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid activitySources entry: %v", err))
+		}
+	}
+	if c.CommentVisibility != nil {
+		if err := c.CommentVisibility.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid commentVisibility: %v", err))
+		}
+	}
+	if c.Digest != nil {
+		if err := c.Digest.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid digest: %v", err))
+		}
+	}
+	if c.RunNotifications != nil {
+		if err := c.RunNotifications.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid runNotifications: %v", err))
+		}
+	}
+	if c.Tracing != nil {
+		if err := c.Tracing.validate(); err != nil {
+			validateErrors = append(validateErrors, fmt.Errorf("config contains invalid tracing: %v", err))
+		}
+	}
 
 	return newAggregateError(validateErrors)
 }
@@ -0,0 +1,139 @@
+package stalebot_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("LoadConfig", func() {
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	It("expands environment variables", func() {
+		GinkgoT().Setenv("STALEBOT_TEST_URL", "https://jira.example.com")
+		cfg, err := stalebot.LoadConfig(writeFile("config.yaml", "jiraBaseURL: ${STALEBOT_TEST_URL}\nproject: TEST\ncloseStatus: Closed\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.JiraBaseURL).To(Equal("https://jira.example.com"))
+	})
+	It("rejects undefined environment variables", func() {
+		_, err := stalebot.LoadConfig(writeFile("config.yaml", "jiraBaseURL: ${STALEBOT_TEST_UNDEFINED}\nproject: TEST\ncloseStatus: Closed\n"))
+		Expect(err).To(MatchError(ContainSubstring("STALEBOT_TEST_UNDEFINED")))
+	})
+	It("expands environment variables in nested values without parsing them", func() {
+		GinkgoT().Setenv("STALEBOT_TEST_COMMENT", "line one\nproject: OTHER # not a comment")
+		cfg, err := stalebot.LoadConfig(writeFile("config.yaml", "jiraBaseURL: https://jira.example.com\nproject: TEST\ncloseStatus: Closed\nexemptLabels: [lifecycle-frozen]\nmarkComment: \"${STALEBOT_TEST_COMMENT}\"\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Project).To(Equal("TEST"))
+		Expect(cfg.MarkComment).To(Equal("line one\nproject: OTHER # not a comment"))
+	})
+	It("ignores references in comments", func() {
+		cfg, err := stalebot.LoadConfig(writeFile("config.yaml", "# set ${STALEBOT_TEST_UNDEFINED} to override\njiraBaseURL: https://jira.example.com\nproject: TEST\ncloseStatus: Closed\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.JiraBaseURL).To(Equal("https://jira.example.com"))
+	})
+	It("merges included fragments, with the including file taking precedence", func() {
+		writeFile("common.yaml", "exemptLabels: [lifecycle-frozen]\ncloseStatus: Obsolete\nmarkComment: common comment\n")
+		cfg, err := stalebot.LoadConfig(writeFile("config.yaml", "include: common.yaml\njiraBaseURL: https://jira.example.com\nproject: TEST\ncloseStatus: Closed\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.ExemptLabels).To(Equal([]string{"lifecycle-frozen"}))
+		Expect(cfg.MarkComment).To(Equal("common comment"))
+		Expect(cfg.CloseStatus).To(Equal("Closed"))
+	})
+	It("rejects include cycles", func() {
+		writeFile("a.yaml", "include: b.yaml\n")
+		writeFile("b.yaml", "include: a.yaml\n")
+		_, err := stalebot.LoadConfig(filepath.Join(dir, "a.yaml"))
+		Expect(err).To(MatchError(ContainSubstring("includes itself")))
+	})
+	It("rejects unknown fields", func() {
+		_, err := stalebot.LoadConfig(writeFile("config.yaml", "jiraBaseURL: https://jira.example.com\nproject: TEST\ncloseStatus: Closed\ndaysUntillStale: 10\n"))
+		Expect(err).To(MatchError(ContainSubstring("daysUntillStale")))
+	})
+})
+
+var _ = Describe("JSONSchema", func() {
+	It("describes config fields and disallows unknown fields", func() {
+		schema := stalebot.JSONSchema()
+		Expect(schema).To(HaveKeyWithValue("additionalProperties", false))
+		Expect(schema["properties"]).To(HaveKey("daysUntilStale"))
+		Expect(schema["properties"]).To(HaveKey("include"))
+	})
+})
+
+var _ = Describe("ParseDuration", func() {
+	DescribeTable("parses supported formats",
+		func(in string, expected time.Duration) {
+			Expect(stalebot.ParseDuration(in)).To(Equal(expected))
+		},
+		Entry("Go duration", "2160h", 2160*time.Hour),
+		Entry("days", "90d", 90*24*time.Hour),
+		Entry("weeks", "12w", 12*7*24*time.Hour),
+		Entry("zero days", "0d", time.Duration(0)),
+		Entry("ISO-8601 months", "P3M", 90*24*time.Hour),
+		Entry("ISO-8601 years", "P1Y", 365*24*time.Hour),
+		Entry("ISO-8601 date and time", "P1DT12H", 36*time.Hour),
+		Entry("ISO-8601 zero", "PT0S", time.Duration(0)),
+	)
+	DescribeTable("rejects invalid formats",
+		func(in string) {
+			_, err := stalebot.ParseDuration(in)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("empty", ""),
+		Entry("bare P", "P"),
+		Entry("bare T", "P1DT"),
+		Entry("unknown unit", "3y"),
+	)
+})
+
+var _ = Describe("Thresholds", func() {
+	var dir string
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+	load := func(content string) (*stalebot.Config, error) {
+		path := filepath.Join(dir, "config.yaml")
+		Expect(os.WriteFile(path, []byte("jiraBaseURL: https://jira.example.com\nproject: TEST\ncloseStatus: Closed\n"+content), 0600)).To(Succeed())
+		return stalebot.LoadConfig(path)
+	}
+
+	It("defaults unset thresholds", func() {
+		cfg, err := load("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.StaleThreshold()).To(Equal(90 * 24 * time.Hour))
+		Expect(cfg.CloseThreshold()).To(Equal(14 * 24 * time.Hour))
+	})
+	It("accepts integer days for backward compatibility", func() {
+		cfg, err := load("daysUntilStale: 180\ndaysUntilClose: 90\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.StaleThreshold()).To(Equal(180 * 24 * time.Hour))
+		Expect(cfg.CloseThreshold()).To(Equal(90 * 24 * time.Hour))
+	})
+	It("distinguishes a zero close threshold from an unset one", func() {
+		cfg, err := load("staleAfter: P3M\ncloseAfter: 0s\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.StaleThreshold()).To(Equal(90 * 24 * time.Hour))
+		Expect(cfg.CloseThreshold()).To(Equal(time.Duration(0)))
+	})
+	It("rejects specifying both forms of a threshold", func() {
+		_, err := load("daysUntilStale: 180\nstaleAfter: 12w\n")
+		Expect(err).To(MatchError(ContainSubstring("both daysUntilStale and staleAfter")))
+	})
+	It("rejects a zero stale threshold", func() {
+		_, err := load("staleAfter: 0s\n")
+		Expect(err).To(MatchError(ContainSubstring("positive stale threshold")))
+	})
+})
@@ -0,0 +1,391 @@
+package stalebot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"text/template"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type DigestGrouping string
+
+const (
+	// GroupByAssignee groups digest issues by their assignee.
+	GroupByAssignee DigestGrouping = "assignee"
+	// GroupByComponentLead groups digest issues by the leads of their
+	// components.
+	GroupByComponentLead DigestGrouping = "componentLead"
+)
+
+const (
+	defaultDigestWithin  = 7 * day
+	defaultDigestSubject = `[{{.Project}}] {{len .Issues}} issue(s) will be closed as stale in the next {{.Within}}`
+	defaultDigestBody    = `The following issues in {{.Project}} will be closed as stale in the next {{.Within}}, unless they are updated.
+{{range .Groups}}
+## {{.Title}}
+{{range .Issues}}
+- [{{.Key}}]({{.URL}}) {{.Summary}} (closes {{.CloseAt.Format "2006-01-02"}})
+{{- end}}
+{{end}}
+Comment on or update an issue to keep it open.
+`
+)
+
+// DigestConfig configures the digest of issues that will soon be closed.
+type DigestConfig struct {
+	// Within is how far ahead issues are included in the digest. It defaults
+	// to 7 days.
+	Within *Duration `json:"within,omitempty"`
+	// GroupBy lists the groupings of digest issues. It defaults to assignee.
+	GroupBy []DigestGrouping `json:"groupBy,omitempty"`
+	// EmailRecipients makes email notifiers also send each assignee and
+	// component lead in the digest a personal digest of their groups.
+	EmailRecipients bool `json:"emailRecipients,omitempty"`
+
+	// Subject and Template are text/template templates of the digest's subject
+	// and Markdown body, executed with a Digest.
+	Subject  string `json:"subject,omitempty"`
+	Template string `json:"template,omitempty"`
+
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+func (c *DigestConfig) setDefaults() {
+	if c.Within == nil {
+		c.Within = &Duration{Duration: defaultDigestWithin}
+	}
+	if len(c.GroupBy) == 0 {
+		c.GroupBy = []DigestGrouping{GroupByAssignee}
+	}
+	if c.Subject == "" {
+		c.Subject = defaultDigestSubject
+	}
+	if c.Template == "" {
+		c.Template = defaultDigestBody
+	}
+}
+
+func (c *DigestConfig) validate() error {
+	var errs []error
+	if c.Within != nil && c.Within.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("within must be positive"))
+	}
+	for _, g := range c.GroupBy {
+		if g != GroupByAssignee && g != GroupByComponentLead {
+			errs = append(errs, fmt.Errorf("unknown groupBy %q", g))
+		}
+	}
+	if _, err := c.Render(&Digest{}); err != nil {
+		errs = append(errs, err)
+	}
+	for _, n := range c.Notifiers {
+		if err := n.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return newAggregateError(errs)
+}
+
+// Digest lists the issues that will be closed soon.
+type Digest struct {
+	Time    time.Time
+	Project string
+	// Within describes how far ahead issues are included, e.g. "7 days".
+	Within string
+	Issues []DigestIssue
+	Groups []DigestGroup
+}
+
+// DigestIssue is an issue that will be closed at CloseAt, unless it is
+// updated before then.
+type DigestIssue struct {
+	Key        string
+	Summary    string
+	URL        string
+	Assignee   string
+	Components []string
+	CloseAt    time.Time
+}
+
+// DigestGroup holds the digest issues of a single assignee or component lead.
+type DigestGroup struct {
+	GroupBy DigestGrouping
+	// Name is the user name of the assignee or component lead, and Email their
+	// email address, if known.
+	Name  string
+	Email string
+	// Component is the component led by the group's user, for component lead
+	// groups.
+	Component string
+	Issues    []DigestIssue
+}
+
+// Title describes the group, e.g. "Assigned to jdoe".
+func (g DigestGroup) Title() string {
+	if g.GroupBy == GroupByComponentLead {
+		return fmt.Sprintf("Component %s (lead %s)", g.Component, g.Name)
+	}
+	if g.Name == "" {
+		return "Unassigned"
+	}
+	return fmt.Sprintf("Assigned to %s", g.Name)
+}
+
+// Digest collects the eligible issues that will be closed within the digest's
+// window if they see no further activity.
+func (bot *Stalebot) Digest(ctx context.Context, now time.Time) (*Digest, error) {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+	if err := bot.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid stalebot config: %v", err)
+	}
+	cfg := bot.Config.digestConfig()
+
+	fields := sets.NewString(bot.Config.SearchFields()...).Insert("assignee", "components", "summary").List()
+	plan, err := bot.plan(ctx, now, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{Time: now, Project: bot.Config.Project, Within: describeDuration(cfg.Within.Duration)}
+	assignees := map[string]*DigestGroup{}
+	byComponent := map[string][]DigestIssue{}
+	for _, p := range plan {
+		i := &p.Issue
+		var closeAt *time.Time
+		for _, op := range bot.Config.projectOperations(now, cfg.Within.Duration, i, p.Relatives) {
+			if op.op == Close {
+				at := op.at
+				closeAt = &at
+			}
+		}
+		if closeAt == nil {
+			continue
+		}
+		di := DigestIssue{
+			Key:     i.Key,
+			Summary: i.Fields.Summary,
+			URL:     issueURL(bot.Config.JiraBaseURL, i.Key),
+			CloseAt: *closeAt,
+		}
+		if i.Fields.Assignee != nil {
+			di.Assignee = i.Fields.Assignee.Name
+		}
+		for _, c := range i.Fields.Components {
+			di.Components = append(di.Components, c.Name)
+			byComponent[c.Name] = append(byComponent[c.Name], di)
+		}
+		digest.Issues = append(digest.Issues, di)
+
+		if _, ok := assignees[di.Assignee]; !ok {
+			g := &DigestGroup{GroupBy: GroupByAssignee, Name: di.Assignee}
+			if i.Fields.Assignee != nil {
+				g.Email = i.Fields.Assignee.EmailAddress
+			}
+			assignees[di.Assignee] = g
+		}
+		assignees[di.Assignee].Issues = append(assignees[di.Assignee].Issues, di)
+	}
+
+	for _, grouping := range cfg.GroupBy {
+		var groups []DigestGroup
+		switch grouping {
+		case GroupByAssignee:
+			for _, g := range assignees {
+				groups = append(groups, *g)
+			}
+		case GroupByComponentLead:
+			if len(byComponent) == 0 {
+				continue
+			}
+			components, err := bot.projectComponents(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("get project components: %v", err)
+			}
+			for _, c := range components {
+				if issues, ok := byComponent[c.Name]; ok && c.Lead.Name != "" {
+					groups = append(groups, DigestGroup{GroupBy: GroupByComponentLead, Name: c.Lead.Name, Email: c.Lead.EmailAddress, Component: c.Name, Issues: issues})
+				}
+			}
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if groups[i].Name != groups[j].Name {
+				return groups[i].Name < groups[j].Name
+			}
+			return groups[i].Component < groups[j].Component
+		})
+		digest.Groups = append(digest.Groups, groups...)
+	}
+	return digest, nil
+}
+
+func (bot *Stalebot) projectComponents(ctx context.Context) ([]jira.ProjectComponent, error) {
+	req, err := bot.Client.NewRequest(ctx, http.MethodGet, fmt.Sprintf("rest/api/2/project/%s/components", url.PathEscape(bot.Config.Project)), nil)
+	if err != nil {
+		return nil, err
+	}
+	var components []jira.ProjectComponent
+	if resp, err := bot.Client.Do(req, &components); err != nil {
+		return nil, jira.NewJiraError(resp, err)
+	}
+	return components, nil
+}
+
+// digestConfig returns the defaulted digest settings, which are the defaults
+// if the config has no digest section.
+func (c *Config) digestConfig() *DigestConfig {
+	d := DigestConfig{}
+	if c.Digest != nil {
+		d = *c.Digest
+	}
+	d.setDefaults()
+	return &d
+}
+
+// RenderDigest renders the digest message with the configured templates.
+func (bot *Stalebot) RenderDigest(d *Digest) (Message, error) {
+	return bot.Config.digestConfig().Render(d)
+}
+
+// RenderPersonalDigests renders the personal digest messages that email
+// notifiers send if EmailRecipients is set.
+func (bot *Stalebot) RenderPersonalDigests(d *Digest) ([]Message, error) {
+	cfg := bot.Config.digestConfig()
+	if !cfg.EmailRecipients {
+		return nil, nil
+	}
+	return cfg.RenderPersonal(d)
+}
+
+// Render renders the digest message.
+func (c *DigestConfig) Render(d *Digest) (Message, error) {
+	var msg Message
+	subject, err := executeTemplate("subject", c.Subject, d)
+	if err != nil {
+		return msg, err
+	}
+	body, err := executeTemplate("template", c.Template, d)
+	if err != nil {
+		return msg, err
+	}
+	return Message{Subject: subject, Body: body, Data: d}, nil
+}
+
+// RenderPersonal renders a message for each assignee and component lead in
+// the digest with a known email address, addressed to them and holding only
+// their groups and issues.
+func (c *DigestConfig) RenderPersonal(d *Digest) ([]Message, error) {
+	emails := sets.NewString()
+	for _, g := range d.Groups {
+		if g.Email != "" {
+			emails.Insert(g.Email)
+		}
+	}
+	msgs := make([]Message, 0, emails.Len())
+	for _, email := range emails.List() {
+		msg, err := c.Render(d.forRecipient(email))
+		if err != nil {
+			return nil, err
+		}
+		msg.To = []string{email}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// forRecipient returns the digest restricted to the groups of the user with
+// the given email address, and their issues.
+func (d *Digest) forRecipient(email string) *Digest {
+	personal := *d
+	personal.Groups = nil
+	keys := sets.NewString()
+	for _, g := range d.Groups {
+		if g.Email != email {
+			continue
+		}
+		personal.Groups = append(personal.Groups, g)
+		for _, i := range g.Issues {
+			keys.Insert(i.Key)
+		}
+	}
+	personal.Issues = nil
+	for _, i := range d.Issues {
+		if keys.Has(i.Key) {
+			personal.Issues = append(personal.Issues, i)
+		}
+	}
+	return &personal
+}
+
+func executeTemplate(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("execute %s: %v", name, err)
+	}
+	return buf.String(), nil
+}
+
+// SendDigest renders the digest and delivers it with each configured
+// notifier. If EmailRecipients is set, email notifiers send the personal
+// digests, and the full digest only if they have recipients of their own.
+// Empty digests are not sent.
+func (bot *Stalebot) SendDigest(ctx context.Context, d *Digest) error {
+	cfg := bot.Config.digestConfig()
+	if len(d.Issues) == 0 {
+		bot.Logger.Info("no issues will be closed soon, not sending digest", "within", d.Within)
+		return nil
+	}
+	if len(cfg.Notifiers) == 0 {
+		return fmt.Errorf("no digest notifiers configured")
+	}
+	msg, err := cfg.Render(d)
+	if err != nil {
+		return fmt.Errorf("render digest: %v", err)
+	}
+	var personal []Message
+	if cfg.EmailRecipients {
+		if personal, err = cfg.RenderPersonal(d); err != nil {
+			return fmt.Errorf("render personal digests: %v", err)
+		}
+	}
+	var errs []error
+	send := func(nc NotifierConfig, msg Message) {
+		n, err := NewNotifier(nc)
+		if err == nil {
+			err = n.Notify(ctx, msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s notifier: %v", nc.Type, err))
+			return
+		}
+		bot.Logger.Info("sent digest", "notifier", nc.Type, "to", msg.To, "issues", len(msg.Data.(*Digest).Issues))
+	}
+	for _, nc := range cfg.Notifiers {
+		if nc.Type != SMTPNotifier || !cfg.EmailRecipients {
+			send(nc, msg)
+			continue
+		}
+		if len(nc.To) > 0 {
+			send(nc, msg)
+		}
+		// Personal digests are sent to their recipient only.
+		personalConfig := nc
+		personalConfig.To = nil
+		for _, m := range personal {
+			send(personalConfig, m)
+		}
+	}
+	return newAggregateError(errs)
+}
@@ -0,0 +1,172 @@
+package stalebot_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Digest", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		now  = time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	)
+	staleIssue := func(key string, markedAt time.Time, assignee string, components ...string) map[string]interface{} {
+		fields := map[string]interface{}{
+			"summary": "Issue " + key,
+			"updated": markedAt.Format(jiraTime),
+			"labels":  []string{"lifecycle-stale"},
+			"status":  map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+		}
+		if assignee != "" {
+			fields["assignee"] = map[string]interface{}{"name": assignee, "emailAddress": assignee + "@example.com"}
+		}
+		var cs []interface{}
+		for _, c := range components {
+			cs = append(cs, map[string]interface{}{"name": c})
+		}
+		fields["components"] = cs
+		return map[string]interface{}{
+			"id":     key,
+			"key":    key,
+			"fields": fields,
+			"changelog": map[string]interface{}{"histories": []interface{}{map[string]interface{}{
+				"author":  map[string]interface{}{"name": "stalebot"},
+				"created": markedAt.Format(jiraTime),
+				"items":   []interface{}{map[string]interface{}{"field": "labels", "toString": "lifecycle-stale"}},
+			}}},
+		}
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		fake.Handlers["GET /rest/api/2/project/TEST/components"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`[{"name": "api", "lead": {"name": "lead", "emailAddress": "lead@example.com"}}, {"name": "cli"}]`))
+		}
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(`jiraBaseURL: https://jira.example.com
+project: TEST
+closeStatus: Closed
+staleAfter: 30d
+closeAfter: 10d
+exemptLabels: [lifecycle-frozen]
+digest:
+  groupBy: [assignee, componentLead]
+  emailRecipients: true
+`), 0600)).To(Succeed())
+		cfg, err := stalebot.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		bot = &stalebot.Stalebot{Client: fake.JiraClient(), Config: *cfg, Logger: logr.Discard()}
+
+		fake.Issues = append(fake.Issues,
+			staleIssue("TEST-1", now.Add(-5*day), "jdoe", "api"),
+			staleIssue("TEST-2", now.Add(-8*day), "", "cli"),
+			staleIssue("TEST-3", now.Add(-1*day), "jdoe"),
+		)
+	})
+
+	It("groups issues that will soon be closed", func() {
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest.Within).To(Equal("7 days"))
+
+		test1 := stalebot.DigestIssue{Key: "TEST-1", Summary: "Issue TEST-1", URL: "https://jira.example.com/browse/TEST-1", Assignee: "jdoe", Components: []string{"api"}, CloseAt: now.Add(5 * day)}
+		test2 := stalebot.DigestIssue{Key: "TEST-2", Summary: "Issue TEST-2", URL: "https://jira.example.com/browse/TEST-2", Components: []string{"cli"}, CloseAt: now.Add(2 * day)}
+		Expect(digest.Issues).To(Equal([]stalebot.DigestIssue{test1, test2}))
+		Expect(digest.Groups).To(Equal([]stalebot.DigestGroup{
+			{GroupBy: stalebot.GroupByAssignee, Issues: []stalebot.DigestIssue{test2}},
+			{GroupBy: stalebot.GroupByAssignee, Name: "jdoe", Email: "jdoe@example.com", Issues: []stalebot.DigestIssue{test1}},
+			{GroupBy: stalebot.GroupByComponentLead, Name: "lead", Email: "lead@example.com", Component: "api", Issues: []stalebot.DigestIssue{test1}},
+		}))
+	})
+	It("renders the digest", func() {
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		msg, err := bot.RenderDigest(digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Subject).To(Equal("[TEST] 2 issue(s) will be closed as stale in the next 7 days"))
+		Expect(msg.Body).To(ContainSubstring("## Unassigned\n\n- [TEST-2](https://jira.example.com/browse/TEST-2) Issue TEST-2 (closes 2025-06-03)\n"))
+		Expect(msg.Body).To(ContainSubstring("## Assigned to jdoe\n\n- [TEST-1](https://jira.example.com/browse/TEST-1) Issue TEST-1 (closes 2025-06-06)\n"))
+		Expect(msg.Body).To(ContainSubstring("## Component api (lead lead)\n"))
+		Expect(msg.To).To(BeEmpty())
+	})
+	It("renders a personal digest for each recipient", func() {
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		msgs, err := bot.RenderPersonalDigests(digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msgs).To(HaveLen(2))
+		Expect(msgs[0].To).To(Equal([]string{"jdoe@example.com"}))
+		Expect(msgs[0].Subject).To(Equal("[TEST] 1 issue(s) will be closed as stale in the next 7 days"))
+		Expect(msgs[0].Body).To(ContainSubstring("## Assigned to jdoe\n"))
+		Expect(msgs[0].Body).NotTo(Or(ContainSubstring("TEST-2"), ContainSubstring("## Component")))
+		Expect(msgs[1].To).To(Equal([]string{"lead@example.com"}))
+		Expect(msgs[1].Body).To(ContainSubstring("## Component api (lead lead)\n"))
+		Expect(msgs[1].Body).NotTo(Or(ContainSubstring("TEST-2"), ContainSubstring("## Assigned to")))
+	})
+	It("emails each recipient their personal digest", func() {
+		server := newFakeSMTPServer()
+		DeferCleanup(server.Close)
+		bot.Config.Digest.Notifiers = []stalebot.NotifierConfig{{Type: stalebot.SMTPNotifier, SMTPAddress: server.Addr(), From: "stalebot@example.com"}}
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bot.SendDigest(context.Background(), digest)).To(Succeed())
+		Expect(server.rcpts).To(Equal([]string{"jdoe@example.com", "lead@example.com"}))
+		Expect(server.mails).To(HaveLen(2))
+		Expect(server.mails[0]).To(And(ContainSubstring("To: jdoe@example.com\r\n"), Not(ContainSubstring("TEST-2"))))
+		Expect(server.mails[1]).To(And(ContainSubstring("To: lead@example.com\r\n"), Not(ContainSubstring("TEST-2"))))
+	})
+	It("also emails the full digest to the notifier's own recipients", func() {
+		server := newFakeSMTPServer()
+		DeferCleanup(server.Close)
+		bot.Config.Digest.Notifiers = []stalebot.NotifierConfig{{Type: stalebot.SMTPNotifier, SMTPAddress: server.Addr(), From: "stalebot@example.com", To: []string{"team@example.com"}}}
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bot.SendDigest(context.Background(), digest)).To(Succeed())
+		Expect(server.rcpts).To(Equal([]string{"team@example.com", "jdoe@example.com", "lead@example.com"}))
+		Expect(server.mails).To(HaveLen(3))
+		Expect(server.mails[0]).To(And(ContainSubstring("To: team@example.com\r\n"), ContainSubstring("TEST-2")))
+	})
+	It("renders custom templates", func() {
+		bot.Config.Digest.Subject = "{{.Project}} digest"
+		bot.Config.Digest.Template = "{{range .Issues}}{{.Key}} {{end}}"
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		msg, err := bot.RenderDigest(digest)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.Subject).To(Equal("TEST digest"))
+		Expect(msg.Body).To(Equal("TEST-1 TEST-2 "))
+	})
+	It("sends the digest with each notifier", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "digest.md")
+		bot.Config.Digest.Notifiers = []stalebot.NotifierConfig{{Type: stalebot.FileNotifier, Path: path}}
+		digest, err := bot.Digest(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bot.SendDigest(context.Background(), digest)).To(Succeed())
+		Expect(os.ReadFile(path)).To(ContainSubstring("# [TEST] 2 issue(s) will be closed"))
+	})
+	It("does not send empty digests", func() {
+		bot.Config.Digest.Notifiers = []stalebot.NotifierConfig{{Type: stalebot.WebhookNotifier, URL: "http://127.0.0.1:1"}}
+		Expect(bot.SendDigest(context.Background(), &stalebot.Digest{})).To(Succeed())
+	})
+	It("rejects invalid digest configs", func() {
+		bot.Config.Digest.GroupBy = []stalebot.DigestGrouping{"reporter"}
+		bot.Config.Digest.Template = "{{.Nope}}"
+		Expect(bot.Config.Validate()).To(MatchError(And(
+			ContainSubstring(`unknown groupBy "reporter"`),
+			ContainSubstring("execute template"),
+		)))
+	})
+})
@@ -0,0 +1,110 @@
+package stalebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day   = 24 * time.Hour
+	week  = 7 * day
+	month = 30 * day
+	year  = 365 * day
+)
+
+// Duration is a config duration. It is written as a Go duration ("2160h"), a
+// number of days or weeks ("90d", "12w"), or an ISO-8601 duration ("P3M",
+// "P1DT12H"). For ISO-8601 durations, a month is 30 days and a year is 365
+// days.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) String() string {
+	return formatDuration(d.Duration)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(formatDuration(d.Duration))
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %v", err)
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+var (
+	dayWeekRegexp = regexp.MustCompile(`^(\d+)([dw])$`)
+	iso8601Regexp = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+)
+
+// ParseDuration parses a Go, day/week or ISO-8601 duration.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if m := dayWeekRegexp.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %v", s, err)
+		}
+		if m[2] == "w" {
+			return time.Duration(n) * week, nil
+		}
+		return time.Duration(n) * day, nil
+	}
+	if m := iso8601Regexp.FindStringSubmatch(s); m != nil && s != "P" && !strings.HasSuffix(s, "T") {
+		units := []time.Duration{year, month, week, day, time.Hour, time.Minute, time.Second}
+		var d time.Duration
+		for i, unit := range units {
+			if m[i+1] == "" {
+				continue
+			}
+			n, err := strconv.Atoi(m[i+1])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %v", s, err)
+			}
+			d += time.Duration(n) * unit
+		}
+		return d, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: expected a Go duration (2160h), days or weeks (90d, 12w) or an ISO-8601 duration (P3M)", s)
+	}
+	return d, nil
+}
+
+// formatDuration formats a duration in whole days where possible, and as a Go
+// duration otherwise.
+func formatDuration(d time.Duration) string {
+	if d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+// describeDuration formats a duration for humans, e.g. "90 days".
+func describeDuration(d time.Duration) string {
+	if d%day == 0 {
+		if d == day {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * day
+}
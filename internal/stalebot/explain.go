@@ -0,0 +1,44 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Explanation describes the operation stalebot would perform on an issue and
+// why.
+type Explanation struct {
+	Key       string
+	Operation Operation
+	Reason    string
+}
+
+// Explain fetches the issues with the given keys and explains the operation
+// that would be performed on each of them, without performing it.
+func (bot *Stalebot) Explain(ctx context.Context, keys []string) ([]Explanation, error) {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+
+	if err := bot.identify(ctx); err != nil {
+		return nil, err
+	}
+	issues, err := bot.searchAll(ctx, fmt.Sprintf("key in (%s)", strings.Join(keys, ",")), bot.Config.SearchFields())
+	if err != nil {
+		return nil, fmt.Errorf("fetch issues: %v", err)
+	}
+	relatives, err := bot.fetchRelatives(ctx, issues)
+	if err != nil {
+		return nil, fmt.Errorf("fetch related issues: %v", err)
+	}
+
+	now := time.Now()
+	explanations := make([]Explanation, 0, len(issues))
+	for i := range issues {
+		op, reason := bot.Config.ExplainIssueOperation(now, &issues[i], relatives[issues[i].Key])
+		explanations = append(explanations, Explanation{Key: issues[i].Key, Operation: op, Reason: reason})
+	}
+	return explanations, nil
+}
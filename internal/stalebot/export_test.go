@@ -0,0 +1,17 @@
+package stalebot
+
+import (
+	"context"
+	"io"
+)
+
+// ReviewOperations exposes reviewOperations to tests in package stalebot_test.
+var ReviewOperations = reviewOperations
+
+// RunReviewTUI exposes runReviewTUI to tests in package stalebot_test.
+var RunReviewTUI = runReviewTUI
+
+// ExecuteReviewed exposes executeReviewed to tests in package stalebot_test.
+func (bot *Stalebot) ExecuteReviewed(ctx context.Context, out io.Writer, selected []PlannedOperation) error {
+	return bot.executeReviewed(ctx, out, selected)
+}
@@ -0,0 +1,75 @@
+package stalebot
+
+import (
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// addsLabel returns true if the changelog history adds label to the issue.
+func addsLabel(h jira.ChangelogHistory, label string) bool {
+	for _, item := range h.Items {
+		if item.Field == "labels" {
+			from := sets.NewString(strings.Split(item.FromString, " ")...)
+			to := sets.NewString(strings.Split(item.ToString, " ")...)
+			if !from.Has(label) && to.Has(label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markCycles returns the number of times the issue has been marked stale.
+func (c *Config) markCycles(i *jira.Issue) int {
+	cycles := 0
+	if i.Changelog == nil {
+		return cycles
+	}
+	for _, h := range i.Changelog.Histories {
+		if c.marks(h) {
+			cycles++
+		}
+	}
+	return cycles
+}
+
+// lastMarkIndex returns the index of the changelog history that most recently
+// marked the issue stale, or -1 if there is none.
+func (c *Config) lastMarkIndex(i *jira.Issue) int {
+	if i.Changelog == nil {
+		return -1
+	}
+	for idx := len(i.Changelog.Histories) - 1; idx >= 0; idx-- {
+		if c.marks(i.Changelog.Histories[idx]) {
+			return idx
+		}
+	}
+	return -1
+}
+
+// humanActionsSince returns the number of distinct people other than stalebot
+// and the bot accounts who changed or commented on the issue after the
+// changelog history at index idx.
+func (c *Config) humanActionsSince(i *jira.Issue, idx int) int {
+	histories := i.Changelog.Histories
+	bots := c.botAccounts()
+
+	humans := sets.NewString()
+	for _, h := range histories[idx+1:] {
+		if !bots.Has(h.Author.Name) {
+			humans.Insert(h.Author.Name)
+		}
+	}
+	since, err := histories[idx].CreatedTime()
+	if err != nil || i.Fields.Comments == nil {
+		return humans.Len()
+	}
+	for _, comment := range i.Fields.Comments.Comments {
+		if isHumanComment(comment, bots) && commentTime(comment).After(since) {
+			humans.Insert(comment.Author.Name)
+		}
+	}
+	return humans.Len()
+}
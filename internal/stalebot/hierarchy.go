@@ -0,0 +1,241 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	epicIssueType = "Epic"
+
+	// relativesBatchSize is the number of issue keys included in a single
+	// JQL query when fetching the relatives of a chunk of issues.
+	relativesBatchSize = 100
+)
+
+// Relatives holds the issues related to an issue whose state affects the
+// staleness of that issue.
+type Relatives struct {
+	// Parent is the parent of a sub-task.
+	Parent *jira.Issue
+
+	// Children are the sub-tasks of an issue, or the issues in an epic.
+	Children []jira.Issue
+
+	// Linked are the issues linked to an issue by one of the configured
+	// activity link types.
+	Linked []jira.Issue
+}
+
+// childActivity returns the time of the latest activity among the children,
+// as judged by relativeActivity, or the zero time if there are none.
+func (c *Config) childActivity(r *Relatives) time.Time {
+	var latest time.Time
+	if r == nil {
+		return latest
+	}
+	for i := range r.Children {
+		if t := c.relativeActivity(&r.Children[i]); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+func (c *Config) hierarchyEnabled() bool {
+	return c.ChildActivity || c.SubtasksInheritParent || c.CascadeClose
+}
+
+func (c *Config) hierarchyFields() []string {
+	if !c.hierarchyEnabled() {
+		return nil
+	}
+	fields := []string{"parent", "subtasks"}
+	if c.EpicLinkField != "" {
+		fields = append(fields, c.EpicLinkField)
+	}
+	return fields
+}
+
+func isEpic(i *jira.Issue) bool {
+	return i.Fields.Type.Name == epicIssueType
+}
+
+func isSubtask(i *jira.Issue) bool {
+	return i.Fields.Type.Subtask && i.Fields.Parent != nil
+}
+
+func hasLabel(i *jira.Issue, label string) bool {
+	for _, l := range i.Fields.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchRelatives looks up the parents and children of issues in batches, and
+// returns the relatives of each issue keyed by issue key.
+func (bot *Stalebot) fetchRelatives(ctx context.Context, issues []jira.Issue) (map[string]*Relatives, error) {
+	rels := map[string]*Relatives{}
+	if !bot.Config.hierarchyEnabled() && len(bot.Config.ActivityLinkTypes) == 0 {
+		return rels, nil
+	}
+	relativesFor := func(key string) *Relatives {
+		if _, ok := rels[key]; !ok {
+			rels[key] = &Relatives{}
+		}
+		return rels[key]
+	}
+
+	var parentKeys, subtaskParentKeys, epicKeys []string
+	childrenOf := map[string][]string{}
+	linkedKeys := []string{}
+	linkedFrom := map[string][]string{}
+	for i := range issues {
+		issue := &issues[i]
+		for _, key := range linkedIssueKeys(issue, bot.Config.ActivityLinkTypes) {
+			linkedKeys = append(linkedKeys, key)
+			linkedFrom[key] = append(linkedFrom[key], issue.Key)
+		}
+		if bot.Config.SubtasksInheritParent && isSubtask(issue) {
+			parentKeys = append(parentKeys, issue.Fields.Parent.Key)
+			childrenOf[issue.Fields.Parent.Key] = append(childrenOf[issue.Fields.Parent.Key], issue.Key)
+		}
+		if bot.Config.ChildActivity || bot.Config.CascadeClose {
+			if isEpic(issue) && bot.Config.EpicLinkField != "" {
+				epicKeys = append(epicKeys, issue.Key)
+			} else if len(issue.Fields.Subtasks) > 0 {
+				subtaskParentKeys = append(subtaskParentKeys, issue.Key)
+			}
+		}
+	}
+
+	fields := bot.Config.SearchFields()
+	for _, batch := range batchKeys(parentKeys) {
+		parents, err := bot.searchAll(ctx, fmt.Sprintf("key in (%s)", strings.Join(batch, ",")), fields)
+		if err != nil {
+			return nil, fmt.Errorf("fetch parent issues: %v", err)
+		}
+		for j := range parents {
+			for _, child := range childrenOf[parents[j].Key] {
+				relativesFor(child).Parent = &parents[j]
+			}
+		}
+	}
+	for _, batch := range batchKeys(subtaskParentKeys) {
+		children, err := bot.searchAll(ctx, fmt.Sprintf("parent in (%s)", strings.Join(batch, ",")), fields)
+		if err != nil {
+			return nil, fmt.Errorf("fetch sub-tasks: %v", err)
+		}
+		for _, child := range children {
+			if child.Fields.Parent == nil {
+				continue
+			}
+			r := relativesFor(child.Fields.Parent.Key)
+			r.Children = append(r.Children, child)
+		}
+	}
+	for _, batch := range batchKeys(epicKeys) {
+		jql := fmt.Sprintf("%s in (%s)", jqlFieldName(bot.Config.EpicLinkField), strings.Join(batch, ","))
+		children, err := bot.searchAll(ctx, jql, fields)
+		if err != nil {
+			return nil, fmt.Errorf("fetch epic children: %v", err)
+		}
+		for _, child := range children {
+			epicKey, ok := child.Fields.Unknowns[bot.Config.EpicLinkField].(string)
+			if !ok {
+				continue
+			}
+			r := relativesFor(epicKey)
+			r.Children = append(r.Children, child)
+		}
+	}
+	for _, batch := range batchKeys(linkedKeys) {
+		linkedFields := append([]string{"key", "status", "updated"}, bot.Config.activityFields()...)
+		linked, err := bot.searchAll(ctx, fmt.Sprintf("key in (%s)", strings.Join(batch, ",")), linkedFields)
+		if err != nil {
+			return nil, fmt.Errorf("fetch linked issues: %v", err)
+		}
+		for _, l := range linked {
+			for _, from := range linkedFrom[l.Key] {
+				r := relativesFor(from)
+				r.Linked = append(r.Linked, l)
+			}
+		}
+	}
+	return rels, nil
+}
+
+// cascadeClose closes the stale, unresolved children of a closed issue. The
+// closes are confirmed and performed like the planned operations.
+func (bot *Stalebot) cascadeClose(ctx context.Context, issue *jira.Issue, rel *Relatives) error {
+	if !bot.Config.CascadeClose || rel == nil {
+		return nil
+	}
+	var pending []PlannedOperation
+	for _, child := range rel.Children {
+		if child.Fields.Status.StatusCategory.Key == jira.StatusCategoryComplete || !bot.Config.isMarked(&child, time.Now()) {
+			continue
+		}
+		pending = append(pending, PlannedOperation{Issue: child, Operation: Close, Reason: cascadeReason(issue)})
+	}
+	if err := bot.performPending(ctx, pending); err != nil {
+		return fmt.Errorf("cascade close to child issues of %q: %v", issue.Key, err)
+	}
+	return nil
+}
+
+func cascadeReason(parent *jira.Issue) string {
+	return fmt.Sprintf("parent issue %s was closed", parent.Key)
+}
+
+// searchAll returns all issues matching jql, following pagination.
+func (bot *Stalebot) searchAll(ctx context.Context, jql string, fields []string) ([]jira.Issue, error) {
+	var issues []jira.Issue
+	last := 0
+	for {
+		opt := &jira.SearchOptions{
+			MaxResults: 1000,
+			StartAt:    last,
+			Fields:     fields,
+			Expand:     "changelog",
+		}
+		chunk, resp, err := bot.Client.Issue.Search(ctx, jql, opt)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, chunk...)
+		last = resp.StartAt + len(chunk)
+		if len(chunk) == 0 || last >= resp.Total {
+			return issues, nil
+		}
+	}
+}
+
+func batchKeys(keys []string) [][]string {
+	var batches [][]string
+	keys = sets.NewString(keys...).List()
+	for len(keys) > relativesBatchSize {
+		batches = append(batches, keys[:relativesBatchSize])
+		keys = keys[relativesBatchSize:]
+	}
+	if len(keys) > 0 {
+		batches = append(batches, keys)
+	}
+	return batches
+}
+
+// jqlFieldName converts a custom field ID (e.g. "customfield_12311140") to the
+// form JQL expects (e.g. "cf[12311140]").
+func jqlFieldName(field string) string {
+	if id := strings.TrimPrefix(field, "customfield_"); id != field {
+		return fmt.Sprintf("cf[%s]", id)
+	}
+	return field
+}
@@ -0,0 +1,77 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// currentStateFields returns the fields fetched to check the current state of
+// an issue before an operation is performed, including the fields the mark
+// and close actions are computed from.
+func (c *Config) currentStateFields() []string {
+	fields := []string{"comment", "issuelinks", "labels", "status"}
+	fields = append(fields, fieldsFor(c.MarkActions)...)
+	fields = append(fields, fieldsFor(c.CloseActions)...)
+	return sets.NewString(fields...).List()
+}
+
+// currentIssue fetches the current state of an issue. Operations are planned
+// from search results that may be stale by the time they are performed, and
+// a previous run may have partially performed the same operation.
+func (bot *Stalebot) currentIssue(ctx context.Context, issue *jira.Issue) (*jira.Issue, error) {
+	current, resp, err := bot.Client.Issue.Get(ctx, issue.ID, &jira.GetQueryOptions{Fields: strings.Join(bot.Config.currentStateFields(), ",")})
+	if err != nil {
+		return nil, fmt.Errorf("get current state of issue: %v", jira.NewJiraError(resp, err))
+	}
+	return current, nil
+}
+
+// commentMarkerPrefix starts all comment markers.
+const commentMarkerPrefix = "{anchor:jira-stalebot-"
+
+// commentMarker returns a hidden marker identifying the comment of an
+// operation in a stale cycle. Jira renders anchors invisibly.
+func commentMarker(op Operation, cycle int) string {
+	return fmt.Sprintf("%s%s-%d}", commentMarkerPrefix, strings.ToLower(string(op)), cycle)
+}
+
+// withMarker appends a comment marker to a comment body.
+func withMarker(body, marker string) string {
+	return body + "\n" + marker
+}
+
+// markedComment returns the issue's comment containing marker, or nil if
+// there is none.
+func markedComment(issue *jira.Issue, marker string) *jira.Comment {
+	if issue.Fields == nil || issue.Fields.Comments == nil {
+		return nil
+	}
+	for _, c := range issue.Fields.Comments.Comments {
+		if c != nil && strings.Contains(c.Body, marker) {
+			return c
+		}
+	}
+	return nil
+}
+
+// isClosed returns true if the close step of the close strategy has already
+// been performed on the issue.
+func (c *Config) isClosed(issue *jira.Issue) bool {
+	if c.CloseStrategy == ArchiveStrategy {
+		return hasLabel(issue, c.ArchiveLabel)
+	}
+	return issue.Fields.Status != nil && issue.Fields.Status.StatusCategory.Key == jira.StatusCategoryComplete
+}
+
+// pendingComment returns body with marker, or an empty string if the issue
+// already has a comment with marker.
+func pendingComment(current *jira.Issue, body, marker string) string {
+	if markedComment(current, marker) != nil {
+		return ""
+	}
+	return withMarker(body, marker)
+}
@@ -0,0 +1,242 @@
+package stalebot_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Idempotent operations", func() {
+	const (
+		jiraTime   = "2006-01-02T15:04:05.000-0700"
+		staleLabel = "lifecycle-stale"
+	)
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		// planned is the issue as found by the search that plans the
+		// operations, and current is its state when they are performed.
+		planned map[string]interface{}
+		current map[string]interface{}
+	)
+	daysAgo := func(days int) time.Time { return time.Now().Add(-time.Duration(days) * day) }
+	labelChange := func(author string, at time.Time, from, to string) map[string]interface{} {
+		return map[string]interface{}{
+			"author":  map[string]interface{}{"name": author},
+			"created": at.Format(jiraTime),
+			"items":   []interface{}{map[string]interface{}{"field": "labels", "fromString": from, "toString": to}},
+		}
+	}
+	// plan sets the issue found by the search.
+	plan := func(updated time.Time, labels []string, histories ...interface{}) {
+		planned["fields"].(map[string]interface{})["updated"] = updated.Format(jiraTime)
+		planned["fields"].(map[string]interface{})["labels"] = labels
+		planned["changelog"] = map[string]interface{}{"histories": histories}
+	}
+	fields := func() map[string]interface{} { return current["fields"].(map[string]interface{}) }
+	withComment := func(body string) {
+		fields()["comment"] = map[string]interface{}{"comments": []interface{}{map[string]interface{}{"id": "10", "body": body}}}
+	}
+	// calls returns the method and path of the requests that modify issues.
+	calls := func() []string {
+		var out []string
+		for _, r := range fake.Requests() {
+			if r.Method != http.MethodGet {
+				out = append(out, r.Method+" "+r.Path)
+			}
+		}
+		return out
+	}
+	// commentBodies returns the bodies of the comments posted on their own or
+	// with issue updates.
+	commentBodies := func() []string {
+		var out []string
+		for _, r := range fake.Requests() {
+			switch {
+			case r.Method == http.MethodPost && strings.HasSuffix(r.Path, "/comment"):
+				out = append(out, r.Body["body"].(string))
+			case r.Method == http.MethodPut || strings.HasSuffix(r.Path, "/transitions"):
+				upd, _ := r.Body["update"].(map[string]interface{})
+				comments, _ := upd["comment"].([]interface{})
+				for _, c := range comments {
+					out = append(out, c.(map[string]interface{})["add"].(map[string]interface{})["body"].(string))
+				}
+			}
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:   fake.URL,
+				Project:       "TEST",
+				CloseStatus:   "Closed",
+				CloseStrategy: stalebot.TransitionStrategy,
+				StaleLabel:    staleLabel,
+				StaleAfter:    &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:    &stalebot.Duration{Duration: 10 * day},
+				ExemptLabels:  []string{"lifecycle-frozen"},
+				MarkComment:   "This issue is stale.",
+				UnmarkComment: "No longer stale.",
+				CloseComment:  "Closing.",
+			},
+			Logger: logr.Discard(),
+		}
+
+		planned = map[string]interface{}{
+			"id":  "TEST-1",
+			"key": "TEST-1",
+			"fields": map[string]interface{}{
+				"status": map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+		}
+		current = map[string]interface{}{
+			"id":  "TEST-1",
+			"key": "TEST-1",
+			"fields": map[string]interface{}{
+				"labels": []string{},
+				"status": map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+		}
+		fake.Issues = append(fake.Issues, planned)
+		fake.Handlers["GET /rest/api/2/issue/TEST-1"] = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(current)
+		}
+		fake.Handlers["GET /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"transitions": [{"id": "2", "name": "Close", "to": {"name": "Closed"}}]}`))
+		}
+	})
+
+	Context("marking", func() {
+		BeforeEach(func() {
+			plan(daysAgo(40), []string{})
+		})
+		It("posts a marked comment with the label update", func() {
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"PUT /rest/api/2/issue/TEST-1"}))
+			Expect(commentBodies()).To(ConsistOf(HaveSuffix("\n{anchor:jira-stalebot-addstalelabel-1}")))
+		})
+		It("does not post the comment again after a failed label update", func() {
+			withComment("This issue is stale.\n{anchor:jira-stalebot-addstalelabel-1}")
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"PUT /rest/api/2/issue/TEST-1"}))
+			Expect(commentBodies()).To(BeEmpty())
+		})
+		It("posts a new comment in a new stale cycle", func() {
+			withComment("This issue is stale.\n{anchor:jira-stalebot-addstalelabel-1}")
+			plan(daysAgo(40), []string{},
+				labelChange("stalebot", daysAgo(100), "", staleLabel),
+				labelChange("jdoe", daysAgo(90), staleLabel, ""),
+			)
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(commentBodies()).To(ConsistOf(HaveSuffix("\n{anchor:jira-stalebot-addstalelabel-2}")))
+		})
+		It("does nothing if the issue is already marked", func() {
+			fields()["labels"] = []string{staleLabel}
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(BeEmpty())
+		})
+	})
+
+	Context("unmarking", func() {
+		BeforeEach(func() {
+			plan(daysAgo(1), []string{staleLabel}, labelChange("stalebot", daysAgo(5), "", staleLabel))
+			fields()["labels"] = []string{staleLabel}
+		})
+		It("posts a marked comment with the label update", func() {
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"PUT /rest/api/2/issue/TEST-1"}))
+			Expect(commentBodies()).To(ConsistOf(HaveSuffix("\n{anchor:jira-stalebot-removestalelabel-1}")))
+		})
+		It("does not post the comment again after a failed label update", func() {
+			withComment("No longer stale.\n{anchor:jira-stalebot-removestalelabel-1}")
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"PUT /rest/api/2/issue/TEST-1"}))
+			Expect(commentBodies()).To(BeEmpty())
+		})
+		It("does nothing if the issue is already unmarked", func() {
+			fields()["labels"] = []string{}
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(BeEmpty())
+		})
+	})
+
+	Context("closing", func() {
+		BeforeEach(func() {
+			plan(daysAgo(40), []string{staleLabel}, labelChange("stalebot", daysAgo(40), "", staleLabel))
+			fields()["labels"] = []string{staleLabel}
+		})
+		It("posts a marked comment with the transition", func() {
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+			Expect(commentBodies()).To(ConsistOf(HaveSuffix("\n{anchor:jira-stalebot-close-1}")))
+		})
+		It("closes the issue again on the next run after a failed transition", func() {
+			// The transition takes no comment, and fails without one.
+			fake.Handlers["POST /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"comment"`) {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors": {"comment": "Field 'comment' cannot be set. It is not on the appropriate screen, or unknown."}}`))
+					return
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"errorMessages": ["boom"]}`))
+			}
+			Expect(bot.Run(context.Background())).To(MatchError(ContainSubstring(`transition to status "Closed"`)))
+			// No comment was left behind, whose updated time would look like
+			// activity to the next run.
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions", "POST /rest/api/2/issue/TEST-1/transitions"}))
+			next, err := bot.Plan(context.Background(), time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(next).To(HaveLen(1))
+			Expect(next[0].Operation).To(Equal(stalebot.Close))
+		})
+		It("only transitions if the comment was already posted", func() {
+			withComment("Closing.\n{anchor:jira-stalebot-close-1}")
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+			Expect(commentBodies()).To(BeEmpty())
+		})
+		It("does nothing if the issue is already closed", func() {
+			fields()["status"] = map[string]interface{}{"name": "Closed", "statusCategory": map[string]interface{}{"key": "done"}}
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(BeEmpty())
+		})
+		It("does nothing if the issue is already archived", func() {
+			bot.Config.CloseStrategy = stalebot.ArchiveStrategy
+			bot.Config.ArchiveLabel = "archived"
+			fields()["labels"] = []string{staleLabel, "archived"}
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(BeEmpty())
+		})
+		It("reuses an existing clone when moving", func() {
+			bot.Config.CloseStrategy = stalebot.MoveStrategy
+			bot.Config.MoveProject = "ARCHIVE"
+			bot.Config.MoveLinkType = "Cloners"
+			fields()["issuelinks"] = []interface{}{map[string]interface{}{
+				"type":         map[string]interface{}{"name": "Cloners"},
+				"outwardIssue": map[string]interface{}{"key": "ARCHIVE-7"},
+			}}
+			Expect(bot.Run(context.Background())).To(Succeed())
+			Expect(calls()).To(Equal([]string{"POST /rest/api/2/issue/TEST-1/transitions"}))
+			Expect(commentBodies()).To(ConsistOf(ContainSubstring("This issue has been moved to ARCHIVE-7.")))
+		})
+	})
+})
@@ -0,0 +1,199 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// MigrateLabel replaces the previous stale label of an issue with the current
+// one. It is only performed by MigrateLabels.
+const MigrateLabel Operation = "MigrateLabel"
+
+// LabelMigration describes a change of the stale label. During its transition
+// window, issues with either label are stale. The changelog history of
+// replacing one label with the other never counts as marking the issue or as
+// activity, so issues keep their staleness across the migration, even when it
+// is evaluated after the window ends.
+type LabelMigration struct {
+	// From is the previous stale label.
+	From string `json:"from"`
+	// Until is the date (YYYY-MM-DD, UTC) the transition window ends.
+	Until string `json:"until"`
+}
+
+func (m *LabelMigration) validate(staleLabel string) error {
+	var errs []error
+	if !isValidLabel(m.From) {
+		errs = append(errs, fmt.Errorf("from label %q is invalid", m.From))
+	} else if m.From == staleLabel {
+		errs = append(errs, fmt.Errorf("from label must differ from staleLabel"))
+	}
+	if _, err := time.Parse(dateLayout, m.Until); err != nil {
+		errs = append(errs, fmt.Errorf("until must be a date of the form YYYY-MM-DD: %v", err))
+	}
+	return newAggregateError(errs)
+}
+
+const dateLayout = "2006-01-02"
+
+// staleLabels returns the labels that mark issues stale at the given time:
+// the stale label, and the previous stale label during a label migration.
+func (c *Config) staleLabels(now time.Time) []string {
+	if m := c.LabelMigration; m != nil {
+		if until, err := time.Parse(dateLayout, m.Until); err == nil && now.Before(until) {
+			return []string{c.StaleLabel, m.From}
+		}
+	}
+	return []string{c.StaleLabel}
+}
+
+// isMarked returns true if the issue has any of the stale labels at the given
+// time.
+func (c *Config) isMarked(i *jira.Issue, now time.Time) bool {
+	return sets.NewString(i.Fields.Labels...).HasAny(c.staleLabels(now)...)
+}
+
+// migrationLabels returns the stale label and, if the config has a label
+// migration, its previous stale label, regardless of the transition window.
+func (c *Config) migrationLabels() []string {
+	if m := c.LabelMigration; m != nil {
+		return []string{c.StaleLabel, m.From}
+	}
+	return []string{c.StaleLabel}
+}
+
+// isLabelMigration returns true if a changelog history removed one of the
+// migration labels while leaving the issue with another, whether it added the
+// other label in the same history or the issue already had it. Migrations stay
+// recognised after the transition window ends, so they never count as marks or
+// activity.
+func (c *Config) isLabelMigration(h jira.ChangelogHistory) bool {
+	labels := c.migrationLabels()
+	for _, item := range h.Items {
+		if item.Field == "labels" {
+			from := sets.NewString(strings.Fields(item.FromString)...)
+			to := sets.NewString(strings.Fields(item.ToString)...)
+			if from.Difference(to).HasAny(labels...) && to.HasAny(labels...) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// marks returns true if a changelog history marked the issue stale, i.e. it
+// added one of the migration labels other than by a label migration. Marks
+// with the previous stale label still count after the transition window, so
+// that migrated issues keep the time they were marked and their cycles.
+func (c *Config) marks(h jira.ChangelogHistory) bool {
+	if c.isLabelMigration(h) {
+		return false
+	}
+	for _, l := range c.migrationLabels() {
+		if addsLabel(h, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateLabels replaces LabelMigration.From with StaleLabel on all open
+// issues. Each issue is migrated in a single update, which the transition
+// window recognises as a label migration. Operations are confirmed and
+// performed like those of a run, and are logged only in dry-run mode.
+//
+// The returned report is non-nil even if an operation fails.
+func (bot *Stalebot) MigrateLabels(ctx context.Context, now time.Time) (_ *RunReport, migrateErr error) {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+	if err := bot.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid stalebot config: %v", err)
+	}
+	m := bot.Config.LabelMigration
+	if m == nil {
+		return nil, fmt.Errorf("config has no labelMigration section")
+	}
+	if len(bot.Config.staleLabels(now)) == 1 {
+		return nil, fmt.Errorf("the transition window of the label migration ended on %s", m.Until)
+	}
+
+	ctx, span := startSpan(ctx, "MigrateLabels", attrProject.String(bot.Config.Project), attrDryRun.Bool(bot.DryRun))
+	defer func() { endSpan(span, migrateErr) }()
+
+	bot.runID = now.UTC().Format(time.RFC3339)
+	bot.report = &RunReport{
+		RunID:      bot.runID,
+		Project:    bot.Config.Project,
+		Start:      now,
+		DryRun:     bot.DryRun,
+		Operations: map[Operation]int{},
+	}
+	defer func() {
+		bot.report = nil
+		if bot.Store != nil {
+			if err := bot.Store.Save(); err != nil {
+				bot.Logger.Error(err, "save state store")
+			}
+		}
+	}()
+	report := bot.report
+
+	jql := completeQuery([]string{
+		fmt.Sprintf("project = %s", bot.Config.Project),
+		"statusCategory != Done",
+		fmt.Sprintf("labels = %s", m.From),
+	})
+	issues, err := bot.searchAll(ctx, jql, []string{"key", "issuetype", "summary", "labels", "status", "updated"})
+	if err != nil {
+		return report, fmt.Errorf("search for issues with label %q: %v", m.From, err)
+	}
+	report.Processed = len(issues)
+	pending := make([]PlannedOperation, 0, len(issues))
+	for _, issue := range issues {
+		pending = append(pending, PlannedOperation{
+			Issue:     issue,
+			Operation: MigrateLabel,
+			Reason:    fmt.Sprintf("issue has label %q", m.From),
+		})
+	}
+	bot.Logger.Info("found issues to migrate", "count", len(pending), "from", m.From, "to", bot.Config.StaleLabel)
+
+	if bot.Prompt {
+		bot.prompter = newPrompter(os.Stdin, os.Stdout, bot.Config.JiraBaseURL, now)
+	}
+	err = bot.performPending(ctx, pending)
+	report.End = time.Now()
+	report.Duration = report.End.Sub(now)
+	return report, err
+}
+
+// migrateLabel replaces the previous stale label of an issue with the stale
+// label in a single update. It does nothing if a previous attempt already
+// removed the previous label.
+func (bot *Stalebot) migrateLabel(ctx context.Context, issue *jira.Issue) error {
+	current, err := bot.currentIssue(ctx, issue)
+	if err != nil {
+		return err
+	}
+	from := bot.Config.LabelMigration.From
+	if !hasLabel(current, from) {
+		bot.Logger.Info("issue is already migrated", "key", issue.Key)
+		return nil
+	}
+	upd := update{Labels: []labels{{Remove: from}}}
+	if !hasLabel(current, bot.Config.StaleLabel) {
+		upd.Labels = append(upd.Labels, labels{Add: bot.Config.StaleLabel})
+	}
+	resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, map[string]interface{}{"update": upd})
+	if err != nil {
+		return fmt.Errorf("replace label %q with %q: %v", from, bot.Config.StaleLabel, jira.NewJiraError(resp, err))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package stalebot_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Label migration", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		now  = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	)
+	issue := func(key string, labels ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":  key,
+			"key": key,
+			"fields": map[string]interface{}{
+				"issuetype": map[string]interface{}{"name": "Bug"},
+				"labels":    labels,
+				"status":    map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+		}
+	}
+	// updates returns the label updates of the requests that modify issues,
+	// keyed by path.
+	updates := func() map[string]interface{} {
+		out := map[string]interface{}{}
+		for _, r := range fake.Requests() {
+			if r.Method == http.MethodPut {
+				out[r.Path] = r.Body["update"].(map[string]interface{})["labels"]
+			}
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		fake.Issues = append(fake.Issues,
+			issue("TEST-1", "lifecycle-stale"),
+			issue("TEST-2", "lifecycle-stale", "stale"),
+			issue("TEST-3", "stale"),
+		)
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:    fake.URL,
+				Project:        "TEST",
+				CloseStatus:    "Closed",
+				StaleLabel:     "stale",
+				StaleAfter:     &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:     &stalebot.Duration{Duration: 10 * day},
+				ExemptLabels:   []string{"lifecycle-frozen"},
+				LabelMigration: &stalebot.LabelMigration{From: "lifecycle-stale", Until: "2100-01-01"},
+			},
+			Logger: logr.Discard(),
+		}
+	})
+
+	It("replaces the previous label in a single update", func() {
+		report, err := bot.MigrateLabels(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updates()).To(Equal(map[string]interface{}{
+			"/rest/api/2/issue/TEST-1": []interface{}{
+				map[string]interface{}{"remove": "lifecycle-stale"},
+				map[string]interface{}{"add": "stale"},
+			},
+			"/rest/api/2/issue/TEST-2": []interface{}{
+				map[string]interface{}{"remove": "lifecycle-stale"},
+			},
+		}))
+		Expect(report.Failures).To(BeEmpty())
+	})
+
+	It("only reports the migration in dry-run mode", func() {
+		bot.DryRun = true
+		report, err := bot.MigrateLabels(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updates()).To(BeEmpty())
+		Expect(report.Processed).To(Equal(3))
+	})
+
+	It("refuses to migrate after the transition window", func() {
+		bot.Config.LabelMigration.Until = "1999-12-01"
+		_, err := bot.MigrateLabels(context.Background(), now)
+		Expect(err).To(MatchError(ContainSubstring("transition window")))
+	})
+
+	It("removes the previous label when unmarking during the transition window", func() {
+		marked := issue("TEST-1", "lifecycle-stale")
+		marked["fields"].(map[string]interface{})["updated"] = time.Now().Add(-day).Format(jiraTime)
+		marked["changelog"] = map[string]interface{}{"histories": []interface{}{map[string]interface{}{
+			"author":  map[string]interface{}{"name": "stalebot"},
+			"created": time.Now().Add(-5 * day).Format(jiraTime),
+			"items":   []interface{}{map[string]interface{}{"field": "labels", "toString": "lifecycle-stale"}},
+		}}}
+		fake.Issues = []map[string]interface{}{marked}
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(updates()).To(HaveKeyWithValue("/rest/api/2/issue/TEST-1", ConsistOf(
+			map[string]interface{}{"remove": "lifecycle-stale"},
+		)))
+	})
+
+	It("rejects a migration from the stale label", func() {
+		bot.Config.LabelMigration.From = "stale"
+		Expect(bot.Config.Validate()).To(MatchError(ContainSubstring("from label must differ from staleLabel")))
+	})
+})
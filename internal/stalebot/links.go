@@ -0,0 +1,58 @@
+package stalebot
+
+import (
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+// linkedIssueKeys returns the keys of the issues linked to i by any of the
+// given link types. A link type matches either by name (e.g. "Blocks") or by
+// the relation it describes from i's point of view (e.g. "is blocked by").
+func linkedIssueKeys(i *jira.Issue, linkTypes []string) []string {
+	var keys []string
+	if len(linkTypes) == 0 {
+		return keys
+	}
+	for _, link := range i.Fields.IssueLinks {
+		if link == nil {
+			continue
+		}
+		switch {
+		case link.OutwardIssue != nil && linkTypeMatches(linkTypes, link.Type.Name, link.Type.Outward):
+			keys = append(keys, link.OutwardIssue.Key)
+		case link.InwardIssue != nil && linkTypeMatches(linkTypes, link.Type.Name, link.Type.Inward):
+			keys = append(keys, link.InwardIssue.Key)
+		}
+	}
+	return keys
+}
+
+func linkTypeMatches(linkTypes []string, name, relation string) bool {
+	for _, lt := range linkTypes {
+		if strings.EqualFold(lt, name) || strings.EqualFold(lt, relation) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeLinkedIssue returns the first linked issue that is unresolved and was
+// active after activeSince, as judged by relativeActivity, or nil if there is
+// none.
+func (c *Config) activeLinkedIssue(r *Relatives, activeSince time.Time) *jira.Issue {
+	if r == nil {
+		return nil
+	}
+	for i := range r.Linked {
+		linked := &r.Linked[i]
+		if linked.Fields.Status != nil && linked.Fields.Status.StatusCategory.Key == jira.StatusCategoryComplete {
+			continue
+		}
+		if c.relativeActivity(linked).After(activeSince) {
+			return linked
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package stalebot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+type NotifierType string
+
+const (
+	// SMTPNotifier sends messages as plain text email.
+	SMTPNotifier NotifierType = "smtp"
+	// WebhookNotifier posts messages to an incoming webhook, formatted as
+	// configured by the notifier's Format.
+	WebhookNotifier NotifierType = "webhook"
+	// FileNotifier writes messages to a file.
+	FileNotifier NotifierType = "file"
+)
+
+type WebhookFormat string
+
+const (
+	// SlackFormat posts {"text": "..."}, with the subject in bold. It is
+	// also understood by most Slack compatible webhooks.
+	SlackFormat WebhookFormat = "slack"
+	// MattermostFormat posts {"text": "..."}, with the subject as a heading.
+	MattermostFormat WebhookFormat = "mattermost"
+	// TeamsFormat posts a Microsoft Teams message card.
+	TeamsFormat WebhookFormat = "teams"
+	// JSONFormat posts {"subject": "...", "text": "...", "data": {...}},
+	// where data is the data the message was rendered from.
+	JSONFormat WebhookFormat = "json"
+)
+
+// NotifierConfig configures the delivery of notification messages.
+type NotifierConfig struct {
+	Type NotifierType `json:"type"`
+
+	// SMTPAddress is the host:port of the SMTP server. If Username is set, the
+	// server must support PLAIN authentication over TLS, or be localhost.
+	SMTPAddress string `json:"smtpAddress,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	// From and To are the sender and the recipients of email messages.
+	From string   `json:"from,omitempty"`
+	To   []string `json:"to,omitempty"`
+
+	// URL is the incoming webhook URL, and Format the format of the posted
+	// JSON. Format defaults to slack.
+	URL    string        `json:"url,omitempty"`
+	Format WebhookFormat `json:"format,omitempty"`
+
+	// Path is the file messages are written to. The file is overwritten,
+	// unless Append is set.
+	Path   string `json:"path,omitempty"`
+	Append bool   `json:"append,omitempty"`
+}
+
+func (c NotifierConfig) validate() error {
+	switch c.Type {
+	case SMTPNotifier:
+		if c.SMTPAddress == "" || c.From == "" {
+			return fmt.Errorf("notifier %q requires an smtpAddress and a from address", c.Type)
+		}
+		if _, _, err := net.SplitHostPort(c.SMTPAddress); err != nil {
+			return fmt.Errorf("notifier %q has invalid smtpAddress: %v", c.Type, err)
+		}
+	case WebhookNotifier:
+		if c.URL == "" {
+			return fmt.Errorf("notifier %q requires a url", c.Type)
+		}
+		switch c.Format {
+		case "", SlackFormat, MattermostFormat, TeamsFormat, JSONFormat:
+		default:
+			return fmt.Errorf("notifier %q has unknown format %q", c.Type, c.Format)
+		}
+	case FileNotifier:
+		if c.Path == "" {
+			return fmt.Errorf("notifier %q requires a path", c.Type)
+		}
+	default:
+		return fmt.Errorf("unknown notifier type %q", c.Type)
+	}
+	return nil
+}
+
+// Message is a notification message. Body is Markdown.
+type Message struct {
+	Subject string
+	Body    string
+
+	// To lists additional email recipients. It is ignored by notifiers that
+	// do not send email.
+	To []string
+
+	// Data is the data the message was rendered from. It is included in
+	// webhook posts in the json format.
+	Data interface{}
+}
+
+// Notifier delivers notification messages.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// NewNotifier returns the notifier configured by c.
+func NewNotifier(c NotifierConfig) (Notifier, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case SMTPNotifier:
+		return &smtpNotifier{config: c}, nil
+	case WebhookNotifier:
+		return &webhookNotifier{config: c, client: http.DefaultClient}, nil
+	default:
+		return &fileNotifier{config: c}, nil
+	}
+}
+
+type smtpNotifier struct {
+	config NotifierConfig
+}
+
+func (n *smtpNotifier) Notify(_ context.Context, msg Message) error {
+	to := append(append([]string{}, n.config.To...), msg.To...)
+	if len(to) == 0 {
+		return fmt.Errorf("email has no recipients")
+	}
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		host, _, _ := net.SplitHostPort(n.config.SMTPAddress)
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, host)
+	}
+	if err := smtp.SendMail(n.config.SMTPAddress, auth, n.config.From, to, formatEmail(n.config.From, to, msg)); err != nil {
+		return fmt.Errorf("send email: %v", err)
+	}
+	return nil
+}
+
+func formatEmail(from string, to []string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", strings.ReplaceAll(msg.Subject, "\n", " "))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+type webhookNotifier struct {
+	config NotifierConfig
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, msg Message) error {
+	switch n.config.Format {
+	case MattermostFormat:
+		text := msg.Body
+		if msg.Subject != "" {
+			text = fmt.Sprintf("#### %s\n\n%s", msg.Subject, msg.Body)
+		}
+		return n.post(ctx, map[string]interface{}{"text": text})
+	case TeamsFormat:
+		return n.post(ctx, map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  msg.Subject,
+			"title":    msg.Subject,
+			"text":     msg.Body,
+		})
+	case JSONFormat:
+		return n.post(ctx, map[string]interface{}{"subject": msg.Subject, "text": msg.Body, "data": msg.Data})
+	default:
+		text := msg.Body
+		if msg.Subject != "" {
+			text = fmt.Sprintf("*%s*\n\n%s", msg.Subject, msg.Body)
+		}
+		return n.post(ctx, map[string]interface{}{"text": text})
+	}
+}
+
+func (n *webhookNotifier) post(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("post to webhook: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+type fileNotifier struct {
+	config NotifierConfig
+}
+
+func (n *fileNotifier) Notify(_ context.Context, msg Message) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if n.config.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(n.config.Path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	content := msg.Body
+	if msg.Subject != "" {
+		content = fmt.Sprintf("# %s\n\n%s", msg.Subject, msg.Body)
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,206 @@
+package stalebot_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+// fakeSMTPServer is a minimal SMTP server that records the envelope and data
+// of received mail.
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	from  string
+	rcpts []string
+	data  string
+	// mails holds the data of each received mail.
+	mails  []string
+	closed chan struct{}
+}
+
+func newFakeSMTPServer() *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	s := &fakeSMTPServer{listener: l, closed: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) Addr() string { return s.listener.Addr().String() }
+
+func (s *fakeSMTPServer) Close() {
+	s.listener.Close()
+	<-s.closed
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.closed)
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case cmd == "EHLO" || cmd == "HELO":
+			reply("250 localhost")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mails = append(s.mails, s.data)
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+var _ = Describe("Notifiers", func() {
+	msg := stalebot.Message{Subject: "Stale issues", Body: "- TEST-1\n- TEST-2\n", To: []string{"jdoe@example.com"}}
+
+	It("sends email", func() {
+		server := newFakeSMTPServer()
+		n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.SMTPNotifier, SMTPAddress: server.Addr(), From: "stalebot@example.com", To: []string{"team@example.com"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(context.Background(), msg)).To(Succeed())
+		server.Close()
+
+		Expect(server.from).To(Equal("stalebot@example.com"))
+		Expect(server.rcpts).To(Equal([]string{"team@example.com", "jdoe@example.com"}))
+		Expect(server.data).To(ContainSubstring("Subject: Stale issues\r\n"))
+		Expect(server.data).To(ContainSubstring("To: team@example.com, jdoe@example.com\r\n"))
+		Expect(server.data).To(ContainSubstring("\r\n\r\n- TEST-1\r\n- TEST-2\r\n"))
+	})
+	It("fails to send email without recipients", func() {
+		n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.SMTPNotifier, SMTPAddress: "127.0.0.1:25", From: "stalebot@example.com"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(context.Background(), stalebot.Message{Body: "body"})).To(MatchError(ContainSubstring("no recipients")))
+	})
+	It("posts to webhooks", func() {
+		var payload map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+		}))
+		defer server.Close()
+
+		n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.WebhookNotifier, URL: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(context.Background(), msg)).To(Succeed())
+		Expect(payload).To(Equal(map[string]interface{}{"text": "*Stale issues*\n\n- TEST-1\n- TEST-2\n"}))
+	})
+	DescribeTable("formats webhook posts",
+		func(format stalebot.WebhookFormat, expected map[string]interface{}) {
+			var payload map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(json.NewDecoder(r.Body).Decode(&payload)).To(Succeed())
+			}))
+			defer server.Close()
+
+			n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.WebhookNotifier, URL: server.URL, Format: format})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n.Notify(context.Background(), stalebot.Message{Subject: "Run", Body: "body", Data: map[string]int{"closed": 1}})).To(Succeed())
+			Expect(payload).To(Equal(expected))
+		},
+		Entry("slack", stalebot.SlackFormat, map[string]interface{}{"text": "*Run*\n\nbody"}),
+		Entry("mattermost", stalebot.MattermostFormat, map[string]interface{}{"text": "#### Run\n\nbody"}),
+		Entry("teams", stalebot.TeamsFormat, map[string]interface{}{
+			"@type": "MessageCard", "@context": "https://schema.org/extensions", "summary": "Run", "title": "Run", "text": "body",
+		}),
+		Entry("json", stalebot.JSONFormat, map[string]interface{}{"subject": "Run", "text": "body", "data": map[string]interface{}{"closed": 1.0}}),
+	)
+	It("reports webhook errors", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid_token", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.WebhookNotifier, URL: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(context.Background(), msg)).To(MatchError(ContainSubstring("403 Forbidden: invalid_token")))
+	})
+	It("writes files", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "digest.md")
+		n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.FileNotifier, Path: path})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(context.Background(), msg)).To(Succeed())
+		Expect(n.Notify(context.Background(), msg)).To(Succeed())
+		Expect(os.ReadFile(path)).To(Equal([]byte("# Stale issues\n\n- TEST-1\n- TEST-2\n")))
+	})
+	It("appends to files", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "digest.md")
+		n, err := stalebot.NewNotifier(stalebot.NotifierConfig{Type: stalebot.FileNotifier, Path: path, Append: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.Notify(context.Background(), stalebot.Message{Body: "one"})).To(Succeed())
+		Expect(n.Notify(context.Background(), stalebot.Message{Body: "two"})).To(Succeed())
+		Expect(os.ReadFile(path)).To(Equal([]byte("one\ntwo\n")))
+	})
+	DescribeTable("rejects invalid configs",
+		func(c stalebot.NotifierConfig, msg string) {
+			_, err := stalebot.NewNotifier(c)
+			Expect(err).To(MatchError(ContainSubstring(msg)))
+		},
+		Entry("unknown type", stalebot.NotifierConfig{Type: "pigeon"}, `unknown notifier type "pigeon"`),
+		Entry("smtp without from", stalebot.NotifierConfig{Type: stalebot.SMTPNotifier, SMTPAddress: "localhost:25"}, "requires an smtpAddress and a from address"),
+		Entry("smtp without port", stalebot.NotifierConfig{Type: stalebot.SMTPNotifier, SMTPAddress: "localhost", From: "a@example.com"}, "invalid smtpAddress"),
+		Entry("webhook without url", stalebot.NotifierConfig{Type: stalebot.WebhookNotifier}, "requires a url"),
+		Entry("webhook with unknown format", stalebot.NotifierConfig{Type: stalebot.WebhookNotifier, URL: "http://localhost", Format: "irc"}, `unknown format "irc"`),
+		Entry("file without path", stalebot.NotifierConfig{Type: stalebot.FileNotifier}, "requires a path"),
+	)
+})
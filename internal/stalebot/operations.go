@@ -1,7 +1,7 @@
 package stalebot
 
 import (
-	"strings"
+	"fmt"
 	"time"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
@@ -15,70 +15,183 @@ const (
 	AddStaleLabel    Operation = "AddStaleLabel"
 	RemoveStaleLabel Operation = "RemoveStaleLabel"
 	Close            Operation = "Close"
+
+	// Purge and Reopen are only performed by Purge, to uninstall stalebot
+	// from a project.
+	Purge  Operation = "Purge"
+	Reopen Operation = "Reopen"
 )
 
-func (c *Config) IssueOperation(now time.Time, i *jira.Issue) Operation {
+// IssueOperation returns the operation to perform on an issue. If the hierarchy
+// or linked issue options are enabled in the config, rel holds the related
+// issues whose state affects the issue's staleness. rel may be nil.
+func (c *Config) IssueOperation(now time.Time, i *jira.Issue, rel *Relatives) Operation {
+	op, _ := c.ExplainIssueOperation(now, i, rel)
+	return op
+}
+
+// ExplainIssueOperation returns the operation to perform on an issue, along
+// with a human-readable reason for that operation.
+func (c *Config) ExplainIssueOperation(now time.Time, i *jira.Issue, rel *Relatives) (Operation, string) {
 	// No updates to issues that are complete
 	if i.Fields.Status.StatusCategory.Key == jira.StatusCategoryComplete {
-		return None
+		return None, "issue is complete"
 	}
 
 	// Check if issue is even eligible for stale bot processing.
 	issueLabels := sets.NewString(i.Fields.Labels...)
+	staleLabels := c.staleLabels(now)
+
+	// No updates to issues that have already been archived
+	if c.CloseStrategy == ArchiveStrategy && issueLabels.Has(c.ArchiveLabel) {
+		return None, fmt.Sprintf("issue is archived with label %q", c.ArchiveLabel)
+	}
 	if len(c.ExemptLabels) > 0 {
 		// No update to issues that have ANY exempt labels
 		if issueLabels.HasAny(c.ExemptLabels...) {
-			return None
+			return None, "issue has an exempt label"
 		}
 	} else if issueLabels.HasAll(c.OnlyLabels...) {
 		// No update to issues that have ALL only labels
-		return None
+		return None, "issue has all only labels"
+	}
+
+	// Sub-tasks of an open parent that is not stale are not stale either. Under a stale parent,
+	// the normal activity and close rules apply.
+	if c.SubtasksInheritParent && rel != nil && rel.Parent != nil && isSubtask(i) &&
+		rel.Parent.Fields.Status.StatusCategory.Key != jira.StatusCategoryComplete && !c.isMarked(rel.Parent, now) {
+		reason := fmt.Sprintf("sub-task inherits stale state of parent %s, which is not stale", rel.Parent.Key)
+		if issueLabels.HasAny(staleLabels...) {
+			return RemoveStaleLabel, reason
+		}
+		return None, reason
+	}
+
+	// An issue linked to an unresolved, active issue is itself active.
+	if linked := c.activeLinkedIssue(rel, now.Add(-c.StaleThreshold())); linked != nil {
+		reason := fmt.Sprintf("linked issue %s is unresolved and active", linked.Key)
+		if issueLabels.HasAny(staleLabels...) {
+			return RemoveStaleLabel, reason
+		}
+		return None, reason
+	}
+
+	// The issue is considered active when any of its children were active.
+	lastUpdated := c.issueActivity(i)
+	var childUpdated time.Time
+	if c.ChildActivity {
+		childUpdated = c.childActivity(rel)
+		if childUpdated.After(lastUpdated) {
+			lastUpdated = childUpdated
+		}
 	}
 
 	// Staleness Lifecycle Step 1: Add a stale label
 	// If the issue does not already have a stale label, we'll check its last update time.
-	if !issueLabels.Has(c.StaleLabel) {
+	if !issueLabels.HasAny(staleLabels...) {
 		// No update if it has not yet been "daysUntilStale" days since the last update
-		if time.Time(i.Fields.Updated).After(now.Add(-time.Hour * 24 * time.Duration(c.DaysUntilStale))) {
-			return None
+		if lastUpdated.After(now.Add(-c.StaleThreshold())) {
+			return None, fmt.Sprintf("issue was updated in the last %s", describeDuration(c.StaleThreshold()))
 		}
-		return AddStaleLabel
+		// Escalate straight to close issues that keep going stale
+		if cycles := c.markCycles(i); c.CloseAfterCycles > 0 && cycles >= c.CloseAfterCycles {
+			return Close, fmt.Sprintf("issue has gone stale again after being marked stale %d times", cycles)
+		}
+		return AddStaleLabel, fmt.Sprintf("issue has not been updated in %s", describeDuration(c.StaleThreshold()))
 	}
 
 	// Staleness Lifecycle Step 2: Close rotten issues
 	// At this point, we know the issue has the stale label (progressing beyond step 1 guarantees this).
 	//
-	// If the last update added the stale label (i.e. there have been no updates since the stale label
-	// was added), then we'll check its last update time.
-	if lastUpdateAddedStaleLabel(i, c.StaleLabel) {
-		// No update if it has not yet been "daysUntilClose" days since the last update
-		if time.Time(i.Fields.Updated).After(now.Add(-time.Hour * 24 * time.Duration(c.DaysUntilClose))) {
-			return None
+	// The issue was marked when the changelog history that added the stale label was made. If it
+	// has had no activity since, as judged by the configured activity sources, we'll check how long
+	// ago it was marked. Child activity since the issue was marked counts as activity.
+	if markedAt, ok := c.markedAt(i); ok && !c.activeSince(i, markedAt, childUpdated) {
+		// No update if it has not yet been "daysUntilClose" days since the issue was marked
+		if markedAt.After(now.Add(-c.CloseThreshold())) {
+			return None, fmt.Sprintf("issue was marked stale less than %s ago", describeDuration(c.CloseThreshold()))
 		}
-		return Close
+		return Close, fmt.Sprintf("issue has been stale for %s", describeDuration(c.CloseThreshold()))
 	}
 
 	// Staleness Lifecycle Step 3: Unmark updated issues
-	// By now, we kno that the last update did not add a stale label, so we remove the stale label.
+	// By now, we know that the issue had activity since it was marked, so we remove the stale label.
 	//
-	// NOTE: It doesn't matter when the last update was with respect to the update that added the stale label.
-	// The fact that there was an update after the stale label was added but before the stale bot ran again
+	// NOTE: It doesn't matter when the activity was with respect to the update that added the stale label.
+	// The fact that there was activity after the stale label was added but before the stale bot ran again
 	// means that the next encounter of this issue by the stale bot should remove the label.
-	return RemoveStaleLabel
+	//
+	// To avoid flapping, an issue may require a minimum number of human actions before it is unmarked.
+	// Until then, it is treated as if it had not been updated since it was marked.
+	if idx := c.lastMarkIndex(i); c.UnmarkMinHumanActions > 0 && idx >= 0 {
+		if actions := c.humanActionsSince(i, idx); actions < c.UnmarkMinHumanActions {
+			markedAt, err := i.Changelog.Histories[idx].CreatedTime()
+			if err == nil && markedAt.After(now.Add(-c.CloseThreshold())) {
+				return None, fmt.Sprintf("issue has %d of %d human actions required to unmark it", actions, c.UnmarkMinHumanActions)
+			}
+			return Close, fmt.Sprintf("issue has been stale for %s with %d of %d human actions required to unmark it", describeDuration(c.CloseThreshold()), actions, c.UnmarkMinHumanActions)
+		}
+	}
+	if !childUpdated.IsZero() && childUpdated.After(time.Time(i.Fields.Updated)) {
+		return RemoveStaleLabel, "a child issue was updated after the issue was marked stale"
+	}
+	return RemoveStaleLabel, "issue was updated after it was marked stale"
 }
 
-func lastUpdateAddedStaleLabel(i *jira.Issue, staleLabel string) bool {
-	if i.Changelog != nil && len(i.Changelog.Histories) > 0 {
-		lastUpdate := i.Changelog.Histories[len(i.Changelog.Histories)-1]
-		for _, item := range lastUpdate.Items {
-			if item.Field == "labels" {
-				from := sets.NewString(strings.Split(item.FromString, " ")...)
-				to := sets.NewString(strings.Split(item.ToString, " ")...)
-				if !from.Has(staleLabel) && to.Has(staleLabel) {
-					return true
-				}
+// updateTolerance is how much later than its last changelog history an
+// issue's updated time may be while still being attributed to that history.
+const updateTolerance = time.Second
+
+// markedAt returns the time the changelog history that last marked the issue
+// stale was made, and true if there is such a history. If the time of the
+// history cannot be parsed, the issue's updated time is used.
+func (c *Config) markedAt(i *jira.Issue) (time.Time, bool) {
+	idx := c.lastMarkIndex(i)
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	if t, err := i.Changelog.Histories[idx].CreatedTime(); err == nil {
+		return t, true
+	}
+	return time.Time(i.Fields.Updated), true
+}
+
+// activeSince returns true if the issue had activity after markedAt, as
+// judged by the configured activity sources, or if a child was updated after
+// markedAt.
+func (c *Config) activeSince(i *jira.Issue, markedAt, childUpdated time.Time) bool {
+	if childUpdated.After(markedAt) {
+		return true
+	}
+	sources := c.activitySources()
+	if sources.Has(string(UpdatedActivity)) && c.updatedSince(i, markedAt) {
+		return true
+	}
+	if sources.Has(string(CommentsActivity)) && c.lastHumanComment(i).After(markedAt) {
+		return true
+	}
+	return sources.Has(string(ChangelogActivity)) && c.lastHumanChange(i).After(markedAt)
+}
+
+// updatedSince returns true if the issue was updated after it was marked
+// stale at markedAt. Changelog histories after the mark count as updates,
+// unless they were made by stalebot or a bot account, or are label
+// migrations. An updated time later than the last changelog history counts
+// too, since it stems from an update that left no history, like a comment.
+func (c *Config) updatedSince(i *jira.Issue, markedAt time.Time) bool {
+	histories := i.Changelog.Histories
+	idx := c.lastMarkIndex(i)
+	bots := c.botAccounts()
+
+	lastChange := markedAt
+	for _, h := range histories[idx+1:] {
+		if c.isLabelMigration(h) || bots.Has(h.Author.Name) {
+			if t, err := h.CreatedTime(); err == nil && t.After(lastChange) {
+				lastChange = t
 			}
+			continue
 		}
+		return true
 	}
-	return false
+	return time.Time(i.Fields.Updated).After(lastChange.Add(updateTolerance))
 }
@@ -47,7 +47,7 @@ var _ = Describe("Operations", func() {
 
 	AssertOperation := func(expectedOperation stalebot.Operation) {
 		It(fmt.Sprintf("results in operation %s", expectedOperation), func() {
-			actualOperation := cfg.IssueOperation(now, issue)
+			actualOperation := cfg.IssueOperation(now, issue, nil)
 			Expect(actualOperation).To(Equal(expectedOperation))
 		})
 	}
@@ -120,7 +120,7 @@ var _ = Describe("Operations", func() {
 				})
 				WhenLastUpdateAddedStaleLabel(func() {
 					It(fmt.Sprintf("results in operation %s", stalebot.None), func() {
-						actualOperation := cfg.IssueOperation(now, issue)
+						actualOperation := cfg.IssueOperation(now, issue, nil)
 						Expect(actualOperation).To(Equal(stalebot.None))
 					})
 					AssertOperation(stalebot.None)
@@ -157,3 +157,686 @@ var _ = Describe("Operations", func() {
 		AssertAll()
 	})
 })
+
+var _ = Describe("Hierarchy Operations", func() {
+	var (
+		issue *jira.Issue
+		rel   *stalebot.Relatives
+		cfg   *stalebot.Config
+	)
+	BeforeEach(func() {
+		issue = &jira.Issue{
+			Key: "TEST-200",
+			Fields: &jira.IssueFields{
+				Updated: jira.Time(minus120days),
+				Status:  &jira.Status{},
+				Labels:  []string{},
+			},
+			Changelog: &jira.Changelog{},
+		}
+		rel = &stalebot.Relatives{}
+		cfg = &stalebot.Config{
+			DaysUntilStale: 90,
+			DaysUntilClose: 30,
+			StaleLabel:     "lifecycle-stale",
+			ExemptLabels:   []string{"lifecycle-frozen"},
+		}
+	})
+
+	When("issue has a recently updated child", func() {
+		BeforeEach(func() {
+			rel.Children = []jira.Issue{{Key: "TEST-201", Fields: &jira.IssueFields{Updated: jira.Time(minus60days)}}}
+		})
+		When("childActivity is disabled", func() {
+			It("marks the issue stale", func() {
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+			})
+		})
+		When("childActivity is enabled", func() {
+			BeforeEach(func() {
+				cfg.ChildActivity = true
+			})
+			It("does not mark the issue stale", func() {
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.None))
+			})
+			It("does not count updates of the child by a bot account as activity", func() {
+				cfg.BotAccounts = []string{"sprint-bot"}
+				rel.Children[0].Changelog = &jira.Changelog{Histories: []jira.ChangelogHistory{{
+					Author:  jira.User{Name: "sprint-bot"},
+					Created: minus60days.Format("2006-01-02T15:04:05.000-0700"),
+					Items:   []jira.ChangelogItems{{Field: "Sprint"}},
+				}}}
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+			})
+			It("judges the child's activity by the configured activity sources", func() {
+				cfg.ActivitySources = []stalebot.ActivitySource{stalebot.CommentsActivity}
+				rel.Children[0].Fields.Created = jira.Time(minus120days)
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+			})
+			It("unmarks a stale issue whose child was updated after the stale label was added", func() {
+				issue.Fields.Labels = []string{cfg.StaleLabel}
+				issue.Fields.Updated = jira.Time(minus120days)
+				issue.Changelog.Histories = []jira.ChangelogHistory{{Items: []jira.ChangelogItems{{
+					Field:    "labels",
+					ToString: cfg.StaleLabel,
+				}}}}
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.RemoveStaleLabel))
+			})
+		})
+	})
+
+	When("issue is a sub-task and subtasksInheritParent is enabled", func() {
+		BeforeEach(func() {
+			cfg.SubtasksInheritParent = true
+			issue.Fields.Type = jira.IssueType{Subtask: true}
+			issue.Fields.Parent = &jira.Parent{Key: "TEST-199"}
+			issue.Fields.Updated = jira.Time(now)
+			rel.Parent = &jira.Issue{Key: "TEST-199", Fields: &jira.IssueFields{Status: &jira.Status{}}}
+		})
+		When("the parent is stale", func() {
+			BeforeEach(func() {
+				rel.Parent.Fields.Labels = []string{cfg.StaleLabel}
+			})
+			It("does not mark a recently active sub-task stale", func() {
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.None))
+			})
+			It("marks an inactive sub-task stale", func() {
+				issue.Fields.Updated = jira.Time(minus120days)
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+			})
+			It("closes a sub-task that stayed inactive after being marked", func() {
+				markedAt := now.Add(-day * 40)
+				issue.Fields.Labels = []string{cfg.StaleLabel}
+				issue.Fields.Updated = jira.Time(markedAt)
+				issue.Changelog.Histories = []jira.ChangelogHistory{{
+					Created: markedAt.Format("2006-01-02T15:04:05.000-0700"),
+					Items:   []jira.ChangelogItems{{Field: "labels", ToString: cfg.StaleLabel}},
+				}}
+				Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.Close))
+			})
+		})
+		It("unmarks the sub-task when the parent is not stale", func() {
+			issue.Fields.Labels = []string{cfg.StaleLabel}
+			Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.RemoveStaleLabel))
+		})
+		It("evaluates the sub-task on its own when the parent is complete", func() {
+			rel.Parent.Fields.Status.StatusCategory = jira.StatusCategory{Key: jira.StatusCategoryComplete}
+			issue.Fields.Updated = jira.Time(minus120days)
+			Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+		})
+	})
+})
+
+var _ = Describe("Linked Issue Operations", func() {
+	var (
+		issue *jira.Issue
+		rel   *stalebot.Relatives
+		cfg   *stalebot.Config
+	)
+	BeforeEach(func() {
+		issue = &jira.Issue{
+			Key: "TEST-300",
+			Fields: &jira.IssueFields{
+				Updated: jira.Time(minus120days),
+				Status:  &jira.Status{},
+			},
+			Changelog: &jira.Changelog{},
+		}
+		rel = &stalebot.Relatives{Linked: []jira.Issue{{
+			Key:    "TEST-301",
+			Fields: &jira.IssueFields{Updated: jira.Time(minus60days), Status: &jira.Status{}},
+		}}}
+		cfg = &stalebot.Config{
+			DaysUntilStale: 90,
+			DaysUntilClose: 30,
+			StaleLabel:     "lifecycle-stale",
+			ExemptLabels:   []string{"lifecycle-frozen"},
+		}
+	})
+
+	It("treats an issue linked to an active issue as active", func() {
+		op, reason := cfg.ExplainIssueOperation(now, issue, rel)
+		Expect(op).To(Equal(stalebot.None))
+		Expect(reason).To(ContainSubstring("TEST-301"))
+	})
+	It("unmarks a stale issue linked to an active issue", func() {
+		issue.Fields.Labels = []string{cfg.StaleLabel}
+		Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.RemoveStaleLabel))
+	})
+	It("does not count updates of a linked issue by a bot account as activity", func() {
+		cfg.BotAccounts = []string{"sprint-bot"}
+		rel.Linked[0].Changelog = &jira.Changelog{Histories: []jira.ChangelogHistory{{
+			Author:  jira.User{Name: "sprint-bot"},
+			Created: minus60days.Format("2006-01-02T15:04:05.000-0700"),
+			Items:   []jira.ChangelogItems{{Field: "Sprint"}},
+		}}}
+		Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+	})
+	It("ignores linked issues that are complete", func() {
+		rel.Linked[0].Fields.Status.StatusCategory = jira.StatusCategory{Key: jira.StatusCategoryComplete}
+		Expect(cfg.IssueOperation(now, issue, rel)).To(Equal(stalebot.AddStaleLabel))
+	})
+})
+
+var _ = Describe("Anti-flapping Operations", func() {
+	const jiraTimeFormat = "2006-01-02T15:04:05.000-0700"
+	var (
+		issue *jira.Issue
+		cfg   *stalebot.Config
+	)
+	markedBy := func(author string, at time.Time) jira.ChangelogHistory {
+		return jira.ChangelogHistory{
+			Author:  jira.User{Name: author},
+			Created: at.Format(jiraTimeFormat),
+			Items:   []jira.ChangelogItems{{Field: "labels", ToString: cfg.StaleLabel}},
+		}
+	}
+	unmarkedBy := func(author string, at time.Time) jira.ChangelogHistory {
+		return jira.ChangelogHistory{
+			Author:  jira.User{Name: author},
+			Created: at.Format(jiraTimeFormat),
+			Items:   []jira.ChangelogItems{{Field: "labels", FromString: cfg.StaleLabel}},
+		}
+	}
+	editedBy := func(author string, at time.Time) jira.ChangelogHistory {
+		return jira.ChangelogHistory{
+			Author:  jira.User{Name: author},
+			Created: at.Format(jiraTimeFormat),
+			Items:   []jira.ChangelogItems{{Field: "summary"}},
+		}
+	}
+
+	BeforeEach(func() {
+		issue = &jira.Issue{
+			Key: "TEST-400",
+			Fields: &jira.IssueFields{
+				Updated: jira.Time(minus120days),
+				Status:  &jira.Status{},
+			},
+			Changelog: &jira.Changelog{},
+		}
+		cfg = &stalebot.Config{
+			DaysUntilStale: 90,
+			DaysUntilClose: 30,
+			StaleLabel:     "lifecycle-stale",
+			ExemptLabels:   []string{"lifecycle-frozen"},
+			BotAccounts:    []string{"sprint-bot"},
+		}
+	})
+
+	When("closeAfterCycles is set", func() {
+		BeforeEach(func() {
+			cfg.CloseAfterCycles = 2
+			issue.Changelog.Histories = []jira.ChangelogHistory{
+				markedBy("stalebot", now.Add(-day*400)),
+				unmarkedBy("stalebot", now.Add(-day*380)),
+			}
+		})
+		It("marks an issue that has not reached the cycle limit", func() {
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.AddStaleLabel))
+		})
+		It("closes an issue that has reached the cycle limit", func() {
+			issue.Changelog.Histories = append(issue.Changelog.Histories,
+				markedBy("stalebot", now.Add(-day*250)),
+				unmarkedBy("stalebot", now.Add(-day*230)),
+			)
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+		})
+	})
+
+	When("unmarkMinHumanActions is set", func() {
+		BeforeEach(func() {
+			cfg.UnmarkMinHumanActions = 2
+			issue.Fields.Labels = []string{cfg.StaleLabel}
+			issue.Fields.Updated = jira.Time(minus60days)
+		})
+		When("issue was marked before close days ago", func() {
+			BeforeEach(func() {
+				issue.Changelog.Histories = []jira.ChangelogHistory{markedBy("stalebot", minus120days)}
+			})
+			It("closes an issue updated only by bots", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories,
+					editedBy("sprint-bot", minus60days),
+					editedBy("stalebot", minus60days),
+				)
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+			})
+			It("closes an issue with too few human actions", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories, editedBy("jdoe", minus60days))
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+			})
+			It("unmarks an issue with enough human actions", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories,
+					editedBy("jdoe", minus60days),
+					editedBy("asmith", minus60days),
+				)
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.RemoveStaleLabel))
+			})
+			It("counts repeated edits by the same person once", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories,
+					editedBy("jdoe", minus60days),
+					editedBy("jdoe", minus60days),
+					editedBy("jdoe", minus60days),
+				)
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+			})
+			It("counts human comments as actions", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories, editedBy("jdoe", minus60days))
+				issue.Fields.Comments = &jira.Comments{Comments: []*jira.Comment{
+					{Author: jira.User{Name: "asmith"}, Body: "+1, please keep this open", Created: minus60days.Format(jiraTimeFormat)},
+				}}
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.RemoveStaleLabel))
+			})
+			It("does not count comments by bots or stalebot", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories, editedBy("jdoe", minus60days))
+				issue.Fields.Comments = &jira.Comments{Comments: []*jira.Comment{
+					{Author: jira.User{Name: "sprint-bot"}, Body: "Moved to next sprint", Created: minus60days.Format(jiraTimeFormat)},
+					{Author: jira.User{Name: "asmith"}, Body: "[STALEBOT COMMENT] This issue is stale", Created: minus60days.Format(jiraTimeFormat)},
+				}}
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+			})
+			It("does not count comments made before the issue was marked", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories, editedBy("jdoe", minus60days))
+				issue.Fields.Comments = &jira.Comments{Comments: []*jira.Comment{
+					{Author: jira.User{Name: "asmith"}, Body: "Still broken", Created: now.Add(-day * 200).Format(jiraTimeFormat)},
+				}}
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+			})
+		})
+		When("issue was marked after close days ago", func() {
+			BeforeEach(func() {
+				issue.Changelog.Histories = []jira.ChangelogHistory{
+					markedBy("stalebot", now.Add(-day*10)),
+					editedBy("jdoe", now.Add(-day*5)),
+				}
+			})
+			It("leaves an issue with too few human actions marked", func() {
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+			})
+		})
+	})
+})
+
+var _ = Describe("Duration Threshold Operations", func() {
+	var (
+		issue *jira.Issue
+		cfg   *stalebot.Config
+	)
+	BeforeEach(func() {
+		issue = &jira.Issue{
+			Key: "TEST-500",
+			Fields: &jira.IssueFields{
+				Status: &jira.Status{},
+				Labels: []string{"lifecycle-stale"},
+			},
+			Changelog: &jira.Changelog{Histories: []jira.ChangelogHistory{{Items: []jira.ChangelogItems{{
+				Field:    "labels",
+				ToString: "lifecycle-stale",
+			}}}}},
+		}
+		cfg = &stalebot.Config{
+			StaleAfter:   &stalebot.Duration{Duration: 36 * time.Hour},
+			CloseAfter:   &stalebot.Duration{},
+			StaleLabel:   "lifecycle-stale",
+			ExemptLabels: []string{"lifecycle-frozen"},
+		}
+	})
+
+	It("closes a stale issue immediately when the close threshold is zero", func() {
+		issue.Fields.Updated = jira.Time(now)
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+	})
+	It("does not close a stale issue updated after now when the close threshold is zero", func() {
+		issue.Fields.Updated = jira.Time(now.Add(time.Minute))
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+	})
+	It("marks issues using sub-day precision", func() {
+		issue.Fields.Labels = nil
+		issue.Changelog.Histories = nil
+		issue.Fields.Updated = jira.Time(now.Add(-37 * time.Hour))
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.AddStaleLabel))
+		issue.Fields.Updated = jira.Time(now.Add(-35 * time.Hour))
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+	})
+	It("prefers the duration thresholds over the integer-day fields", func() {
+		cfg.DaysUntilClose = 30
+		issue.Fields.Updated = jira.Time(now)
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+	})
+})
+
+var _ = Describe("Activity Source Operations", func() {
+	const jiraTimeFormat = "2006-01-02T15:04:05.000-0700"
+	var (
+		issue *jira.Issue
+		cfg   *stalebot.Config
+	)
+	commentBy := func(author, body string, at time.Time) *jira.Comment {
+		return &jira.Comment{
+			Author:  jira.User{Name: author},
+			Body:    body,
+			Created: at.Format(jiraTimeFormat),
+			Updated: at.Format(jiraTimeFormat),
+		}
+	}
+	history := func(author string, at time.Time, item jira.ChangelogItems) jira.ChangelogHistory {
+		return jira.ChangelogHistory{
+			Author:  jira.User{Name: author},
+			Created: at.Format(jiraTimeFormat),
+			Items:   []jira.ChangelogItems{item},
+		}
+	}
+
+	BeforeEach(func() {
+		issue = &jira.Issue{
+			Key: "TEST-600",
+			Fields: &jira.IssueFields{
+				Created:  jira.Time(now.Add(-day * 365)),
+				Updated:  jira.Time(now.Add(-day * 5)),
+				Status:   &jira.Status{},
+				Comments: &jira.Comments{},
+			},
+			Changelog: &jira.Changelog{},
+		}
+		cfg = &stalebot.Config{
+			DaysUntilStale: 90,
+			DaysUntilClose: 30,
+			StaleLabel:     "lifecycle-stale",
+			ExemptLabels:   []string{"lifecycle-frozen"},
+			BotAccounts:    []string{"sprint-bot", "stalebot"},
+		}
+	})
+
+	It("uses the updated time by default", func() {
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+	})
+
+	When("comments are the activity source", func() {
+		BeforeEach(func() {
+			cfg.ActivitySources = []stalebot.ActivitySource{stalebot.CommentsActivity}
+		})
+		It("marks an issue updated recently without human comments", func() {
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.AddStaleLabel))
+		})
+		It("does not mark an issue with a recent human comment", func() {
+			issue.Fields.Comments.Comments = []*jira.Comment{commentBy("jdoe", "Still happening", now.Add(-day*5))}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+		})
+		It("ignores comments by bot accounts and stalebot", func() {
+			issue.Fields.Comments.Comments = []*jira.Comment{
+				commentBy("sprint-bot", "Moved to the next sprint", now.Add(-day*5)),
+				commentBy("jdoe", "[STALEBOT COMMENT] This issue is stale", now.Add(-day*5)),
+				commentBy("jdoe", "Closing.{anchor:jira-stalebot-close-1}", now.Add(-day*5)),
+			}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.AddStaleLabel))
+		})
+		It("requests the comment and created fields", func() {
+			Expect(cfg.SearchFields()).To(ContainElements("comment", "created"))
+		})
+	})
+
+	When("the changelog is the activity source", func() {
+		BeforeEach(func() {
+			cfg.ActivitySources = []stalebot.ActivitySource{stalebot.ChangelogActivity}
+		})
+		It("does not mark an issue with a recent human change", func() {
+			issue.Changelog.Histories = []jira.ChangelogHistory{history("jdoe", now.Add(-day*5), jira.ChangelogItems{Field: "summary"})}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+		})
+		It("ignores changes by bot accounts", func() {
+			issue.Changelog.Histories = []jira.ChangelogHistory{history("sprint-bot", now.Add(-day*5), jira.ChangelogItems{Field: "Sprint"})}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.AddStaleLabel))
+		})
+		It("does not mark an issue a human unmarked and then changed", func() {
+			issue.Changelog.Histories = []jira.ChangelogHistory{
+				history("stalebot", now.Add(-day*40), jira.ChangelogItems{Field: "labels", ToString: cfg.StaleLabel}),
+				history("jdoe", now.Add(-day*10), jira.ChangelogItems{Field: "labels", FromString: cfg.StaleLabel}),
+				history("jdoe", now.Add(-day*5), jira.ChangelogItems{Field: "summary"}),
+			}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+		})
+
+		When("the issue is marked stale", func() {
+			BeforeEach(func() {
+				issue.Fields.Labels = []string{cfg.StaleLabel}
+				issue.Changelog.Histories = []jira.ChangelogHistory{
+					history("stalebot", now.Add(-day*40), jira.ChangelogItems{Field: "labels", ToString: cfg.StaleLabel}),
+				}
+			})
+			It("closes an issue changed only by stalebot and bots since it was marked", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories,
+					history("stalebot", now.Add(-day*20), jira.ChangelogItems{Field: "priority"}),
+					history("sprint-bot", now.Add(-day*5), jira.ChangelogItems{Field: "Sprint"}),
+				)
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+			})
+			It("leaves an issue marked less than close days ago", func() {
+				issue.Changelog.Histories[0].Created = now.Add(-day * 10).Format(jiraTimeFormat)
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+			})
+			It("unmarks an issue changed by a human since it was marked", func() {
+				issue.Changelog.Histories = append(issue.Changelog.Histories,
+					history("jdoe", now.Add(-day*5), jira.ChangelogItems{Field: "summary"}),
+				)
+				Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.RemoveStaleLabel))
+			})
+		})
+	})
+
+	When("comments and the changelog are activity sources", func() {
+		BeforeEach(func() {
+			cfg.ActivitySources = []stalebot.ActivitySource{stalebot.CommentsActivity, stalebot.ChangelogActivity}
+		})
+		It("uses the latest activity from either source", func() {
+			issue.Changelog.Histories = []jira.ChangelogHistory{history("jdoe", now.Add(-day*120), jira.ChangelogItems{Field: "summary"})}
+			issue.Fields.Comments.Comments = []*jira.Comment{commentBy("asmith", "Any news?", now.Add(-day*5))}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+		})
+	})
+
+	It("rejects unknown activity sources", func() {
+		cfg.JiraBaseURL = "https://jira.example.com"
+		cfg.ActivitySources = []stalebot.ActivitySource{"votes"}
+		Expect(cfg.Validate()).To(MatchError(ContainSubstring(`unknown activity source "votes"`)))
+	})
+})
+
+var _ = Describe("Label Migration Operations", func() {
+	const jiraTimeFormat = "2006-01-02T15:04:05.000-0700"
+	var (
+		issue *jira.Issue
+		cfg   *stalebot.Config
+	)
+	labelHistory := func(author string, at time.Time, from, to string) jira.ChangelogHistory {
+		return jira.ChangelogHistory{
+			Author:  jira.User{Name: author},
+			Created: at.Format(jiraTimeFormat),
+			Items:   []jira.ChangelogItems{{Field: "labels", FromString: from, ToString: to}},
+		}
+	}
+
+	BeforeEach(func() {
+		issue = &jira.Issue{
+			Key: "TEST-700",
+			Fields: &jira.IssueFields{
+				Updated: jira.Time(now.Add(-day * 40)),
+				Status:  &jira.Status{},
+				Labels:  []string{"lifecycle-stale"},
+			},
+			Changelog: &jira.Changelog{Histories: []jira.ChangelogHistory{
+				labelHistory("stalebot", now.Add(-day*40), "", "lifecycle-stale"),
+			}},
+		}
+		cfg = &stalebot.Config{
+			DaysUntilStale: 90,
+			DaysUntilClose: 30,
+			StaleLabel:     "stale",
+			ExemptLabels:   []string{"lifecycle-frozen"},
+			LabelMigration: &stalebot.LabelMigration{From: "lifecycle-stale", Until: "2000-02-01"},
+		}
+	})
+
+	It("treats issues with the previous label as stale during the transition window", func() {
+		Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+	})
+	It("no longer recognises the previous label after the transition window", func() {
+		issue.Fields.Updated = jira.Time(now.Add(-day * 100))
+		Expect(cfg.IssueOperation(now.Add(day*31), issue, nil)).To(Equal(stalebot.AddStaleLabel))
+	})
+
+	When("the label was migrated", func() {
+		BeforeEach(func() {
+			issue.Fields.Labels = []string{"stale"}
+			issue.Fields.Updated = jira.Time(now.Add(-day * 5))
+			issue.Changelog.Histories = append(issue.Changelog.Histories,
+				labelHistory("stalebot", now.Add(-day*5), "lifecycle-stale", "stale"),
+			)
+		})
+		It("does not reset the staleness clock", func() {
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+		})
+		It("leaves issues marked less than close days ago", func() {
+			issue.Changelog.Histories[0].Created = now.Add(-day * 10).Format(jiraTimeFormat)
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.None))
+		})
+		It("unmarks issues updated after the migration", func() {
+			issue.Fields.Updated = jira.Time(now.Add(-day * 2))
+			issue.Changelog.Histories = append(issue.Changelog.Histories, jira.ChangelogHistory{
+				Author:  jira.User{Name: "jdoe"},
+				Created: now.Add(-day * 2).Format(jiraTimeFormat),
+				Items:   []jira.ChangelogItems{{Field: "summary"}},
+			})
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.RemoveStaleLabel))
+		})
+		It("keeps the staleness clock after the transition window", func() {
+			cfg.DaysUntilClose = 60
+			Expect(cfg.IssueOperation(now.Add(day*32), issue, nil)).To(Equal(stalebot.Close))
+		})
+		It("does not count removing the previous label from an issue that had both as activity", func() {
+			issue.Changelog.Histories[1] = labelHistory("admin", now.Add(-day*5), "lifecycle-stale stale", "stale")
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.Close))
+		})
+		It("does not count the migration as a stale cycle", func() {
+			cfg.CloseAfterCycles = 2
+			issue.Fields.Labels = nil
+			issue.Fields.Updated = jira.Time(now.Add(-day * 100))
+			issue.Changelog.Histories = append(issue.Changelog.Histories, labelHistory("stalebot", now.Add(-day*100), "stale", ""))
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(stalebot.AddStaleLabel))
+		})
+	})
+})
+
+var _ = Describe("Close Timing Operations", func() {
+	const (
+		jiraTimeFormat = "2006-01-02T15:04:05.000-0700"
+		staleLabel     = "lifecycle-stale"
+	)
+	daysAgo := func(d int) time.Time { return now.Add(-day * time.Duration(d)) }
+	history := func(author string, at time.Time, items ...jira.ChangelogItems) jira.ChangelogHistory {
+		return jira.ChangelogHistory{Author: jira.User{Name: author}, Created: at.Format(jiraTimeFormat), Items: items}
+	}
+	mark := func(author string, at time.Time) jira.ChangelogHistory {
+		return history(author, at, jira.ChangelogItems{Field: "labels", ToString: staleLabel})
+	}
+	unmark := func(author string, at time.Time) jira.ChangelogHistory {
+		return history(author, at, jira.ChangelogItems{Field: "labels", FromString: staleLabel})
+	}
+	edit := func(author string, at time.Time, field string) jira.ChangelogHistory {
+		return history(author, at, jira.ChangelogItems{Field: field, FromString: "before", ToString: "after"})
+	}
+
+	var cfg *stalebot.Config
+	BeforeEach(func() {
+		cfg = &stalebot.Config{
+			DaysUntilStale: 90,
+			DaysUntilClose: 30,
+			StaleLabel:     staleLabel,
+			ExemptLabels:   []string{"lifecycle-frozen"},
+			BotAccounts:    []string{"sprint-bot", "stalebot"},
+		}
+	})
+
+	issueWith := func(updated time.Time, histories ...jira.ChangelogHistory) *jira.Issue {
+		return &jira.Issue{
+			Key: "TEST-800",
+			Fields: &jira.IssueFields{
+				Created: jira.Time(daysAgo(365)),
+				Updated: jira.Time(updated),
+				Status:  &jira.Status{},
+				Labels:  []string{staleLabel},
+			},
+			Changelog: &jira.Changelog{Histories: histories},
+		}
+	}
+
+	DescribeTable("with the updated activity source",
+		func(issue *jira.Issue, expected stalebot.Operation) {
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(expected))
+		},
+		Entry("closes an issue marked before close days ago without later updates",
+			issueWith(daysAgo(40), mark("stalebot", daysAgo(40))), stalebot.Close),
+		Entry("leaves an issue marked after close days ago without later updates",
+			issueWith(daysAgo(10), mark("stalebot", daysAgo(10))), stalebot.None),
+		Entry("closes an issue edited only by a bot account since it was marked",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40)), edit("sprint-bot", daysAgo(5), "Sprint")), stalebot.Close),
+		Entry("closes an issue edited only by stalebot since it was marked",
+			issueWith(daysAgo(20), mark("stalebot", daysAgo(40)), edit("stalebot", daysAgo(20), "priority")), stalebot.Close),
+		Entry("unmarks an issue edited by an account named like the simulation outside simulations",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40)), edit("jira-stalebot-simulation", daysAgo(5), "summary")), stalebot.RemoveStaleLabel),
+		Entry("leaves an issue edited by a bot account but marked after close days ago",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(10)), edit("sprint-bot", daysAgo(5), "Sprint")), stalebot.None),
+		Entry("unmarks an issue edited by a human since it was marked",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40)), edit("jdoe", daysAgo(5), "summary")), stalebot.RemoveStaleLabel),
+		Entry("unmarks an issue edited by a human before a later bot edit",
+			issueWith(daysAgo(2), mark("stalebot", daysAgo(40)), edit("jdoe", daysAgo(5), "summary"), edit("sprint-bot", daysAgo(2), "Sprint")), stalebot.RemoveStaleLabel),
+		Entry("unmarks an issue updated without a changelog history since it was marked",
+			issueWith(daysAgo(3), mark("stalebot", daysAgo(40)), edit("sprint-bot", daysAgo(5), "Sprint")), stalebot.RemoveStaleLabel),
+		Entry("attributes an updated time within the tolerance to the last history",
+			issueWith(daysAgo(5).Add(500*time.Millisecond), mark("stalebot", daysAgo(40)), edit("sprint-bot", daysAgo(5), "Sprint")), stalebot.Close),
+		Entry("ignores human edits before the issue was last marked",
+			issueWith(daysAgo(40), mark("stalebot", daysAgo(200)), edit("jdoe", daysAgo(150), "summary"), unmark("stalebot", daysAgo(150)), mark("stalebot", daysAgo(40))), stalebot.Close),
+		Entry("times the close from the last mark, not the first",
+			issueWith(daysAgo(10), mark("stalebot", daysAgo(200)), unmark("stalebot", daysAgo(150)), mark("stalebot", daysAgo(10))), stalebot.None),
+		Entry("treats a manually added stale label like a mark",
+			issueWith(daysAgo(5), mark("jdoe", daysAgo(40)), edit("sprint-bot", daysAgo(5), "Sprint")), stalebot.Close),
+		Entry("unmarks an issue edited by the human who marked it",
+			issueWith(daysAgo(5), mark("jdoe", daysAgo(40)), edit("jdoe", daysAgo(5), "summary")), stalebot.RemoveStaleLabel),
+		Entry("unmarks an issue whose stale label was not added in its changelog",
+			issueWith(daysAgo(40), edit("jdoe", daysAgo(40), "summary")), stalebot.RemoveStaleLabel),
+	)
+
+	DescribeTable("with the comments activity source",
+		func(issue *jira.Issue, comments []*jira.Comment, expected stalebot.Operation) {
+			cfg.ActivitySources = []stalebot.ActivitySource{stalebot.CommentsActivity}
+			issue.Fields.Comments = &jira.Comments{Comments: comments}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(expected))
+		},
+		Entry("closes an issue edited by a human but not commented on since it was marked",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40)), edit("jdoe", daysAgo(5), "summary")), nil, stalebot.Close),
+		Entry("unmarks an issue commented on by a human since it was marked",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40))),
+			[]*jira.Comment{{Author: jira.User{Name: "jdoe"}, Body: "Still an issue", Created: daysAgo(5).Format(jiraTimeFormat)}},
+			stalebot.RemoveStaleLabel),
+		Entry("closes an issue commented on by a human only before it was marked",
+			issueWith(daysAgo(40), mark("stalebot", daysAgo(40))),
+			[]*jira.Comment{{Author: jira.User{Name: "jdoe"}, Body: "Any news?", Created: daysAgo(60).Format(jiraTimeFormat)}},
+			stalebot.Close),
+		Entry("closes an issue with only a stalebot comment since it was marked",
+			issueWith(daysAgo(40), mark("stalebot", daysAgo(40))),
+			[]*jira.Comment{{Author: jira.User{Name: "stalebot"}, Body: "[STALEBOT COMMENT] This issue is stale.", Created: daysAgo(40).Format(jiraTimeFormat)}},
+			stalebot.Close),
+	)
+
+	DescribeTable("with the changelog activity source",
+		func(issue *jira.Issue, expected stalebot.Operation) {
+			cfg.ActivitySources = []stalebot.ActivitySource{stalebot.ChangelogActivity}
+			Expect(cfg.IssueOperation(now, issue, nil)).To(Equal(expected))
+		},
+		Entry("closes an issue updated without a changelog history since it was marked",
+			issueWith(daysAgo(3), mark("stalebot", daysAgo(40))), stalebot.Close),
+		Entry("closes an issue edited only by a bot account since it was marked",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40)), edit("sprint-bot", daysAgo(5), "Sprint")), stalebot.Close),
+		Entry("unmarks an issue edited by a human since it was marked",
+			issueWith(daysAgo(5), mark("stalebot", daysAgo(40)), edit("jdoe", daysAgo(5), "summary")), stalebot.RemoveStaleLabel),
+	)
+})
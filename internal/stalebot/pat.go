@@ -1,29 +1,271 @@
 package stalebot
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
 )
 
 const (
 	patEnvVar         = "JIRA_STALEBOT_PAT"
 	xdgConfigFilePath = "jira-stalebot/pat"
+
+	passphraseEnvVar           = "JIRA_STALEBOT_PASSPHRASE"
+	xdgEncryptedConfigFilePath = "jira-stalebot/pat.enc"
 )
 
-func LoadPersonalAccessToken() (string, error) {
+// LoadPersonalAccessToken loads the personal access token from, in order of
+// precedence: the JIRA_STALEBOT_PAT environment variable, the output of
+// tokenCommand (if set), the encrypted token file, or the plaintext token
+// file.
+func LoadPersonalAccessToken(log logr.Logger, tokenCommand string) (string, error) {
 	if pat, ok := os.LookupEnv(patEnvVar); ok {
 		return pat, nil
 	}
+	if tokenCommand != "" {
+		return runTokenCommand(tokenCommand)
+	}
+	if encFile, err := xdg.SearchConfigFile(xdgEncryptedConfigFilePath); err == nil {
+		passphrase, err := readPassphrase("Passphrase for " + encFile)
+		if err != nil {
+			return "", err
+		}
+		return decryptTokenFile(encFile, passphrase)
+	}
 	patFile, err := xdg.SearchConfigFile(xdgConfigFilePath)
 	if err != nil {
 		return "", fmt.Errorf("%s environment variable not set and personal access token file not found: %v", patEnvVar, err)
 	}
+	if err := checkFilePermissions(patFile); err != nil {
+		log.Error(err, "insecure personal access token file, run 'chmod 600' on it", "path", patFile)
+	}
 	patBytes, err := os.ReadFile(patFile)
 	if err != nil {
 		return "", err
 	}
 	return strings.TrimSpace(string(patBytes)), nil
 }
+
+// StorePersonalAccessToken stores token in the XDG config directory, either in
+// plaintext (readable only by the current user) or, if passphrase is
+// non-empty, encrypted with the passphrase. It returns the path of the file.
+// An existing file is replaced, so that it is readable only by the current
+// user too.
+func StorePersonalAccessToken(token, passphrase string) (string, error) {
+	if passphrase == "" {
+		path, err := xdg.ConfigFile(xdgConfigFilePath)
+		if err != nil {
+			return "", err
+		}
+		return path, writePrivateFile(path, []byte(token+"\n"))
+	}
+	path, err := xdg.ConfigFile(xdgEncryptedConfigFilePath)
+	if err != nil {
+		return "", err
+	}
+	return path, encryptTokenFile(path, token, passphrase)
+}
+
+// DeletePersonalAccessTokens removes any stored personal access token files
+// and returns the paths of the removed files.
+func DeletePersonalAccessTokens() ([]string, error) {
+	var removed []string
+	for _, p := range []string{xdgConfigFilePath, xdgEncryptedConfigFilePath} {
+		path, err := xdg.SearchConfigFile(p)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+func runTokenCommand(tokenCommand string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", tokenCommand)
+	} else {
+		cmd = exec.Command("sh", "-c", tokenCommand)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("run token command: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	pat := strings.TrimSpace(string(out))
+	if pat == "" {
+		return "", fmt.Errorf("token command produced no output")
+	}
+	return pat, nil
+}
+
+// checkFilePermissions returns an error if the file is readable by users other
+// than its owner.
+func checkFilePermissions(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("file mode %#o is group or world accessible, expected 0600", perm)
+	}
+	return nil
+}
+
+// readPassphrase reads the passphrase for the encrypted token file from the
+// JIRA_STALEBOT_PASSPHRASE environment variable, or prompts for it if stdin
+// is a terminal.
+func readPassphrase(prompt string) (string, error) {
+	if passphrase, ok := os.LookupEnv(passphraseEnvVar); ok {
+		return passphrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%s environment variable not set and stdin is not a terminal", passphraseEnvVar)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %v", err)
+	}
+	return string(passphrase), nil
+}
+
+// ReadPassphrase prompts for a passphrase to encrypt a token file with.
+func ReadPassphrase() (string, error) {
+	return readPassphrase("Passphrase to encrypt token")
+}
+
+type encryptedToken struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func tokenCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptTokenFile(path, token, passphrase string) error {
+	enc := encryptedToken{Salt: make([]byte, 16)}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	aead, err := tokenCipher(passphrase, enc.Salt)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Ciphertext = aead.Seal(nil, enc.Nonce, []byte(token), nil)
+	data, err := json.Marshal(enc)
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, data)
+}
+
+func decryptTokenFile(path, passphrase string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var enc encryptedToken
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return "", fmt.Errorf("decode encrypted token file %q: %v", path, err)
+	}
+	aead, err := tokenCipher(passphrase, enc.Salt)
+	if err != nil {
+		return "", err
+	}
+	token, err := aead.Open(nil, enc.Nonce, enc.Ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt token file %q: incorrect passphrase or corrupt file", path)
+	}
+	return string(token), nil
+}
+
+// TokenInfo describes a personal access token of the authenticated user.
+type TokenInfo struct {
+	Name           string `json:"name"`
+	CreatedAt      string `json:"createdAt"`
+	ExpiringAt     string `json:"expiringAt"`
+	LastAccessedAt string `json:"lastAccessedAt"`
+}
+
+// CurrentPersonalAccessToken returns the token that was accessed last, which
+// is the token in use right after it authenticated a request.
+func CurrentPersonalAccessToken(tokens []TokenInfo) (TokenInfo, bool) {
+	var (
+		current TokenInfo
+		latest  time.Time
+		found   bool
+	)
+	for _, t := range tokens {
+		accessed, err := parseTokenTime(t.LastAccessedAt)
+		if err != nil {
+			continue
+		}
+		if !found || accessed.After(latest) {
+			current, latest, found = t, accessed, true
+		}
+	}
+	return current, found
+}
+
+func parseTokenTime(s string) (time.Time, error) {
+	t, err := time.Parse(jiraTimeLayout, s)
+	if err != nil {
+		return time.Parse(time.RFC3339, s)
+	}
+	return t, nil
+}
+
+// ListPersonalAccessTokens lists the personal access tokens of the
+// authenticated user. It is only supported by Jira Data Center.
+func ListPersonalAccessTokens(ctx context.Context, cl *jira.Client) ([]TokenInfo, error) {
+	req, err := cl.NewRequest(ctx, http.MethodGet, "rest/pat/latest/tokens", nil)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []TokenInfo
+	resp, err := cl.Do(req, &tokens)
+	if err != nil {
+		return nil, jira.NewJiraError(resp, err)
+	}
+	return tokens, nil
+}
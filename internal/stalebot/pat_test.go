@@ -0,0 +1,113 @@
+package stalebot_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Personal access tokens", func() {
+	var (
+		dir    string
+		logged []string
+		log    logr.Logger
+	)
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		logged = nil
+		log = funcr.New(func(prefix, args string) { logged = append(logged, args) }, funcr.Options{})
+
+		DeferCleanup(xdg.Reload)
+		GinkgoT().Setenv("XDG_CONFIG_HOME", dir)
+		GinkgoT().Setenv("JIRA_STALEBOT_PAT", "")
+		Expect(os.Unsetenv("JIRA_STALEBOT_PAT")).To(Succeed())
+		xdg.Reload()
+	})
+	expectPrivate := func(path string) {
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	}
+
+	Context("encrypted token file", func() {
+		It("decrypts the token with the passphrase it was encrypted with", func() {
+			path, err := stalebot.StorePersonalAccessToken("s3cr3t", "passphrase")
+			Expect(err).NotTo(HaveOccurred())
+			expectPrivate(path)
+			GinkgoT().Setenv("JIRA_STALEBOT_PASSPHRASE", "passphrase")
+			Expect(stalebot.LoadPersonalAccessToken(log, "")).To(Equal("s3cr3t"))
+		})
+		It("fails with the wrong passphrase", func() {
+			_, err := stalebot.StorePersonalAccessToken("s3cr3t", "passphrase")
+			Expect(err).NotTo(HaveOccurred())
+			GinkgoT().Setenv("JIRA_STALEBOT_PASSPHRASE", "wrong")
+			_, err = stalebot.LoadPersonalAccessToken(log, "")
+			Expect(err).To(MatchError(ContainSubstring("incorrect passphrase or corrupt file")))
+		})
+	})
+
+	Context("file permissions", func() {
+		It("accepts a file readable only by its owner", func() {
+			path, err := stalebot.StorePersonalAccessToken("s3cr3t", "")
+			Expect(err).NotTo(HaveOccurred())
+			expectPrivate(path)
+			Expect(stalebot.LoadPersonalAccessToken(log, "")).To(Equal("s3cr3t"))
+			Expect(logged).To(BeEmpty())
+		})
+		It("warns about a group or world readable file", func() {
+			path, err := stalebot.StorePersonalAccessToken("s3cr3t", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chmod(path, 0644)).To(Succeed())
+			Expect(stalebot.LoadPersonalAccessToken(log, "")).To(Equal("s3cr3t"))
+			Expect(logged).To(ConsistOf(ContainSubstring("group or world accessible")))
+		})
+		It("restricts an existing token file when storing a token", func() {
+			path := filepath.Join(dir, "jira-stalebot", "pat")
+			Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+			Expect(os.WriteFile(path, []byte("old"), 0644)).To(Succeed())
+			Expect(os.Chmod(path, 0644)).To(Succeed())
+
+			Expect(stalebot.StorePersonalAccessToken("s3cr3t", "")).To(Equal(path))
+			expectPrivate(path)
+			Expect(os.ReadFile(path)).To(Equal([]byte("s3cr3t\n")))
+		})
+	})
+
+	Context("token command", func() {
+		It("returns the trimmed output of the command", func() {
+			Expect(stalebot.LoadPersonalAccessToken(log, "echo '  s3cr3t  '")).To(Equal("s3cr3t"))
+		})
+		It("fails when the command produces no output", func() {
+			_, err := stalebot.LoadPersonalAccessToken(log, "true")
+			Expect(err).To(MatchError("token command produced no output"))
+		})
+		It("fails with the standard error of a failing command", func() {
+			_, err := stalebot.LoadPersonalAccessToken(log, "echo 'vault sealed' >&2; exit 1")
+			Expect(err).To(MatchError(ContainSubstring("vault sealed")))
+		})
+	})
+
+	Context("token in use", func() {
+		It("is the token accessed last", func() {
+			tokens := []stalebot.TokenInfo{
+				{Name: "old", LastAccessedAt: "2024-01-01T00:00:00.000+0000"},
+				{Name: "never-used"},
+				{Name: "stalebot", LastAccessedAt: "2024-03-01T00:00:00.000+0000", ExpiringAt: "2024-06-01T00:00:00.000+0000"},
+			}
+			current, ok := stalebot.CurrentPersonalAccessToken(tokens)
+			Expect(ok).To(BeTrue())
+			Expect(current.Name).To(Equal("stalebot"))
+		})
+		It("is unknown when no token was accessed", func() {
+			_, ok := stalebot.CurrentPersonalAccessToken([]stalebot.TokenInfo{{Name: "never-used"}})
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
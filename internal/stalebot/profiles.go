@@ -0,0 +1,279 @@
+package stalebot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adrg/xdg"
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+)
+
+const xdgProfilesFilePath = "jira-stalebot/profiles.yaml"
+
+type AuthType string
+
+const (
+	// PATAuth authenticates with a long-lived personal access token.
+	PATAuth AuthType = "pat"
+	// BearerAuth authenticates with a bearer token, such as an OAuth 2.0
+	// access token issued by an SSO proxy. If the token is read from
+	// tokenCommand, the command is run again for a fresh token whenever Jira
+	// rejects the current one.
+	BearerAuth AuthType = "bearer"
+	// BasicAuth authenticates with a user name and password.
+	BasicAuth AuthType = "basic"
+)
+
+// Profile holds the credentials for a single Jira instance.
+type Profile struct {
+	JiraBaseURL string   `json:"jiraBaseURL"`
+	Type        AuthType `json:"type"`
+
+	// Username is the user name for basic authentication.
+	Username string `json:"username,omitempty"`
+
+	// The token (or, for basic authentication, the password) is read from
+	// exactly one of Token, TokenFile or TokenCommand.
+	Token        string `json:"token,omitempty"`
+	TokenFile    string `json:"tokenFile,omitempty"`
+	TokenCommand string `json:"tokenCommand,omitempty"`
+}
+
+type profilesFile struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Credentials are the resolved credentials used to authenticate with Jira.
+type Credentials struct {
+	Type     AuthType
+	Username string
+	Token    string
+	// TokenCommand refreshes bearer tokens.
+	TokenCommand string
+}
+
+// HTTPClient returns an HTTP client that authenticates requests with the
+// credentials.
+func (c Credentials) HTTPClient() *http.Client {
+	switch c.Type {
+	case BasicAuth:
+		return (&jira.BasicAuthTransport{Username: c.Username, Password: c.Token}).Client()
+	case BearerAuth:
+		return &http.Client{Transport: &bearerTokenTransport{command: c.TokenCommand, token: c.Token}}
+	default:
+		return (&jira.PATAuthTransport{Token: c.Token}).Client()
+	}
+}
+
+// LoadCredentials resolves the credentials for the configured Jira instance.
+// If profile is set, the named profile from the profiles file in the XDG
+// config directory is used; its jiraBaseURL must match the config's, so that
+// credentials are never sent to another instance. Otherwise, the profile
+// whose jiraBaseURL matches the config's is used. If no profile matches, the
+// personal access token is loaded by LoadPersonalAccessToken.
+func LoadCredentials(log logr.Logger, cfg *Config, profile string) (*Credentials, error) {
+	p, err := resolveProfile(log, cfg.JiraBaseURL, profile)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		return p.credentials(log)
+	}
+
+	pat, err := LoadPersonalAccessToken(log, cfg.TokenCommand)
+	if err != nil {
+		return nil, err
+	}
+	return &Credentials{Type: PATAuth, Token: pat}, nil
+}
+
+// ProfileTokenFile returns the token file of the profile LoadCredentials
+// would use for the Jira instance at baseURL, or an empty string if no
+// profile is used. It fails if the profile reads its token from elsewhere. If
+// baseURL is empty, only a named profile is used, and its jiraBaseURL is not
+// checked.
+func ProfileTokenFile(log logr.Logger, baseURL, profile string) (string, error) {
+	p, err := resolveProfile(log, baseURL, profile)
+	if err != nil || p == nil {
+		return "", err
+	}
+	if p.TokenFile == "" {
+		return "", fmt.Errorf("profile for %s does not read its token from a tokenFile", p.JiraBaseURL)
+	}
+	return p.TokenFile, nil
+}
+
+// StoreProfileToken stores token in the token file of a profile, readable
+// only by the current user.
+func StoreProfileToken(path, token string) error {
+	return writePrivateFile(path, []byte(token+"\n"))
+}
+
+// resolveProfile returns the named profile, or if profile is empty, the
+// profile whose jiraBaseURL matches baseURL. It returns nil if no profile
+// matches.
+func resolveProfile(log logr.Logger, baseURL, profile string) (*Profile, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q not found", profile)
+		}
+		if baseURL != "" && !sameBaseURL(p.JiraBaseURL, baseURL) {
+			return nil, fmt.Errorf("profile %q is for %s, not %s", profile, p.JiraBaseURL, baseURL)
+		}
+		return &p, nil
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if baseURL != "" && sameBaseURL(profiles[name].JiraBaseURL, baseURL) {
+			log.V(1).Info("using matching credential profile", "profile", name)
+			p := profiles[name]
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+func loadProfiles() (map[string]Profile, error) {
+	path, err := xdg.SearchConfigFile(xdgProfilesFilePath)
+	if err != nil {
+		return nil, nil
+	}
+	if err := checkFilePermissions(path); err != nil {
+		return nil, fmt.Errorf("insecure profiles file %q: %v", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f profilesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode profiles file %q: %v", path, err)
+	}
+	for name, p := range f.Profiles {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %q: %v", name, err)
+		}
+	}
+	return f.Profiles, nil
+}
+
+func (p *Profile) validate() error {
+	var errs []error
+	switch p.Type {
+	case PATAuth, BearerAuth:
+	case BasicAuth:
+		if p.Username == "" {
+			errs = append(errs, errors.New("basic authentication requires a username"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown authentication type %q", p.Type))
+	}
+	sources := 0
+	for _, s := range []string{p.Token, p.TokenFile, p.TokenCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		errs = append(errs, errors.New("exactly one of token, tokenFile or tokenCommand must be specified"))
+	}
+	return newAggregateError(errs)
+}
+
+func (p *Profile) credentials(log logr.Logger) (*Credentials, error) {
+	token := p.Token
+	switch {
+	case p.TokenFile != "":
+		if err := checkFilePermissions(p.TokenFile); err != nil {
+			log.Error(err, "insecure token file, run 'chmod 600' on it", "path", p.TokenFile)
+		}
+		data, err := os.ReadFile(p.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	case p.TokenCommand != "":
+		var err error
+		if token, err = runTokenCommand(p.TokenCommand); err != nil {
+			return nil, err
+		}
+	}
+	return &Credentials{Type: p.Type, Username: p.Username, Token: token, TokenCommand: p.TokenCommand}, nil
+}
+
+// bearerTokenTransport authenticates requests with a bearer token, and if it
+// has a token command, runs it again for a fresh token when a request is
+// rejected as unauthorized.
+type bearerTokenTransport struct {
+	command string
+
+	mu    sync.Mutex
+	token string
+}
+
+func (t *bearerTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	token := t.token
+	t.mu.Unlock()
+
+	resp, err := t.send(req, token)
+	if err != nil || t.command == "" || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	fresh, err := t.refresh(token)
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(retry, fresh)
+}
+
+func (t *bearerTokenTransport) send(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// refresh returns a fresh token to replace the rejected one, running the
+// token command unless a concurrent request already replaced it.
+func (t *bearerTokenTransport) refresh(rejected string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != rejected {
+		return t.token, nil
+	}
+	token, err := runTokenCommand(t.command)
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token, nil
+}
+
+func sameBaseURL(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/"))
+}
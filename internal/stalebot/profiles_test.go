@@ -0,0 +1,203 @@
+package stalebot_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Credential profiles", func() {
+	var (
+		dir string
+		cfg *stalebot.Config
+	)
+	writeProfiles := func(content string) {
+		path := filepath.Join(dir, "jira-stalebot", "profiles.yaml")
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		GinkgoT().Setenv("XDG_CONFIG_HOME", dir)
+		GinkgoT().Setenv("JIRA_STALEBOT_PAT", "env-token")
+		xdg.Reload()
+		DeferCleanup(xdg.Reload)
+
+		cfg = &stalebot.Config{JiraBaseURL: "https://jira.example.com"}
+		writeProfiles(`
+profiles:
+  internal:
+    jiraBaseURL: https://jira.example.com/
+    type: pat
+    token: internal-token
+  partner:
+    jiraBaseURL: https://jira.partner.example.org
+    type: basic
+    username: stalebot
+    token: partner-password
+`)
+	})
+
+	Context("loading", func() {
+		It("uses the profile matching the config's base URL", func() {
+			Expect(stalebot.LoadCredentials(logr.Discard(), cfg, "")).To(Equal(&stalebot.Credentials{Type: stalebot.PATAuth, Token: "internal-token"}))
+		})
+		It("uses the selected profile", func() {
+			cfg.JiraBaseURL = "https://JIRA.partner.example.org/"
+			Expect(stalebot.LoadCredentials(logr.Discard(), cfg, "partner")).To(Equal(&stalebot.Credentials{Type: stalebot.BasicAuth, Username: "stalebot", Token: "partner-password"}))
+		})
+		It("refuses a selected profile for another instance", func() {
+			_, err := stalebot.LoadCredentials(logr.Discard(), cfg, "partner")
+			Expect(err).To(MatchError(`profile "partner" is for https://jira.partner.example.org, not https://jira.example.com`))
+		})
+		It("fails for an unknown profile", func() {
+			_, err := stalebot.LoadCredentials(logr.Discard(), cfg, "missing")
+			Expect(err).To(MatchError(`profile "missing" not found`))
+		})
+		It("falls back to the personal access token without a matching profile", func() {
+			cfg.JiraBaseURL = "https://jira.other.example.net"
+			Expect(stalebot.LoadCredentials(logr.Discard(), cfg, "")).To(Equal(&stalebot.Credentials{Type: stalebot.PATAuth, Token: "env-token"}))
+		})
+		It("reads the token from a token command", func() {
+			writeProfiles(`
+profiles:
+  internal:
+    jiraBaseURL: https://jira.example.com
+    type: bearer
+    tokenCommand: echo command-token
+`)
+			Expect(stalebot.LoadCredentials(logr.Discard(), cfg, "")).To(Equal(&stalebot.Credentials{Type: stalebot.BearerAuth, Token: "command-token", TokenCommand: "echo command-token"}))
+		})
+		It("rejects invalid profiles", func() {
+			writeProfiles(`
+profiles:
+  internal:
+    jiraBaseURL: https://jira.example.com
+    type: basic
+    token: static-token
+    tokenFile: /tmp/token
+`)
+			_, err := stalebot.LoadCredentials(logr.Discard(), cfg, "")
+			Expect(err).To(MatchError(And(
+				ContainSubstring(`invalid profile "internal"`),
+				ContainSubstring("basic authentication requires a username"),
+				ContainSubstring("exactly one of token, tokenFile or tokenCommand"),
+			)))
+		})
+		It("reads a static bearer token", func() {
+			writeProfiles(`
+profiles:
+  internal:
+    jiraBaseURL: https://jira.example.com
+    type: bearer
+    token: static-token
+`)
+			Expect(stalebot.LoadCredentials(logr.Discard(), cfg, "")).To(Equal(&stalebot.Credentials{Type: stalebot.BearerAuth, Token: "static-token"}))
+		})
+		It("rejects a profiles file readable by others", func() {
+			Expect(os.Chmod(filepath.Join(dir, "jira-stalebot", "profiles.yaml"), 0644)).To(Succeed())
+			_, err := stalebot.LoadCredentials(logr.Discard(), cfg, "")
+			Expect(err).To(MatchError(ContainSubstring("insecure profiles file")))
+		})
+	})
+
+	Context("token files", func() {
+		BeforeEach(func() {
+			writeProfiles(`
+profiles:
+  internal:
+    jiraBaseURL: https://jira.example.com
+    type: pat
+    tokenFile: ` + filepath.Join(dir, "internal-token") + `
+  partner:
+    jiraBaseURL: https://jira.partner.example.org
+    type: basic
+    username: stalebot
+    token: partner-password
+`)
+		})
+		It("resolves the token file of the profile matching the base URL", func() {
+			Expect(stalebot.ProfileTokenFile(logr.Discard(), cfg.JiraBaseURL, "")).To(Equal(filepath.Join(dir, "internal-token")))
+		})
+		It("resolves the token file of a selected profile without a base URL", func() {
+			Expect(stalebot.ProfileTokenFile(logr.Discard(), "", "internal")).To(Equal(filepath.Join(dir, "internal-token")))
+		})
+		It("resolves no token file without a matching profile", func() {
+			Expect(stalebot.ProfileTokenFile(logr.Discard(), "https://jira.other.example.net", "")).To(BeEmpty())
+		})
+		It("fails for a profile without a token file", func() {
+			_, err := stalebot.ProfileTokenFile(logr.Discard(), "", "partner")
+			Expect(err).To(MatchError(ContainSubstring("does not read its token from a tokenFile")))
+		})
+		It("stores a token that the profile's credentials read", func() {
+			Expect(stalebot.StoreProfileToken(filepath.Join(dir, "internal-token"), "stored-token")).To(Succeed())
+			Expect(stalebot.LoadCredentials(logr.Discard(), cfg, "")).To(Equal(&stalebot.Credentials{Type: stalebot.PATAuth, Token: "stored-token"}))
+		})
+	})
+
+	Context("authentication", func() {
+		var (
+			server  *httptest.Server
+			headers []string
+			valid   string
+		)
+		BeforeEach(func() {
+			headers = nil
+			valid = ""
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers = append(headers, r.Header.Get("Authorization"))
+				if valid != "" && r.Header.Get("Authorization") != valid {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			DeferCleanup(server.Close)
+		})
+		get := func(creds stalebot.Credentials) int {
+			resp, err := creds.HTTPClient().Get(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		It("sends basic credentials", func() {
+			Expect(get(stalebot.Credentials{Type: stalebot.BasicAuth, Username: "stalebot", Token: "password"})).To(Equal(http.StatusOK))
+			Expect(headers).To(Equal([]string{"Basic c3RhbGVib3Q6cGFzc3dvcmQ="}))
+		})
+		It("sends personal access tokens as bearer tokens", func() {
+			valid = "Bearer pat"
+			Expect(get(stalebot.Credentials{Type: stalebot.PATAuth, Token: "pat"})).To(Equal(http.StatusOK))
+			Expect(headers).To(Equal([]string{"Bearer pat"}))
+		})
+		It("does not refresh personal access tokens", func() {
+			valid = "Bearer fresh"
+			Expect(get(stalebot.Credentials{Type: stalebot.PATAuth, Token: "expired"})).To(Equal(http.StatusUnauthorized))
+			Expect(headers).To(Equal([]string{"Bearer expired"}))
+		})
+		It("does not refresh bearer tokens without a token command", func() {
+			valid = "Bearer fresh"
+			Expect(get(stalebot.Credentials{Type: stalebot.BearerAuth, Token: "expired"})).To(Equal(http.StatusUnauthorized))
+			Expect(headers).To(Equal([]string{"Bearer expired"}))
+		})
+		It("refreshes rejected bearer tokens with the token command", func() {
+			valid = "Bearer fresh"
+			creds := stalebot.Credentials{Type: stalebot.BearerAuth, Token: "expired", TokenCommand: "echo fresh"}
+			client := creds.HTTPClient()
+			for i := 0; i < 2; i++ {
+				resp, err := client.Post(server.URL, "application/json", strings.NewReader(`{}`))
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			}
+			Expect(headers).To(Equal([]string{"Bearer expired", "Bearer fresh", "Bearer fresh"}))
+		})
+	})
+})
@@ -0,0 +1,157 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+type promptDecision int
+
+const (
+	decisionSkip promptDecision = iota
+	decisionApprove
+	decisionQuit
+)
+
+const promptHelp = `  y - perform this operation
+  n - skip this operation (default)
+  a - perform this and all remaining operations of this type
+  s - skip this and all remaining operations of this type
+  q - stop without performing any more operations
+  o - print and open the issue in a browser
+  d - show days inactive and the last changelog entry
+`
+
+// prompter asks the user to confirm operations one at a time, remembering
+// decisions made for all remaining operations of a type.
+type prompter struct {
+	in      *lineReader
+	out     io.Writer
+	baseURL string
+	now     time.Time
+
+	approveAll map[Operation]bool
+	skipAll    map[Operation]bool
+
+	// answers holds the answer given for each prompted issue, keyed by issue key.
+	answers map[string]string
+
+	// performed, skipped and pending count the confirmed operations that were
+	// performed, the operations that were skipped, and the operations left
+	// when the user quit.
+	performed int
+	skipped   int
+	pending   int
+}
+
+func newPrompter(in io.Reader, out io.Writer, baseURL string, now time.Time) *prompter {
+	return &prompter{
+		in:         newLineReader(in),
+		out:        out,
+		baseURL:    baseURL,
+		now:        now,
+		approveAll: map[Operation]bool{},
+		skipAll:    map[Operation]bool{},
+		answers:    map[string]string{},
+	}
+}
+
+func (p *prompter) confirm(ctx context.Context, op Operation, issue *jira.Issue) (promptDecision, error) {
+	if p.approveAll[op] {
+		p.answers[issue.Key] = "a"
+		return decisionApprove, nil
+	}
+	if p.skipAll[op] {
+		p.answers[issue.Key] = "s"
+		return decisionSkip, nil
+	}
+
+	for {
+		msg := fmt.Sprintf("Perform operation %q on %s %s: %s?", op, issue.Fields.Type.Name, issue.Key, issue.Fields.Summary)
+		fmt.Fprintf(p.out, "%s [y/N/a/s/q/o/d/?]: ", msg)
+
+		response, err := p.in.next(ctx)
+		if err != nil {
+			fmt.Fprintf(p.out, "\n")
+			if err == io.EOF {
+				return decisionSkip, fmt.Errorf("read input from prompt: %v", err)
+			}
+			return decisionSkip, err
+		}
+
+		response = strings.ToLower(strings.TrimSpace(response))
+		switch response {
+		case "y", "yes":
+			p.answers[issue.Key] = "y"
+			return decisionApprove, nil
+		case "", "n", "no":
+			p.answers[issue.Key] = "n"
+			return decisionSkip, nil
+		case "a", "all":
+			p.answers[issue.Key] = "a"
+			p.approveAll[op] = true
+			return decisionApprove, nil
+		case "s", "skip":
+			p.answers[issue.Key] = "s"
+			p.skipAll[op] = true
+			return decisionSkip, nil
+		case "q", "quit":
+			p.answers[issue.Key] = "q"
+			return decisionQuit, nil
+		case "o", "open":
+			u := issueURL(p.baseURL, issue.Key)
+			fmt.Fprintln(p.out, u)
+			if err := openBrowser(u); err != nil {
+				fmt.Fprintf(p.out, "could not open browser: %v\n", err)
+			}
+		case "d", "details":
+			p.printDetails(issue)
+		default:
+			fmt.Fprint(p.out, promptHelp)
+		}
+	}
+}
+
+// printSummary prints what happened to the operations of a run the user quit.
+func (p *prompter) printSummary() {
+	fmt.Fprintf(p.out, "Stopped: %d performed, %d skipped, %d left pending\n", p.performed, p.skipped, p.pending)
+}
+
+func (p *prompter) printDetails(issue *jira.Issue) {
+	updated := time.Time(issue.Fields.Updated)
+	fmt.Fprintf(p.out, "  Days inactive: %d (last updated %s)\n", int(p.now.Sub(updated).Hours()/24), updated.Format("2006-01-02"))
+	if issue.Changelog == nil || len(issue.Changelog.Histories) == 0 {
+		fmt.Fprintln(p.out, "  Last change:   none")
+		return
+	}
+	h := issue.Changelog.Histories[len(issue.Changelog.Histories)-1]
+	fmt.Fprintf(p.out, "  Last change:   %s by %s\n", h.Created, h.Author.Name)
+	for _, item := range h.Items {
+		fmt.Fprintf(p.out, "    %s: %q -> %q\n", item.Field, item.FromString, item.ToString)
+	}
+}
+
+func issueURL(baseURL, key string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/browse/" + url.PathEscape(key)
+}
+
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,62 @@
+package stalebot
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prompt", func() {
+	var (
+		out    *bytes.Buffer
+		issue1 *jira.Issue
+		issue2 *jira.Issue
+	)
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		issue1 = &jira.Issue{Key: "TEST-1", Fields: &jira.IssueFields{}}
+		issue2 = &jira.Issue{Key: "TEST-2", Fields: &jira.IssueFields{}}
+	})
+
+	It("approves remaining operations of the same type after 'a'", func() {
+		p := newPrompter(strings.NewReader("a\n"), out, "https://jira.example.com", time.Now())
+		Expect(p.confirm(context.Background(), Close, issue1)).To(Equal(decisionApprove))
+		Expect(p.confirm(context.Background(), Close, issue2)).To(Equal(decisionApprove))
+		Expect(p.answers).To(Equal(map[string]string{"TEST-1": "a", "TEST-2": "a"}))
+	})
+	It("skips remaining operations of the same type after 's'", func() {
+		p := newPrompter(strings.NewReader("s\ny\n"), out, "https://jira.example.com", time.Now())
+		Expect(p.confirm(context.Background(), Close, issue1)).To(Equal(decisionSkip))
+		Expect(p.confirm(context.Background(), Close, issue2)).To(Equal(decisionSkip))
+		Expect(p.confirm(context.Background(), AddStaleLabel, issue2)).To(Equal(decisionApprove))
+	})
+	It("quits after 'q'", func() {
+		p := newPrompter(strings.NewReader("q\n"), out, "https://jira.example.com", time.Now())
+		Expect(p.confirm(context.Background(), Close, issue1)).To(Equal(decisionQuit))
+	})
+	It("shows details and prompts again after 'd'", func() {
+		issue1.Fields.Updated = jira.Time(time.Now().Add(-time.Hour * 24 * 10))
+		p := newPrompter(strings.NewReader("d\nn\n"), out, "https://jira.example.com", time.Now())
+		Expect(p.confirm(context.Background(), Close, issue1)).To(Equal(decisionSkip))
+		Expect(out.String()).To(ContainSubstring("Days inactive: 10"))
+	})
+	It("prints what was performed, skipped and left pending after 'q'", func() {
+		bot := &Stalebot{DryRun: true, Prompt: true, Logger: logr.Discard()}
+		bot.prompter = newPrompter(strings.NewReader("y\nn\nq\n"), out, "https://jira.example.com", time.Now())
+		pending := []PlannedOperation{}
+		for _, key := range []string{"TEST-1", "TEST-2", "TEST-3", "TEST-4"} {
+			pending = append(pending, PlannedOperation{Issue: jira.Issue{Key: key, Fields: &jira.IssueFields{}}, Operation: Close})
+		}
+		Expect(bot.performPending(context.Background(), pending)).To(Succeed())
+		Expect(out.String()).To(HaveSuffix("Stopped: 1 performed, 1 skipped, 2 left pending\n"))
+	})
+	It("builds issue URLs from the base URL", func() {
+		Expect(issueURL("https://jira.example.com/", "TEST-1")).To(Equal("https://jira.example.com/browse/TEST-1"))
+	})
+})
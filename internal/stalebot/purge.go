@@ -0,0 +1,331 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+// purgeFields are the issue fields fetched to plan a purge.
+var purgeFields = []string{"key", "issuetype", "summary", "labels", "status", "updated"}
+
+// PurgeOptions configures how Purge uninstalls stalebot from a project.
+type PurgeOptions struct {
+	// DeleteComments deletes the comments stalebot posted on purged issues.
+	DeleteComments bool
+	// ReopenWithin, if non-zero, reopens the issues stalebot closed within
+	// this duration.
+	ReopenWithin time.Duration
+	// ReopenStatus is the status reopened issues are transitioned to. It is
+	// required to reopen issues closed with the transition or move strategy.
+	// Issues closed with the archive strategy are reopened by removing the
+	// archive label.
+	ReopenStatus string
+}
+
+func (o PurgeOptions) validate(strategy CloseStrategy) error {
+	if o.ReopenWithin < 0 {
+		return fmt.Errorf("reopen window must not be negative")
+	}
+	if o.ReopenWithin > 0 && strategy != ArchiveStrategy && o.ReopenStatus == "" {
+		return fmt.Errorf("a reopen status is required to reopen issues closed with the %q strategy", strategy)
+	}
+	return nil
+}
+
+// PurgeReport describes the outcome of a purge.
+type PurgeReport struct {
+	DryRun bool
+
+	// Unlabeled lists the issues whose stale label was removed, and Reopened
+	// the issues that were reopened.
+	Unlabeled []ReportedIssue
+	Reopened  []ReportedIssue
+	// DeletedComments is the number of stalebot comments on the purged
+	// issues that were deleted.
+	DeletedComments int
+	// Skipped lists the issues with the stale label that stalebot did not
+	// add. They are left untouched.
+	Skipped  []ReportedIssue
+	Failures []OperationFailure
+}
+
+func (r *PurgeReport) recordOperation(baseURL string, issue *jira.Issue, op Operation, deletedComments int, err error) {
+	reported := reportedIssue(baseURL, issue)
+	if err != nil {
+		r.Failures = append(r.Failures, OperationFailure{ReportedIssue: reported, Operation: op, Error: err.Error()})
+		return
+	}
+	switch op {
+	case Purge:
+		r.Unlabeled = append(r.Unlabeled, reported)
+	case Reopen:
+		r.Reopened = append(r.Reopened, reported)
+	}
+	r.DeletedComments += deletedComments
+}
+
+// purgeState is the state of a purge in progress.
+type purgeState struct {
+	opts PurgeOptions
+	// account is the name of the user stalebot acts as. Only labels, comments
+	// and closes by this account are purged.
+	account string
+	report  *PurgeReport
+}
+
+// Purge uninstalls stalebot from the project. It removes the stale label from
+// all open issues that stalebot labeled, and optionally deletes stalebot's
+// comments and reopens the issues stalebot recently closed. Issues are only
+// touched if the changelog shows that stalebot's account added the stale
+// label or closed them. Operations are confirmed and performed like those of
+// a run, and are logged only in dry-run mode.
+//
+// The returned report is non-nil even if an operation fails.
+func (bot *Stalebot) Purge(ctx context.Context, now time.Time, opts PurgeOptions) (report *PurgeReport, purgeErr error) {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+	if err := bot.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid stalebot config: %v", err)
+	}
+	if err := opts.validate(bot.Config.CloseStrategy); err != nil {
+		return nil, fmt.Errorf("invalid purge options: %v", err)
+	}
+	if err := bot.identify(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, span := startSpan(ctx, "Purge", attrProject.String(bot.Config.Project), attrDryRun.Bool(bot.DryRun))
+	defer func() { endSpan(span, purgeErr) }()
+
+	bot.runID = now.UTC().Format(time.RFC3339)
+	bot.purge = &purgeState{opts: opts, account: bot.Config.account, report: &PurgeReport{DryRun: bot.DryRun}}
+	defer func() {
+		bot.purge = nil
+		if bot.Store != nil {
+			if err := bot.Store.Save(); err != nil {
+				bot.Logger.Error(err, "save state store")
+			}
+		}
+	}()
+	report = bot.purge.report
+
+	pending, err := bot.planPurge(ctx, now)
+	if err != nil {
+		return report, err
+	}
+	bot.Logger.Info("found issues to purge", "count", len(pending), "skipped", len(report.Skipped))
+
+	if bot.Prompt {
+		bot.prompter = newPrompter(os.Stdin, os.Stdout, bot.Config.JiraBaseURL, now)
+	}
+	return report, bot.performPending(ctx, pending)
+}
+
+// planPurge finds the issues to reopen and unlabel.
+func (bot *Stalebot) planPurge(ctx context.Context, now time.Time) ([]PlannedOperation, error) {
+	state := bot.purge
+	fields := purgeFields
+	if state.opts.DeleteComments {
+		fields = append(fields, "comment")
+	}
+
+	var plan []PlannedOperation
+	if within := state.opts.ReopenWithin; within > 0 {
+		closed, err := bot.searchAll(ctx, bot.Config.recentlyClosedQuery(within), fields)
+		if err != nil {
+			return nil, fmt.Errorf("search for recently closed issues: %v", err)
+		}
+		for _, issue := range closed {
+			if !bot.Config.closedBy(&issue, state.account, now.Add(-within)) {
+				bot.Logger.V(1).Info("issue was not recently closed by stalebot", "key", issue.Key)
+				continue
+			}
+			reason := fmt.Sprintf("issue was closed by stalebot in the last %s", describeDuration(within))
+			plan = append(plan, PlannedOperation{Issue: issue, Operation: Reopen, Reason: bot.purgeReason(&issue, reason)})
+		}
+	}
+
+	labeled, err := bot.searchAll(ctx, bot.Config.labeledIssuesQuery(), fields)
+	if err != nil {
+		return nil, fmt.Errorf("search for labeled issues: %v", err)
+	}
+	for _, issue := range labeled {
+		if !bot.Config.labeledBy(&issue, state.account) {
+			bot.Logger.Info("skipping issue not labeled by stalebot", "key", issue.Key)
+			state.report.Skipped = append(state.report.Skipped, reportedIssue(bot.Config.JiraBaseURL, &issue))
+			continue
+		}
+		plan = append(plan, PlannedOperation{Issue: issue, Operation: Purge, Reason: bot.purgeReason(&issue, "stale label was added by stalebot")})
+	}
+	return plan, nil
+}
+
+// purgeReason appends the number of comments that will be deleted to reason.
+func (bot *Stalebot) purgeReason(issue *jira.Issue, reason string) string {
+	if n := len(bot.purgedComments(issue)); n > 0 {
+		return fmt.Sprintf("%s, deleting %d stalebot comments", reason, n)
+	}
+	return reason
+}
+
+// labeledIssuesQuery returns the JQL query for open issues with the stale
+// label, or the previous stale label of a label migration. Archived issues are
+// closed as far as stalebot is concerned, so they are excluded.
+func (c *Config) labeledIssuesQuery() string {
+	ands := []string{
+		fmt.Sprintf("project = %s", c.Project),
+		"statusCategory != Done",
+		fmt.Sprintf("labels in (%s)", strings.Join(c.migrationLabels(), ", ")),
+	}
+	if c.CloseStrategy == ArchiveStrategy {
+		ands = append(ands, fmt.Sprintf("(labels != %s OR labels is EMPTY)", c.ArchiveLabel))
+	}
+	return completeQuery(ands)
+}
+
+// recentlyClosedQuery returns the JQL query for issues that are closed and
+// were updated within the given duration. It matches all issues stalebot
+// closed in that time, and possibly others.
+func (c *Config) recentlyClosedQuery(within time.Duration) string {
+	ands := []string{fmt.Sprintf("project = %s", c.Project)}
+	if c.CloseStrategy == ArchiveStrategy {
+		ands = append(ands, fmt.Sprintf("labels = %s", c.ArchiveLabel))
+	} else {
+		ands = append(ands, fmt.Sprintf("status = %q", c.CloseStatus))
+	}
+	ands = append(ands, fmt.Sprintf("updated >= -%dm", int(within/time.Minute)))
+	return completeQuery(ands)
+}
+
+// closedBy returns true if the last close of the issue was by account, and
+// not before since.
+func (c *Config) closedBy(i *jira.Issue, account string, since time.Time) bool {
+	if i.Changelog == nil {
+		return false
+	}
+	for idx := len(i.Changelog.Histories) - 1; idx >= 0; idx-- {
+		h := i.Changelog.Histories[idx]
+		if !c.closes(h) {
+			continue
+		}
+		t, err := h.CreatedTime()
+		return err == nil && h.Author.Name == account && !t.Before(since)
+	}
+	return false
+}
+
+// closes returns true if a changelog history performed the close step of the
+// close strategy.
+func (c *Config) closes(h jira.ChangelogHistory) bool {
+	if c.CloseStrategy == ArchiveStrategy {
+		return addsLabel(h, c.ArchiveLabel)
+	}
+	for _, item := range h.Items {
+		if item.Field == "status" && item.ToString == c.CloseStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// labeledBy returns true if the stale label, or the previous stale label of a
+// label migration, was last added to the issue by account.
+func (c *Config) labeledBy(i *jira.Issue, account string) bool {
+	idx := c.lastMarkIndex(i)
+	return idx >= 0 && i.Changelog.Histories[idx].Author.Name == account
+}
+
+// purgedComments returns the comments to delete from an issue: the comments
+// posted by stalebot's account that carry stalebot's comment prefix or a
+// comment marker. Other comments by the account are kept.
+func (bot *Stalebot) purgedComments(issue *jira.Issue) []*jira.Comment {
+	if !bot.purge.opts.DeleteComments || issue.Fields == nil || issue.Fields.Comments == nil {
+		return nil
+	}
+	var comments []*jira.Comment
+	for _, c := range issue.Fields.Comments.Comments {
+		if c != nil && c.Author.Name == bot.purge.account && isStalebotComment(c.Body) {
+			comments = append(comments, c)
+		}
+	}
+	return comments
+}
+
+// purgeIssue removes the stale label from an issue if stalebot added it, and
+// deletes stalebot's comments if requested. Like the other operations, it
+// checks the current state of the issue first, so that retrying a failed
+// purge only performs the remaining steps.
+func (bot *Stalebot) purgeIssue(ctx context.Context, issue *jira.Issue) error {
+	current, err := bot.currentIssue(ctx, issue)
+	if err != nil {
+		return err
+	}
+	for _, c := range bot.purgedComments(current) {
+		if err := bot.Client.Issue.DeleteComment(ctx, issue.ID, c.ID); err != nil {
+			return fmt.Errorf("delete comment %s: %v", c.ID, err)
+		}
+	}
+	if !bot.Config.labeledBy(issue, bot.purge.account) {
+		return nil
+	}
+	var upd update
+	for _, l := range bot.Config.migrationLabels() {
+		if hasLabel(current, l) {
+			upd.Labels = append(upd.Labels, labels{Remove: l})
+		}
+	}
+	if len(upd.Labels) == 0 {
+		return nil
+	}
+	resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, map[string]interface{}{"update": upd})
+	if err != nil {
+		return fmt.Errorf("remove stale label %q from issue: %v", bot.Config.StaleLabel, jira.NewJiraError(resp, err))
+	}
+	return nil
+}
+
+// reopenIssue reverts the close step of the close strategy, and then purges
+// the issue. Issues closed with the move strategy keep their clone in
+// MoveProject, and archived issues keep the value of ArchiveField.
+func (bot *Stalebot) reopenIssue(ctx context.Context, issue *jira.Issue) error {
+	current, err := bot.currentIssue(ctx, issue)
+	if err != nil {
+		return err
+	}
+	if bot.Config.isClosed(current) {
+		if err := bot.unclose(ctx, issue); err != nil {
+			return err
+		}
+	}
+	return bot.purgeIssue(ctx, issue)
+}
+
+func (bot *Stalebot) unclose(ctx context.Context, issue *jira.Issue) error {
+	if bot.Config.CloseStrategy == ArchiveStrategy {
+		reqBody := map[string]interface{}{"update": update{Labels: []labels{{Remove: bot.Config.ArchiveLabel}}}}
+		resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, reqBody)
+		if err != nil {
+			return fmt.Errorf("remove archive label %q from issue: %v", bot.Config.ArchiveLabel, jira.NewJiraError(resp, err))
+		}
+		return nil
+	}
+	status := bot.purge.opts.ReopenStatus
+	transitions, _, err := bot.Client.Issue.GetTransitions(ctx, issue.ID)
+	if err != nil {
+		return fmt.Errorf("get transitions for issue: %v", err)
+	}
+	tID, err := transitionID(transitions, status)
+	if err != nil {
+		return fmt.Errorf("get transition ID: %v", err)
+	}
+	if _, err := bot.Client.Issue.DoTransition(ctx, issue.ID, tID); err != nil {
+		return fmt.Errorf("transition to status %q: %v", status, err)
+	}
+	return nil
+}
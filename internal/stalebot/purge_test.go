@@ -0,0 +1,201 @@
+package stalebot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Purge", func() {
+	const jiraTimeFormat = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		now  time.Time
+		opts stalebot.PurgeOptions
+	)
+	history := func(author string, at time.Time, field, from, to string) map[string]interface{} {
+		return map[string]interface{}{
+			"author":  map[string]interface{}{"name": author},
+			"created": at.Format(jiraTimeFormat),
+			"items":   []interface{}{map[string]interface{}{"field": field, "fromString": from, "toString": to}},
+		}
+	}
+	comment := func(id, author, body string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "author": map[string]interface{}{"name": author}, "body": body}
+	}
+	issue := func(key string, status, category string, histories ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":  key,
+			"key": key,
+			"fields": map[string]interface{}{
+				"summary":   "Summary of " + key,
+				"issuetype": map[string]interface{}{"name": "Bug"},
+				"labels":    []string{"lifecycle-stale"},
+				"status":    map[string]interface{}{"name": status, "statusCategory": map[string]interface{}{"key": category}},
+			},
+			"changelog": map[string]interface{}{"histories": histories},
+		}
+	}
+	// calls returns the method and path of the requests that modify issues.
+	calls := func() []string {
+		var out []string
+		for _, r := range fake.Requests() {
+			if r.Method != http.MethodGet {
+				out = append(out, r.Method+" "+r.Path)
+			}
+		}
+		return out
+	}
+	// queries returns the JQL of the searches.
+	queries := func() []string {
+		var out []string
+		for _, r := range fake.Requests() {
+			if r.Path == "/rest/api/2/search" {
+				q, err := url.ParseQuery(r.Query)
+				Expect(err).NotTo(HaveOccurred())
+				out = append(out, q.Get("jql"))
+			}
+		}
+		return out
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+
+		labeled := issue("TEST-1", "New", "new", history("stalebot", now.Add(-10*day), "labels", "", "lifecycle-stale"))
+		labeled["fields"].(map[string]interface{})["comment"] = map[string]interface{}{"comments": []interface{}{
+			comment("11", "stalebot", "[STALEBOT COMMENT] This issue is stale."),
+			comment("12", "stalebot", "Ping from the stalebot account"),
+			comment("13", "jdoe", "Still relevant.{anchor:jira-stalebot-addstalelabel-1}"),
+		}}
+		open := []map[string]interface{}{
+			labeled,
+			issue("TEST-2", "New", "new", history("jdoe", now.Add(-10*day), "labels", "", "lifecycle-stale")),
+		}
+		closed := []map[string]interface{}{
+			issue("TEST-3", "Closed", "done",
+				history("stalebot", now.Add(-40*day), "labels", "", "lifecycle-stale"),
+				history("stalebot", now.Add(-2*day), "status", "New", "Closed"),
+			),
+			issue("TEST-4", "Closed", "done",
+				history("stalebot", now.Add(-60*day), "labels", "", "lifecycle-stale"),
+				history("stalebot", now.Add(-30*day), "status", "New", "Closed"),
+			),
+			issue("TEST-5", "Closed", "done",
+				history("stalebot", now.Add(-40*day), "labels", "", "lifecycle-stale"),
+				history("jdoe", now.Add(-1*day), "status", "New", "Closed"),
+			),
+		}
+		fake.Issues = append(open, closed...)
+		fake.Handlers["GET /rest/api/2/search"] = func(w http.ResponseWriter, r *http.Request) {
+			issues := closed
+			if strings.Contains(r.URL.Query().Get("jql"), "statusCategory != Done") {
+				issues = open
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"startAt": 0, "total": len(issues), "issues": issues})
+		}
+		fake.Handlers["GET /rest/api/2/issue/TEST-3/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"transitions": [{"id": "3", "name": "Reopen", "to": {"name": "Open"}}]}`))
+		}
+
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:  fake.URL,
+				Project:      "TEST",
+				CloseStatus:  "Closed",
+				StaleLabel:   "lifecycle-stale",
+				StaleAfter:   &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:   &stalebot.Duration{Duration: 10 * day},
+				ExemptLabels: []string{"lifecycle-frozen"},
+			},
+			Logger: logr.Discard(),
+		}
+		opts = stalebot.PurgeOptions{}
+	})
+
+	It("removes the stale label from issues labeled by stalebot", func() {
+		report, err := bot.Purge(context.Background(), now, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls()).To(Equal([]string{"PUT /rest/api/2/issue/TEST-1"}))
+		Expect(fake.Requests()).To(ContainElement(HaveField("Body", HaveKeyWithValue("update",
+			HaveKeyWithValue("labels", ConsistOf(HaveKeyWithValue("remove", "lifecycle-stale")))))))
+		Expect(report.Unlabeled).To(ConsistOf(HaveField("Key", "TEST-1")))
+		Expect(report.Skipped).To(ConsistOf(HaveField("Key", "TEST-2")))
+		Expect(report.Reopened).To(BeEmpty())
+		Expect(report.DeletedComments).To(BeZero())
+	})
+
+	It("deletes stalebot's comments", func() {
+		opts.DeleteComments = true
+		report, err := bot.Purge(context.Background(), now, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls()).To(Equal([]string{
+			"DELETE /rest/api/2/issue/TEST-1/comment/11",
+			"PUT /rest/api/2/issue/TEST-1",
+		}))
+		Expect(report.DeletedComments).To(Equal(1))
+	})
+
+	It("reopens issues stalebot closed within the reopen window", func() {
+		opts.ReopenWithin = 7 * day
+		opts.ReopenStatus = "Open"
+		report, err := bot.Purge(context.Background(), now, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls()).To(Equal([]string{
+			"POST /rest/api/2/issue/TEST-3/transitions",
+			"PUT /rest/api/2/issue/TEST-3",
+			"PUT /rest/api/2/issue/TEST-1",
+		}))
+		Expect(report.Reopened).To(ConsistOf(HaveField("Key", "TEST-3")))
+		Expect(report.Unlabeled).To(ConsistOf(HaveField("Key", "TEST-1")))
+	})
+
+	It("removes the previous stale label of a label migration", func() {
+		bot.Config.StaleLabel = "stale"
+		bot.Config.LabelMigration = &stalebot.LabelMigration{From: "lifecycle-stale", Until: "2000-02-01"}
+		_, err := bot.Purge(context.Background(), now, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries()).To(ContainElement(ContainSubstring("labels in (stale, lifecycle-stale)")))
+		Expect(fake.Requests()).To(ContainElement(HaveField("Body", HaveKeyWithValue("update",
+			HaveKeyWithValue("labels", ConsistOf(HaveKeyWithValue("remove", "lifecycle-stale")))))))
+	})
+
+	It("queries recently closed issues", func() {
+		bot.DryRun = true
+		_, err := bot.Purge(context.Background(), now, stalebot.PurgeOptions{ReopenWithin: 7 * day, ReopenStatus: "Open"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries()).To(ContainElement(`project = TEST AND status = "Closed" AND updated >= -10080m ORDER BY updatedDate DESC`))
+	})
+
+	It("requires a reopen status to reopen transitioned issues", func() {
+		opts.ReopenWithin = 7 * day
+		_, err := bot.Purge(context.Background(), now, opts)
+		Expect(err).To(MatchError(ContainSubstring("a reopen status is required")))
+	})
+
+	It("only reports the operations in dry-run mode", func() {
+		bot.DryRun = true
+		opts = stalebot.PurgeOptions{DeleteComments: true, ReopenWithin: 7 * day, ReopenStatus: "Open"}
+		report, err := bot.Purge(context.Background(), now, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls()).To(BeEmpty())
+		Expect(report.DryRun).To(BeTrue())
+		Expect(report.Reopened).To(ConsistOf(HaveField("Key", "TEST-3")))
+		Expect(report.Unlabeled).To(ConsistOf(HaveField("Key", "TEST-1")))
+		Expect(report.DeletedComments).To(Equal(1))
+	})
+})
@@ -0,0 +1,280 @@
+package stalebot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+const reviewHelp = `Commands:
+  l                  list planned operations matching the current filter
+  f <field>=<value>  filter by op, type or assignee (f alone clears the filter)
+  s <items>          select items (e.g. "s 1,3-5"; "s all" selects all listed)
+  u <items>          deselect items (e.g. "u 2"; "u all" deselects all listed)
+  d <item>           show details of an item
+  x                  execute the selected operations
+  q                  quit without executing anything
+  h                  show this help
+`
+
+// reviewFilter restricts the planned operations that are listed.
+type reviewFilter struct {
+	field string
+	value string
+}
+
+func (f reviewFilter) matches(p *PlannedOperation) bool {
+	switch f.field {
+	case "":
+		return true
+	case "op", "operation":
+		return strings.EqualFold(string(p.Operation), f.value)
+	case "type":
+		return strings.EqualFold(p.Issue.Fields.Type.Name, f.value)
+	case "assignee":
+		return strings.EqualFold(assigneeName(&p.Issue), f.value)
+	}
+	return false
+}
+
+func assigneeName(issue *jira.Issue) string {
+	if issue.Fields.Assignee == nil {
+		return "unassigned"
+	}
+	return issue.Fields.Assignee.Name
+}
+
+// lineReader reads lines from an input without blocking context cancellation.
+type lineReader struct {
+	lines chan string
+	errs  chan error
+}
+
+func newLineReader(in io.Reader) *lineReader {
+	r := &lineReader{lines: make(chan string), errs: make(chan error, 1)}
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			r.lines <- scanner.Text()
+		}
+		err := scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+		r.errs <- err
+	}()
+	return r
+}
+
+func (r *lineReader) next(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case line := <-r.lines:
+		return line, nil
+	case err := <-r.errs:
+		return "", err
+	}
+}
+
+// reviewOperations runs a line-based review session of the planned
+// operations, for when the full-screen review is unavailable, and returns the operations selected for execution. All
+// operations are initially selected. If the user quits, no operations are
+// returned.
+func reviewOperations(ctx context.Context, in io.Reader, out io.Writer, plan []PlannedOperation) ([]PlannedOperation, error) {
+	selected := make([]bool, len(plan))
+	for i := range selected {
+		selected[i] = true
+	}
+	filter := reviewFilter{}
+	reader := newLineReader(in)
+
+	listed := func() []int {
+		idxs := []int{}
+		for i := range plan {
+			if filter.matches(&plan[i]) {
+				idxs = append(idxs, i)
+			}
+		}
+		return idxs
+	}
+
+	fmt.Fprint(out, reviewHelp)
+	printReviewList(out, plan, selected, listed())
+	for {
+		fmt.Fprint(out, "review> ")
+		line, err := reader.next(ctx)
+		if err != nil {
+			fmt.Fprintln(out)
+			return nil, err
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "":
+		case "h", "help":
+			fmt.Fprint(out, reviewHelp)
+		case "l", "list":
+			printReviewList(out, plan, selected, listed())
+		case "f", "filter":
+			if arg == "" {
+				filter = reviewFilter{}
+			} else {
+				field, value, ok := strings.Cut(arg, "=")
+				if !ok || !(reviewFilter{field: field}).valid() {
+					fmt.Fprintf(out, "invalid filter %q\n", arg)
+					continue
+				}
+				filter = reviewFilter{field: field, value: value}
+			}
+			printReviewList(out, plan, selected, listed())
+		case "s", "select", "u", "unselect":
+			idxs, err := parseItems(arg, listed(), len(plan))
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			for _, i := range idxs {
+				selected[i] = cmd == "s" || cmd == "select"
+			}
+			printReviewList(out, plan, selected, listed())
+		case "d", "details":
+			idxs, err := parseItems(arg, nil, len(plan))
+			if err != nil || len(idxs) != 1 {
+				fmt.Fprintf(out, "invalid item %q\n", arg)
+				continue
+			}
+			printReviewDetails(out, &plan[idxs[0]])
+		case "x", "execute":
+			result := []PlannedOperation{}
+			for i := range plan {
+				if selected[i] {
+					result = append(result, plan[i])
+				}
+			}
+			return result, nil
+		case "q", "quit":
+			return nil, nil
+		default:
+			fmt.Fprintf(out, "unknown command %q (h for help)\n", cmd)
+		}
+	}
+}
+
+func (f reviewFilter) valid() bool {
+	switch f.field {
+	case "op", "operation", "type", "assignee":
+		return true
+	}
+	return false
+}
+
+// parseItems parses a comma-separated list of 1-based item numbers and ranges
+// into 0-based indexes. "all" expands to the listed indexes.
+func parseItems(arg string, listed []int, n int) ([]int, error) {
+	if arg == "all" {
+		return listed, nil
+	}
+	var idxs []int
+	for _, part := range strings.Split(arg, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("invalid item range %q", part)
+			}
+		}
+		if start < 1 || end > n || start > end {
+			return nil, fmt.Errorf("item %q out of range", part)
+		}
+		for i := start; i <= end; i++ {
+			idxs = append(idxs, i-1)
+		}
+	}
+	return idxs, nil
+}
+
+func printReviewList(out io.Writer, plan []PlannedOperation, selected []bool, listed []int) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSEL\tOPERATION\tKEY\tTYPE\tASSIGNEE\tUPDATED\tSUMMARY")
+	for _, i := range listed {
+		p := &plan[i]
+		mark := " "
+		if selected[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(w, "%d\t[%s]\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, mark, p.Operation, p.Issue.Key, p.Issue.Fields.Type.Name,
+			assigneeName(&p.Issue), time.Time(p.Issue.Fields.Updated).Format("2006-01-02"), p.Issue.Fields.Summary)
+	}
+	w.Flush()
+
+	count := 0
+	for _, s := range selected {
+		if s {
+			count++
+		}
+	}
+	fmt.Fprintf(out, "%d of %d operations selected\n", count, len(plan))
+}
+
+func printReviewDetails(out io.Writer, p *PlannedOperation) {
+	issue := &p.Issue
+	fmt.Fprintf(out, "%s %s: %s\n", issue.Fields.Type.Name, issue.Key, issue.Fields.Summary)
+	if issue.Fields.Status != nil {
+		fmt.Fprintf(out, "  Status:      %s\n", issue.Fields.Status.Name)
+	}
+	fmt.Fprintf(out, "  Assignee:    %s\n", assigneeName(issue))
+	fmt.Fprintf(out, "  Labels:      %s\n", strings.Join(issue.Fields.Labels, ", "))
+	fmt.Fprintf(out, "  Updated:     %s\n", time.Time(issue.Fields.Updated).Format(time.RFC1123))
+	fmt.Fprintf(out, "  Operation:   %s (%s)\n", p.Operation, p.Reason)
+	if issue.Changelog != nil && len(issue.Changelog.Histories) > 0 {
+		h := issue.Changelog.Histories[len(issue.Changelog.Histories)-1]
+		fields := make([]string, 0, len(h.Items))
+		for _, item := range h.Items {
+			fields = append(fields, item.Field)
+		}
+		fmt.Fprintf(out, "  Last change: %s by %s (%s)\n", h.Created, h.Author.Name, strings.Join(fields, ", "))
+	}
+	if issue.Fields.Description != "" {
+		fmt.Fprintf(out, "\n%s\n", issue.Fields.Description)
+	}
+}
+
+// executeReviewed performs the reviewed operations, reporting progress and
+// per-issue results. Unlike a regular run, a failed operation does not stop
+// the remaining operations; an error reporting the number of failed
+// operations is returned once all operations were attempted.
+func (bot *Stalebot) executeReviewed(ctx context.Context, out io.Writer, selected []PlannedOperation) error {
+	failed := 0
+	for i := range selected {
+		p := &selected[i]
+		fmt.Fprintf(out, "[%d/%d] %s %s ... ", i+1, len(selected), p.Operation, p.Issue.Key)
+		if err := ctx.Err(); err != nil {
+			fmt.Fprintf(out, "skipped: %v\n", err)
+			failed++
+			continue
+		}
+		if err := bot.perform(ctx, p); err != nil {
+			fmt.Fprintf(out, "failed: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Fprintln(out, "ok")
+	}
+	fmt.Fprintf(out, "%d succeeded, %d failed\n", len(selected)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d reviewed operations failed", failed, len(selected))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package stalebot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Review", func() {
+	var plan []stalebot.PlannedOperation
+	BeforeEach(func() {
+		plan = []stalebot.PlannedOperation{
+			{Issue: jira.Issue{Key: "TEST-1", Fields: &jira.IssueFields{Type: jira.IssueType{Name: "Bug"}}}, Operation: stalebot.AddStaleLabel},
+			{Issue: jira.Issue{Key: "TEST-2", Fields: &jira.IssueFields{Type: jira.IssueType{Name: "Story"}}}, Operation: stalebot.Close},
+			{Issue: jira.Issue{Key: "TEST-3", Fields: &jira.IssueFields{Type: jira.IssueType{Name: "Bug"}, Assignee: &jira.User{Name: "jdoe"}}}, Operation: stalebot.Close},
+		}
+	})
+
+	review := func(input string) []string {
+		selected, err := stalebot.ReviewOperations(context.Background(), strings.NewReader(input), &bytes.Buffer{}, plan)
+		Expect(err).NotTo(HaveOccurred())
+		keys := []string{}
+		for _, p := range selected {
+			keys = append(keys, p.Issue.Key)
+		}
+		return keys
+	}
+
+	It("selects all operations by default", func() {
+		Expect(review("x\n")).To(Equal([]string{"TEST-1", "TEST-2", "TEST-3"}))
+	})
+	It("deselects individual items and ranges", func() {
+		Expect(review("u 1-2\nx\n")).To(Equal([]string{"TEST-3"}))
+	})
+	It("deselects and selects groups by filter", func() {
+		Expect(review("u all\nf op=Close\ns all\nf assignee=jdoe\nu all\nx\n")).To(Equal([]string{"TEST-2"}))
+	})
+	It("executes nothing when the user quits", func() {
+		Expect(review("q\n")).To(BeEmpty())
+	})
+	It("returns an error when input ends before execution", func() {
+		_, err := stalebot.ReviewOperations(context.Background(), strings.NewReader("l\n"), &bytes.Buffer{}, plan)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("in a terminal", func() {
+		const (
+			up   = "\x1b[A"
+			down = "\x1b[B"
+		)
+		tui := func(input string) ([]string, string) {
+			out := &bytes.Buffer{}
+			selected, err := stalebot.RunReviewTUI(context.Background(), strings.NewReader(input), out, plan, 24)
+			Expect(err).NotTo(HaveOccurred())
+			keys := []string{}
+			for _, p := range selected {
+				keys = append(keys, p.Issue.Key)
+			}
+			return keys, out.String()
+		}
+		selectedKeys := func(input string) []string {
+			keys, _ := tui(input)
+			return keys
+		}
+
+		It("selects all operations by default", func() {
+			Expect(selectedKeys("x")).To(Equal([]string{"TEST-1", "TEST-2", "TEST-3"}))
+		})
+		It("toggles the item under the cursor", func() {
+			Expect(selectedKeys(down + down + " " + up + " x")).To(Equal([]string{"TEST-1"}))
+		})
+		It("deselects and selects groups by filter", func() {
+			// o filters by AddStaleLabel, then Close; w by the first assignee, jdoe.
+			Expect(selectedKeys("noo" + "a" + "w" + "nx")).To(Equal([]string{"TEST-2"}))
+		})
+		It("shows the details of the item under the cursor", func() {
+			plan[1].Issue.Fields.Description = "Steps to reproduce"
+			_, out := tui(down + "\r" + "\x1b" + "q")
+			Expect(out).To(ContainSubstring("Story TEST-2: \r\n"))
+			Expect(out).To(ContainSubstring("Steps to reproduce"))
+		})
+		It("executes nothing when the user quits", func() {
+			keys, out := tui("\x03")
+			Expect(keys).To(BeEmpty())
+			Expect(out).To(ContainSubstring("3 of 3 operations selected"))
+		})
+		It("returns an error when input ends before execution", func() {
+			_, err := stalebot.RunReviewTUI(context.Background(), strings.NewReader("j"), &bytes.Buffer{}, plan, 24)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("executing the reviewed operations", func() {
+		var (
+			bot *stalebot.Stalebot
+			out *bytes.Buffer
+		)
+		BeforeEach(func() {
+			// The server serves marked issues and rejects every change to TEST-1.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key := path.Base(r.URL.Path)
+				switch {
+				case r.Method == http.MethodGet:
+					fmt.Fprintf(w, `{"id": %q, "key": %q, "fields": {"labels": ["lifecycle-stale"]}}`, key, key)
+				case key == "TEST-1":
+					w.WriteHeader(http.StatusInternalServerError)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			DeferCleanup(server.Close)
+			client, err := jira.NewClient(server.URL, server.Client())
+			Expect(err).NotTo(HaveOccurred())
+			bot = &stalebot.Stalebot{
+				Client: client,
+				Config: stalebot.Config{JiraBaseURL: server.URL, StaleLabel: "lifecycle-stale"},
+				Logger: logr.Discard(),
+			}
+			out = &bytes.Buffer{}
+			plan = []stalebot.PlannedOperation{
+				{Issue: jira.Issue{ID: "TEST-1", Key: "TEST-1", Fields: &jira.IssueFields{Labels: []string{"lifecycle-stale"}}}, Operation: stalebot.RemoveStaleLabel},
+				{Issue: jira.Issue{ID: "TEST-2", Key: "TEST-2", Fields: &jira.IssueFields{Labels: []string{"lifecycle-stale"}}}, Operation: stalebot.RemoveStaleLabel},
+			}
+		})
+		It("performs all operations and reports failures", func() {
+			err := bot.ExecuteReviewed(context.Background(), out, plan)
+			Expect(err).To(MatchError("1 of 2 reviewed operations failed"))
+			Expect(out.String()).To(ContainSubstring("[2/2] RemoveStaleLabel TEST-2 ... ok"))
+			Expect(out.String()).To(ContainSubstring("1 succeeded, 1 failed"))
+		})
+		It("succeeds when all operations succeed", func() {
+			Expect(bot.ExecuteReviewed(context.Background(), out, plan[1:])).To(Succeed())
+		})
+	})
+})
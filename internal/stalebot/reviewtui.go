@@ -0,0 +1,314 @@
+package stalebot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+const reviewTUIHelp = "↑/↓ move  space toggle  a/n select/deselect listed  o/t/w filter by op/type/assignee  c clear filter  enter details  x execute  q quit"
+
+// reviewPlan lets the user review the planned operations and returns the
+// operations selected for execution. If stdin and stdout are terminals, the
+// review is a full-screen list of the operations with a detail view.
+// Otherwise, it falls back to line-based commands.
+func reviewPlan(ctx context.Context, plan []PlannedOperation) ([]PlannedOperation, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return reviewOperations(ctx, os.Stdin, os.Stdout, plan)
+	}
+	_, height, err := term.GetSize(out)
+	if err != nil {
+		return nil, fmt.Errorf("get terminal size: %v", err)
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, fmt.Errorf("enter raw terminal mode: %v", err)
+	}
+	defer func() { _ = term.Restore(in, state) }()
+	return runReviewTUI(ctx, os.Stdin, os.Stdout, plan, height)
+}
+
+// Keys of the review TUI that are not printable characters.
+const (
+	keyUp    = "up"
+	keyDown  = "down"
+	keyLeft  = "left"
+	keyRight = "right"
+	keyEnter = "enter"
+	keyEsc   = "esc"
+	keyQuit  = "ctrl-c"
+)
+
+// keyReader reads key presses from a terminal in raw mode without blocking
+// context cancellation.
+type keyReader struct {
+	keys chan string
+	errs chan error
+}
+
+func newKeyReader(in io.Reader) *keyReader {
+	r := &keyReader{keys: make(chan string), errs: make(chan error, 1)}
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			for _, k := range parseKeys(buf[:n]) {
+				r.keys <- k
+			}
+			if err != nil {
+				r.errs <- err
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (r *keyReader) next(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case k := <-r.keys:
+		return k, nil
+	case err := <-r.errs:
+		return "", err
+	}
+}
+
+// parseKeys splits input read from a terminal in raw mode into keys. Arrow
+// keys arrive as escape sequences, which terminals write in a single chunk.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case len(b) >= 3 && b[0] == 0x1b && (b[1] == '[' || b[1] == 'O'):
+			switch b[2] {
+			case 'A':
+				keys = append(keys, keyUp)
+			case 'B':
+				keys = append(keys, keyDown)
+			case 'C':
+				keys = append(keys, keyRight)
+			case 'D':
+				keys = append(keys, keyLeft)
+			}
+			b = b[3:]
+			continue
+		case b[0] == 0x1b:
+			keys = append(keys, keyEsc)
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, keyEnter)
+		case b[0] == 0x03:
+			keys = append(keys, keyQuit)
+		default:
+			keys = append(keys, string(b[0]))
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// reviewTUI is the state of a full-screen review session.
+type reviewTUI struct {
+	plan     []PlannedOperation
+	selected []bool
+	filter   reviewFilter
+	// cursor is the position of the highlighted item among the listed ones.
+	cursor int
+	// offset is the position of the first listed item on screen.
+	offset int
+	detail bool
+	height int
+}
+
+func (t *reviewTUI) listed() []int {
+	idxs := []int{}
+	for i := range t.plan {
+		if t.filter.matches(&t.plan[i]) {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// rows is the number of list items that fit on screen, below the header and
+// above the footer.
+func (t *reviewTUI) rows() int {
+	if t.height < 5 {
+		return 1
+	}
+	return t.height - 4
+}
+
+// filterValue returns the value of a filter field for an operation.
+func filterValue(field string, p *PlannedOperation) string {
+	switch field {
+	case "op":
+		return string(p.Operation)
+	case "type":
+		return p.Issue.Fields.Type.Name
+	}
+	return assigneeName(&p.Issue)
+}
+
+// cycleFilter filters by the next value of field among the planned
+// operations, or clears the filter after the last value.
+func (t *reviewTUI) cycleFilter(field string) {
+	values := []string{}
+	seen := map[string]bool{}
+	for i := range t.plan {
+		if v := filterValue(field, &t.plan[i]); !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	next := 0
+	if t.filter.field == field {
+		next = sort.SearchStrings(values, t.filter.value) + 1
+	}
+	if next < len(values) {
+		t.filter = reviewFilter{field: field, value: values[next]}
+	} else {
+		t.filter = reviewFilter{}
+	}
+	t.cursor, t.offset = 0, 0
+}
+
+// handle updates the state for a key press. It returns true and the selected
+// operations once the session ends; they are nil if the user quit.
+func (t *reviewTUI) handle(key string) (bool, []PlannedOperation) {
+	if key == keyQuit {
+		return true, nil
+	}
+	if t.detail {
+		switch key {
+		case keyEsc, keyLeft, keyEnter, "h", "q":
+			t.detail = false
+		}
+		return false, nil
+	}
+
+	listed := t.listed()
+	switch key {
+	case keyUp, "k":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case keyDown, "j":
+		if t.cursor < len(listed)-1 {
+			t.cursor++
+		}
+	case " ":
+		if len(listed) > 0 {
+			t.selected[listed[t.cursor]] = !t.selected[listed[t.cursor]]
+		}
+	case "a", "n":
+		for _, i := range listed {
+			t.selected[i] = key == "a"
+		}
+	case "o":
+		t.cycleFilter("op")
+	case "t":
+		t.cycleFilter("type")
+	case "w":
+		t.cycleFilter("assignee")
+	case "c":
+		t.filter = reviewFilter{}
+		t.cursor, t.offset = 0, 0
+	case keyEnter, keyRight, "l":
+		t.detail = len(listed) > 0
+	case "x":
+		result := []PlannedOperation{}
+		for i := range t.plan {
+			if t.selected[i] {
+				result = append(result, t.plan[i])
+			}
+		}
+		return true, result
+	case "q":
+		return true, nil
+	}
+
+	if t.cursor < t.offset {
+		t.offset = t.cursor
+	} else if t.cursor >= t.offset+t.rows() {
+		t.offset = t.cursor - t.rows() + 1
+	}
+	return false, nil
+}
+
+// render draws the current view. Lines end in "\r\n", since the terminal
+// does not translate newlines in raw mode.
+func (t *reviewTUI) render(out io.Writer) {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H\x1b[2J")
+	listed := t.listed()
+
+	if t.detail {
+		printReviewDetails(&buf, &t.plan[listed[t.cursor]])
+		buf.WriteString("\nesc back\n")
+	} else {
+		count := 0
+		for _, s := range t.selected {
+			if s {
+				count++
+			}
+		}
+		filter := "none"
+		if t.filter.field != "" {
+			filter = t.filter.field + "=" + t.filter.value
+		}
+		fmt.Fprintf(&buf, "%d of %d operations selected, filter: %s\n\n", count, len(t.plan), filter)
+
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "  SEL\tOPERATION\tKEY\tTYPE\tASSIGNEE\tSUMMARY")
+		for pos := t.offset; pos < len(listed) && pos < t.offset+t.rows(); pos++ {
+			p := &t.plan[listed[pos]]
+			cursor, mark := " ", " "
+			if pos == t.cursor {
+				cursor = ">"
+			}
+			if t.selected[listed[pos]] {
+				mark = "x"
+			}
+			fmt.Fprintf(w, "%s [%s]\t%s\t%s\t%s\t%s\t%s\n", cursor, mark, p.Operation, p.Issue.Key, p.Issue.Fields.Type.Name, assigneeName(&p.Issue), p.Issue.Fields.Summary)
+		}
+		w.Flush()
+		buf.WriteString(reviewTUIHelp + "\n")
+	}
+	_, _ = io.WriteString(out, strings.ReplaceAll(buf.String(), "\n", "\r\n"))
+}
+
+// runReviewTUI runs a full-screen review session of the planned operations
+// on a terminal in raw mode with the given height, and returns the operations
+// selected for execution. All operations are initially selected. If the user
+// quits, no operations are returned.
+func runReviewTUI(ctx context.Context, in io.Reader, out io.Writer, plan []PlannedOperation, height int) ([]PlannedOperation, error) {
+	t := &reviewTUI{plan: plan, selected: make([]bool, len(plan)), height: height}
+	for i := range t.selected {
+		t.selected[i] = true
+	}
+	keys := newKeyReader(in)
+	// The screen is cleared when the session ends, so that the progress of
+	// the execution is printed on a clean screen.
+	defer func() { _, _ = io.WriteString(out, "\x1b[H\x1b[2J") }()
+	for {
+		t.render(out)
+		key, err := keys.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if done, selected := t.handle(key); done {
+			return selected, nil
+		}
+	}
+}
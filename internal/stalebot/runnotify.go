@@ -0,0 +1,202 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+const (
+	runNotificationTimeout = 30 * time.Second
+
+	defaultRunSubject = `[{{.Project}}] stalebot run {{if .Failed}}failed{{else}}succeeded{{end}}{{if .DryRun}} (dry run){{end}}`
+	defaultRunBody    = `Processed {{.Processed}} issues in {{.Duration}}: {{.Marked}} marked stale, {{.Unmarked}} unmarked, {{len .Closed}} closed.
+{{- if .Closed}}
+
+Closed issues:
+{{range .Closed}}
+- [{{.Key}}]({{.URL}}) {{.Summary}}
+{{- end}}
+{{- end}}
+{{- if .Failures}}
+
+Failures:
+{{range .Failures}}
+- [{{.Key}}]({{.URL}}) {{.Operation}}: {{.Error}}
+{{- end}}
+{{- end}}
+{{- if .Error}}
+
+Run error: {{.Error}}
+{{- end}}
+`
+)
+
+// RunNotificationsConfig configures the notifications posted after each run.
+type RunNotificationsConfig struct {
+	// OnlyOnFailure and OnlyOnClose restrict notifications to runs that
+	// failed, or that closed issues. If both are set, runs that meet either
+	// condition are notified.
+	OnlyOnFailure bool `json:"onlyOnFailure,omitempty"`
+	OnlyOnClose   bool `json:"onlyOnClose,omitempty"`
+
+	// Subject and Template are text/template templates of the notification's
+	// subject and Markdown body, executed with a RunReport.
+	Subject  string `json:"subject,omitempty"`
+	Template string `json:"template,omitempty"`
+
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+func (c *RunNotificationsConfig) setDefaults() {
+	if c.Subject == "" {
+		c.Subject = defaultRunSubject
+	}
+	if c.Template == "" {
+		c.Template = defaultRunBody
+	}
+}
+
+func (c *RunNotificationsConfig) validate() error {
+	var errs []error
+	if len(c.Notifiers) == 0 {
+		errs = append(errs, fmt.Errorf("at least one notifier is required"))
+	}
+	if _, err := c.Render(&RunReport{}); err != nil {
+		errs = append(errs, err)
+	}
+	for _, n := range c.Notifiers {
+		if err := n.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return newAggregateError(errs)
+}
+
+// RunReport describes the outcome of a run.
+type RunReport struct {
+	RunID     string
+	Project   string
+	Start     time.Time
+	End       time.Time
+	Duration  time.Duration
+	DryRun    bool
+	Processed int
+
+	// Operations counts the operations performed successfully (or logged, in
+	// dry-run mode).
+	Operations map[Operation]int
+	Marked     int
+	Unmarked   int
+	Closed     []ReportedIssue
+	Failures   []OperationFailure
+
+	// Error is the error that stopped the run, if any.
+	Error string
+}
+
+// ReportedIssue is an issue listed in a run report.
+type ReportedIssue struct {
+	Key     string
+	Summary string
+	URL     string
+}
+
+// OperationFailure is an operation that failed during a run.
+type OperationFailure struct {
+	ReportedIssue
+	Operation Operation
+	Error     string
+}
+
+// Failed returns true if the run or any of its operations failed.
+func (r *RunReport) Failed() bool {
+	return r.Error != "" || len(r.Failures) > 0
+}
+
+func (r *RunReport) recordOperation(baseURL string, issue *jira.Issue, op Operation, err error) {
+	reported := reportedIssue(baseURL, issue)
+	if err != nil {
+		r.Failures = append(r.Failures, OperationFailure{ReportedIssue: reported, Operation: op, Error: err.Error()})
+		return
+	}
+	r.Operations[op]++
+	switch op {
+	case AddStaleLabel:
+		r.Marked++
+	case RemoveStaleLabel:
+		r.Unmarked++
+	case Close:
+		r.Closed = append(r.Closed, reported)
+	}
+}
+
+func reportedIssue(baseURL string, issue *jira.Issue) ReportedIssue {
+	reported := ReportedIssue{Key: issue.Key, URL: issueURL(baseURL, issue.Key)}
+	if issue.Fields != nil {
+		reported.Summary = issue.Fields.Summary
+	}
+	return reported
+}
+
+// Render renders the run notification message.
+func (c *RunNotificationsConfig) Render(r *RunReport) (Message, error) {
+	subject, err := executeTemplate("subject", c.Subject, r)
+	if err != nil {
+		return Message{}, err
+	}
+	body, err := executeTemplate("template", c.Template, r)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: subject, Body: body, Data: r}, nil
+}
+
+// shouldNotify returns true if the run should be notified.
+func (c *RunNotificationsConfig) shouldNotify(r *RunReport) bool {
+	if !c.OnlyOnFailure && !c.OnlyOnClose {
+		return true
+	}
+	return (c.OnlyOnFailure && r.Failed()) || (c.OnlyOnClose && len(r.Closed) > 0)
+}
+
+// notifyRun posts the run report with each configured notifier. Notification
+// failures are logged, but do not fail the run.
+func (bot *Stalebot) notifyRun(summary RunSummary) {
+	cfg := bot.Config.RunNotifications
+	if cfg == nil || bot.report == nil {
+		return
+	}
+	report := bot.report
+	report.End = summary.End
+	report.Duration = summary.End.Sub(summary.Start).Round(time.Second)
+	report.Processed = summary.Processed
+	report.Error = summary.Error
+	if !cfg.shouldNotify(report) {
+		bot.Logger.V(1).Info("skipping run notification", "onlyOnFailure", cfg.OnlyOnFailure, "onlyOnClose", cfg.OnlyOnClose)
+		return
+	}
+
+	msg, err := cfg.Render(report)
+	if err != nil {
+		bot.Logger.Error(err, "render run notification")
+		return
+	}
+	// The run's context may have been cancelled, which should not prevent
+	// reporting the run.
+	ctx, cancel := context.WithTimeout(context.Background(), runNotificationTimeout)
+	defer cancel()
+	for _, nc := range cfg.Notifiers {
+		n, err := NewNotifier(nc)
+		if err == nil {
+			err = n.Notify(ctx, msg)
+		}
+		if err != nil {
+			bot.Logger.Error(err, "send run notification", "notifier", nc.Type)
+			continue
+		}
+		bot.Logger.V(1).Info("sent run notification", "notifier", nc.Type)
+	}
+}
@@ -0,0 +1,150 @@
+package stalebot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Run notifications", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake     *jiratest.Server
+		webhook  *httptest.Server
+		mu       sync.Mutex
+		payloads []map[string]interface{}
+		bot      *stalebot.Stalebot
+		now      = time.Now()
+	)
+	issue := func(key string, updated time.Time, labels ...string) map[string]interface{} {
+		var histories []interface{}
+		for _, l := range labels {
+			histories = append(histories, map[string]interface{}{
+				"author":  map[string]interface{}{"name": "stalebot"},
+				"created": updated.Format(jiraTime),
+				"items":   []interface{}{map[string]interface{}{"field": "labels", "toString": l}},
+			})
+		}
+		return map[string]interface{}{
+			"id":  key,
+			"key": key,
+			"fields": map[string]interface{}{
+				"summary": "Issue " + key,
+				"updated": updated.Format(jiraTime),
+				"labels":  append([]string{}, labels...),
+				"status":  map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+			"changelog": map[string]interface{}{"histories": histories},
+		}
+	}
+	received := func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return payloads
+	}
+
+	BeforeEach(func() {
+		payloads = nil
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&p)).To(Succeed())
+			mu.Lock()
+			payloads = append(payloads, p)
+			mu.Unlock()
+		}))
+		DeferCleanup(webhook.Close)
+
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(fmt.Sprintf(`jiraBaseURL: https://jira.example.com
+project: TEST
+closeStatus: Closed
+staleAfter: 30d
+closeAfter: 10d
+exemptLabels: [lifecycle-frozen]
+runNotifications:
+  notifiers:
+  - type: webhook
+    url: %s
+    format: json
+`, webhook.URL)), 0600)).To(Succeed())
+		cfg, err := stalebot.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		bot = &stalebot.Stalebot{Client: fake.JiraClient(), Config: *cfg, DryRun: true, Logger: logr.Discard()}
+		fake.Issues = append(fake.Issues,
+			issue("TEST-1", now.Add(-100*day)),
+			issue("TEST-2", now.Add(-20*day), bot.Config.StaleLabel),
+		)
+	})
+
+	It("posts a run summary", func() {
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		p := received()[0]
+		Expect(p["subject"]).To(Equal("[TEST] stalebot run succeeded (dry run)"))
+		Expect(p["text"]).To(MatchRegexp(`^Processed 2 issues in \S+: 1 marked stale, 0 unmarked, 1 closed\.\n\nClosed issues:\n\n- \[TEST-2\]\(https://jira.example.com/browse/TEST-2\) Issue TEST-2\n$`))
+		Expect(p["data"]).To(HaveKeyWithValue("Operations", map[string]interface{}{"AddStaleLabel": 1.0, "Close": 1.0}))
+	})
+	It("reports failed operations", func() {
+		bot.DryRun = false
+		fake.Issues = fake.Issues[:1]
+		fake.Handlers["PUT /rest/api/2/issue/TEST-1"] = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"errorMessages": ["boom"]}`, http.StatusInternalServerError)
+		}
+		Expect(bot.Run(context.Background())).NotTo(Succeed())
+		Expect(received()).To(HaveLen(1))
+		p := received()[0]
+		Expect(p["subject"]).To(Equal("[TEST] stalebot run failed"))
+		Expect(p["text"]).To(ContainSubstring("Failures:\n\n- [TEST-1](https://jira.example.com/browse/TEST-1) AddStaleLabel: add stale label"))
+		Expect(p["text"]).To(ContainSubstring("Run error: operation \"AddStaleLabel\" failed on issue \"TEST-1\""))
+	})
+	It("records the performed operations in the run history", func() {
+		store, err := stalebot.OpenStore(filepath.Join(GinkgoT().TempDir(), "state.json"))
+		Expect(err).NotTo(HaveOccurred())
+		bot.Store = store
+		bot.DryRun = false
+		fake.Handlers["PUT /rest/api/2/issue/TEST-1"] = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"errorMessages": ["boom"]}`, http.StatusInternalServerError)
+		}
+		Expect(bot.Run(context.Background())).NotTo(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0]["data"]).To(HaveKeyWithValue("Operations", BeEmpty()))
+		Expect(store.Runs()).To(HaveLen(1))
+		Expect(store.Runs()[0].Operations).To(BeEmpty())
+	})
+	It("posts only failed runs if onlyOnFailure is set", func() {
+		bot.Config.RunNotifications.OnlyOnFailure = true
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(received()).To(BeEmpty())
+	})
+	It("posts runs that closed issues if onlyOnClose is set", func() {
+		bot.Config.RunNotifications.OnlyOnClose = true
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+
+		fake.Issues = fake.Issues[:1]
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+	})
+	It("renders custom templates", func() {
+		bot.Config.RunNotifications.Subject = "{{.Project}}"
+		bot.Config.RunNotifications.Template = "{{range .Closed}}{{.Key}}{{end}}"
+		bot.Config.RunNotifications.Notifiers[0].Format = stalebot.SlackFormat
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(received()).To(Equal([]map[string]interface{}{{"text": "*TEST*\n\nTEST-2"}}))
+	})
+})
@@ -0,0 +1,105 @@
+package stalebot
+
+import (
+	"reflect"
+	"strings"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// enumValues lists the allowed values of the config's enumerated types.
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(FieldActionType("")): {
+		string(Unassign), string(ClearSprint), string(SetPriority),
+		string(DecrementPriority), string(AddComponent), string(SetCustomField),
+	},
+	reflect.TypeOf(CloseStrategy("")): {
+		string(TransitionStrategy), string(ArchiveStrategy), string(MoveStrategy),
+	},
+	reflect.TypeOf(ActivitySource("")): {
+		string(UpdatedActivity), string(CommentsActivity), string(ChangelogActivity),
+	},
+	reflect.TypeOf(VisibilityType("")): {
+		string(RoleVisibility), string(GroupVisibility),
+	},
+	reflect.TypeOf(DigestGrouping("")): {
+		string(GroupByAssignee), string(GroupByComponentLead),
+	},
+	reflect.TypeOf(NotifierType("")): {
+		string(SMTPNotifier), string(WebhookNotifier), string(FileNotifier),
+	},
+	reflect.TypeOf(WebhookFormat("")): {
+		string(SlackFormat), string(MattermostFormat), string(TeamsFormat), string(JSONFormat),
+	},
+	reflect.TypeOf(TraceExporter("")): {
+		string(OTLPExporter), string(StdoutExporter), string(FileExporter),
+	},
+}
+
+// JSONSchema returns a JSON Schema describing the config file format, for use
+// by editors to validate and autocomplete config files.
+func JSONSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = "jira-stalebot config"
+
+	// The include key is handled by LoadConfig rather than decoded into Config.
+	schema["properties"].(map[string]interface{})["include"] = map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+	return schema
+}
+
+// durationPattern matches the formats accepted by ParseDuration.
+const durationPattern = `^([0-9]+[dw]|P.+|[-+]?([0-9]*(\.[0-9]*)?[a-zµ]+)+)$`
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(Duration{}) {
+		return map[string]interface{}{"type": "string", "pattern": durationPattern}
+	}
+	if values, ok := enumValues[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = typeSchema(f.Type)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,302 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// simulatedAuthor is the author of the changelog histories synthesized for
+// simulated operations.
+const simulatedAuthor = "jira-stalebot-simulation"
+
+// SimulationReport summarizes the operations a simulation would have
+// performed.
+type SimulationReport struct {
+	From time.Time
+	To   time.Time
+	Step time.Duration
+
+	Issues   int
+	Marked   int
+	Unmarked int
+	Closed   int
+
+	// FalsePositives are the keys of issues that would have been closed, but
+	// later received real activity.
+	FalsePositives []string
+
+	// Periods breaks the operations down by calendar month, or by step if the
+	// steps are longer than the shortest month.
+	Periods []SimulationPeriod
+	// Monthly is true if the periods are calendar months.
+	Monthly bool
+}
+
+// maxMonthlyStep is the longest step whose operations are broken down by
+// calendar month. Longer steps would leave months without a step.
+const maxMonthlyStep = 28 * 24 * time.Hour
+
+// SimulationPeriod holds the operation counts of a single period.
+type SimulationPeriod struct {
+	Start    time.Time
+	Marked   int
+	Unmarked int
+	Closed   int
+}
+
+// Simulate replays the stalebot lifecycle against the history of the
+// project's issues, stepping from from to to, and reports the operations that
+// would have been performed. Real stale label changes are ignored, and
+// replaced with simulated ones. Comments, hierarchy and issue links are not
+// part of the reconstructed history, so they do not count as activity.
+func (bot *Stalebot) Simulate(ctx context.Context, from, to time.Time, step time.Duration) (*SimulationReport, error) {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("end of simulation must be after its start")
+	}
+
+	jql := fmt.Sprintf("project = %s AND created <= %q ORDER BY key ASC", bot.Config.Project, to.Format("2006-01-02 15:04"))
+	fields := append(bot.Config.SearchFields(), "created")
+	if err := bot.identify(ctx); err != nil {
+		return nil, err
+	}
+	bot.Logger.Info("querying jira", "jql", jql)
+	issues, err := bot.searchAll(ctx, jql, fields)
+	if err != nil {
+		return nil, fmt.Errorf("search for issues: %v", err)
+	}
+
+	// Jira only reports the category of each issue's current status, so
+	// historical status categories are looked up by status name.
+	categories := map[string]string{}
+	for _, i := range issues {
+		if i.Fields.Status != nil {
+			categories[i.Fields.Status.Name] = i.Fields.Status.StatusCategory.Key
+		}
+	}
+
+	// The changes synthesized by the simulation are not human activity.
+	cfg := bot.Config
+	cfg.simulation = true
+
+	report := &SimulationReport{From: from, To: to, Step: step, Issues: len(issues), Monthly: step <= maxMonthlyStep}
+	periods := map[time.Time]*SimulationPeriod{}
+	period := func(t time.Time) *SimulationPeriod {
+		// Operations are only performed at steps, so each step starts its
+		// own period if periods are not monthly.
+		start := t
+		if report.Monthly {
+			start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		}
+		if _, ok := periods[start]; !ok {
+			periods[start] = &SimulationPeriod{Start: start}
+		}
+		return periods[start]
+	}
+
+	for i := range issues {
+		sim := newIssueSimulation(&issues[i], bot.Config.StaleLabel, categories)
+		for t := from; !t.After(to); t = t.Add(step) {
+			if sim.closedAt != nil {
+				break
+			}
+			snapshot, ok := sim.snapshot(t)
+			if !ok {
+				continue
+			}
+			switch cfg.IssueOperation(t, snapshot, nil) {
+			case AddStaleLabel:
+				sim.mark(t, true)
+				report.Marked++
+				period(t).Marked++
+			case RemoveStaleLabel:
+				sim.mark(t, false)
+				report.Unmarked++
+				period(t).Unmarked++
+			case Close:
+				closedAt := t
+				sim.closedAt = &closedAt
+				report.Closed++
+				period(t).Closed++
+				if sim.activityAfter(t) {
+					report.FalsePositives = append(report.FalsePositives, issues[i].Key)
+				}
+			}
+		}
+	}
+
+	for _, p := range periods {
+		report.Periods = append(report.Periods, *p)
+	}
+	sort.Slice(report.Periods, func(i, j int) bool { return report.Periods[i].Start.Before(report.Periods[j].Start) })
+	return report, nil
+}
+
+type timedHistory struct {
+	at      time.Time
+	history jira.ChangelogHistory
+}
+
+// issueSimulation reconstructs the historical state of an issue, overlaid
+// with the simulated stale label changes.
+type issueSimulation struct {
+	issue      *jira.Issue
+	staleLabel string
+	categories map[string]string
+
+	created time.Time
+	// real holds the issue's changelog, oldest first, without stale label
+	// changes.
+	real []timedHistory
+	// simulated holds the synthesized stale label changes, oldest first.
+	simulated []timedHistory
+	stale     bool
+	closedAt  *time.Time
+}
+
+func newIssueSimulation(issue *jira.Issue, staleLabel string, categories map[string]string) *issueSimulation {
+	sim := &issueSimulation{
+		issue:      issue,
+		staleLabel: staleLabel,
+		categories: categories,
+		created:    time.Time(issue.Fields.Created),
+	}
+	if issue.Changelog != nil {
+		for _, h := range issue.Changelog.Histories {
+			if changesLabel(h, staleLabel) {
+				continue
+			}
+			at, err := h.CreatedTime()
+			if err != nil {
+				continue
+			}
+			sim.real = append(sim.real, timedHistory{at: at, history: h})
+		}
+	}
+	sort.SliceStable(sim.real, func(i, j int) bool { return sim.real[i].at.Before(sim.real[j].at) })
+	return sim
+}
+
+// changesLabel returns true if the history adds or removes label.
+func changesLabel(h jira.ChangelogHistory, label string) bool {
+	for _, item := range h.Items {
+		if item.Field == "labels" {
+			from := sets.NewString(strings.Fields(item.FromString)...)
+			to := sets.NewString(strings.Fields(item.ToString)...)
+			if from.Has(label) != to.Has(label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshot returns the issue as it would have been at t. It returns false if
+// the issue did not exist yet at t.
+func (s *issueSimulation) snapshot(t time.Time) (*jira.Issue, bool) {
+	if s.created.After(t) {
+		return nil, false
+	}
+
+	labels := s.fieldAt(t, "labels", strings.Join(s.issue.Fields.Labels, " "))
+	labelSet := sets.NewString(strings.Fields(labels)...)
+	labelSet.Delete(s.staleLabel)
+	if s.stale {
+		labelSet.Insert(s.staleLabel)
+	}
+
+	status := &jira.Status{}
+	if s.issue.Fields.Status != nil {
+		*status = *s.issue.Fields.Status
+	}
+	status.Name = s.fieldAt(t, "status", status.Name)
+	status.StatusCategory = jira.StatusCategory{Key: s.categories[status.Name]}
+
+	updated := s.created
+	var histories []timedHistory
+	for _, h := range s.real {
+		if h.at.After(t) {
+			break
+		}
+		histories = append(histories, h)
+	}
+	for _, h := range s.simulated {
+		if h.at.After(t) {
+			break
+		}
+		histories = append(histories, h)
+	}
+	sort.SliceStable(histories, func(i, j int) bool { return histories[i].at.Before(histories[j].at) })
+	changelog := &jira.Changelog{}
+	for _, h := range histories {
+		changelog.Histories = append(changelog.Histories, h.history)
+		if h.at.After(updated) {
+			updated = h.at
+		}
+	}
+
+	fields := *s.issue.Fields
+	fields.Labels = labelSet.List()
+	fields.Status = status
+	fields.Updated = jira.Time(updated)
+	return &jira.Issue{ID: s.issue.ID, Key: s.issue.Key, Fields: &fields, Changelog: changelog}, true
+}
+
+// fieldAt returns the value of a field at t, given its current value, by
+// finding the first change of the field after t.
+func (s *issueSimulation) fieldAt(t time.Time, field, current string) string {
+	for _, h := range s.real {
+		if !h.at.After(t) {
+			continue
+		}
+		for _, item := range h.history.Items {
+			if item.Field == field {
+				return item.FromString
+			}
+		}
+	}
+	return current
+}
+
+// mark records a simulated stale label change at t.
+func (s *issueSimulation) mark(t time.Time, stale bool) {
+	s.stale = stale
+	s.simulated = append(s.simulated, timedHistory{at: t, history: staleLabelHistory(t, s.staleLabel, stale)})
+}
+
+// staleLabelHistory synthesizes a changelog history that adds or removes the
+// stale label at t.
+func staleLabelHistory(t time.Time, staleLabel string, add bool) jira.ChangelogHistory {
+	item := jira.ChangelogItems{Field: "labels"}
+	if add {
+		item.ToString = staleLabel
+	} else {
+		item.FromString = staleLabel
+	}
+	return jira.ChangelogHistory{
+		Author:  jira.User{Name: simulatedAuthor},
+		Created: t.Format("2006-01-02T15:04:05.000-0700"),
+		Items:   []jira.ChangelogItems{item},
+	}
+}
+
+// activityAfter returns true if the issue had real activity after t.
+func (s *issueSimulation) activityAfter(t time.Time) bool {
+	for _, h := range s.real {
+		if h.at.After(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package stalebot_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Simulate", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		from = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+		to   = time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC)
+	)
+	issue := func(key string, histories ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":  key,
+			"key": key,
+			"fields": map[string]interface{}{
+				"created": from.Format(jiraTime),
+				"updated": from.Format(jiraTime),
+				"labels":  []string{},
+				"status":  map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+			"changelog": map[string]interface{}{"histories": histories},
+		}
+	}
+	history := func(at time.Time, field, fromString, toString string) map[string]interface{} {
+		return map[string]interface{}{
+			"author":  map[string]interface{}{"name": "jdoe"},
+			"created": at.Format(jiraTime),
+			"items":   []map[string]interface{}{{"field": field, "fromString": fromString, "toString": toString}},
+		}
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				Project:      "TEST",
+				StaleAfter:   &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:   &stalebot.Duration{Duration: 10 * day},
+				StaleLabel:   "lifecycle-stale",
+				ExemptLabels: []string{"lifecycle-frozen"},
+			},
+			Logger: logr.Discard(),
+		}
+	})
+
+	It("marks and closes inactive issues", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-1"))
+		report, err := bot.Simulate(context.Background(), from, to, day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Marked).To(Equal(1))
+		Expect(report.Closed).To(Equal(1))
+		Expect(report.FalsePositives).To(BeEmpty())
+		Expect(report.Periods).To(HaveLen(2))
+		Expect(report.Periods[0].Marked).To(Equal(1))
+		Expect(report.Periods[1].Closed).To(Equal(1))
+	})
+	It("breaks operations down by step for steps longer than a month", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-1"))
+		report, err := bot.Simulate(context.Background(), from, from.Add(6*30*day), 30*day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Monthly).To(BeFalse())
+		Expect(report.Periods).To(ConsistOf(
+			stalebot.SimulationPeriod{Start: from.Add(30 * day), Marked: 1},
+			stalebot.SimulationPeriod{Start: from.Add(60 * day), Closed: 1},
+		))
+	})
+	It("unmarks issues with activity after they were marked", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-1", history(from.Add(35*day), "summary", "a", "b")))
+		report, err := bot.Simulate(context.Background(), from, from.Add(40*day), day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Marked).To(Equal(1))
+		Expect(report.Unmarked).To(Equal(1))
+		Expect(report.Closed).To(Equal(0))
+	})
+	It("reports closed issues with later activity as false positives", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-1", history(from.Add(60*day), "summary", "a", "b")))
+		report, err := bot.Simulate(context.Background(), from, to, day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Closed).To(Equal(1))
+		Expect(report.FalsePositives).To(Equal([]string{"TEST-1"}))
+	})
+	It("reconstructs exempt labels that were added later", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-1", history(from.Add(50*day), "labels", "", "lifecycle-frozen")))
+		fake.Issues[0]["fields"].(map[string]interface{})["labels"] = []string{"lifecycle-frozen"}
+		report, err := bot.Simulate(context.Background(), from, to, day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Marked).To(Equal(1))
+		Expect(report.Closed).To(Equal(1))
+	})
+	It("ignores issues while they are done", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-1", history(from.Add(5*day), "status", "New", "Closed")))
+		fake.Issues = append(fake.Issues, issue("TEST-2"))
+		fake.Issues[1]["fields"].(map[string]interface{})["status"] = map[string]interface{}{"name": "Closed", "statusCategory": map[string]interface{}{"key": "done"}}
+		fake.Issues[0]["fields"].(map[string]interface{})["status"] = map[string]interface{}{"name": "Closed", "statusCategory": map[string]interface{}{"key": "done"}}
+		report, err := bot.Simulate(context.Background(), from, to, day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Marked).To(Equal(0))
+	})
+})
@@ -1,9 +1,10 @@
 package stalebot
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -17,10 +18,40 @@ type Stalebot struct {
 	Config Config
 	DryRun bool
 	Prompt bool
+	// Review, if set, plans all operations and lets the user review and select
+	// them in a full-screen terminal UI before any are performed. If stdin or
+	// stdout is not a terminal, the review falls back to line-based commands.
+	Review bool
 	Logger logr.Logger
+
+	// Store, if set, records issue lifecycle events and a summary of the run.
+	Store *Store
+
+	priorities []jira.Priority
+	runID      string
+	report     *RunReport
+	purge      *purgeState
+	// previous holds the previous values of the fields mutated by the
+	// operation being performed, to be recorded with its event.
+	previous map[string]string
+	// prompter, if set, confirms each operation before it is performed. It is
+	// only set when Prompt is, since it reads from the terminal.
+	prompter *prompter
+	// stopped is set once the user asked to stop performing operations.
+	stopped bool
+	// performing is the depth of nested performPending calls, which cascade
+	// closes make.
+	performing int
+	// separateComments is set once the instance rejected a comment in an
+	// issue update, so that comments are posted separately from then on.
+	separateComments bool
+	// separateTransitionUpdates is set once the instance rejected a comment
+	// in a close transition, so that closes transition without one from then
+	// on.
+	separateTransitionUpdates bool
 }
 
-func (bot *Stalebot) Run(ctx context.Context) error {
+func (bot *Stalebot) Run(ctx context.Context) (runErr error) {
 	if bot.Client == nil {
 		panic("stalebot requires a client: client is nil")
 	}
@@ -28,85 +59,298 @@ func (bot *Stalebot) Run(ctx context.Context) error {
 	if err := bot.Config.Validate(); err != nil {
 		return fmt.Errorf("invalid stalebot config: %v", err)
 	}
+	if err := bot.checkCommentVisibility(ctx); err != nil {
+		return fmt.Errorf("invalid comment visibility: %v", err)
+	}
 
-	eligibleIssuesQuery := bot.Config.EligibleIssuesQuery()
-	last := 0
 	now := time.Now()
+	bot.runID = now.UTC().Format(time.RFC3339)
 	processed := 0
-	opCounts := map[Operation]int{}
+
+	ctx, span := startSpan(ctx, "Run", attrProject.String(bot.Config.Project), attrDryRun.Bool(bot.DryRun))
+	defer func() {
+		span.SetAttributes(attrProcessed.Int(processed))
+		endSpan(span, runErr)
+	}()
+	var promptAnswers map[string]string
+
+	bot.report = &RunReport{
+		RunID:      bot.runID,
+		Project:    bot.Config.Project,
+		Start:      now,
+		DryRun:     bot.DryRun,
+		Operations: map[Operation]int{},
+	}
+	defer func() {
+		summary := RunSummary{
+			ID:         bot.runID,
+			Start:      now,
+			End:        time.Now(),
+			Project:    bot.Config.Project,
+			DryRun:     bot.DryRun,
+			Processed:  processed,
+			Operations: bot.report.Operations,
+			Answers:    promptAnswers,
+		}
+		if runErr != nil {
+			summary.Error = runErr.Error()
+		}
+		if bot.Store != nil {
+			bot.Store.RecordRun(summary)
+			if err := bot.Store.Save(); err != nil {
+				bot.Logger.Error(err, "save state store")
+			}
+		}
+		bot.notifyRun(summary)
+	}()
+
+	plan, err := bot.Plan(ctx, now)
+	if err != nil {
+		return err
+	}
+	processed = len(plan)
+	pending := make([]PlannedOperation, 0, len(plan))
+	for _, p := range plan {
+		if p.Operation == None {
+			bot.Logger.V(1).Info("no operation", "key", p.Issue.Key, "reason", p.Reason)
+			continue
+		}
+		pending = append(pending, p)
+	}
+	bot.Logger.Info("found eligible issues", "count", processed)
+
+	if bot.Review {
+		selected, err := reviewPlan(ctx, pending)
+		if err != nil {
+			return fmt.Errorf("review operations: %v", err)
+		}
+		if err := bot.executeReviewed(ctx, os.Stdout, selected); err != nil {
+			return err
+		}
+	} else {
+		if bot.Prompt {
+			bot.prompter = newPrompter(os.Stdin, os.Stdout, bot.Config.JiraBaseURL, now)
+			promptAnswers = bot.prompter.answers
+		}
+		if err := bot.performPending(ctx, pending); err != nil {
+			return err
+		}
+	}
+
+	performed := bot.report.Operations
+	bot.Logger.Info("performed operations", string(AddStaleLabel), performed[AddStaleLabel], string(RemoveStaleLabel), performed[RemoveStaleLabel], string(Close), performed[Close])
+	return nil
+}
+
+// identify looks up stalebot's own account, whose changes are not human
+// activity, unless it is already known.
+func (bot *Stalebot) identify(ctx context.Context) error {
+	if bot.Config.account != "" {
+		return nil
+	}
+	self, resp, err := bot.Client.User.GetSelf(ctx)
+	if err != nil {
+		return fmt.Errorf("get stalebot account: %v", jira.NewJiraError(resp, err))
+	}
+	bot.Config.account = self.Name
+	return nil
+}
+
+// performPending performs the pending operations in order, asking for
+// confirmation of each if prompting is enabled. It performs no operations
+// once the user asked to stop, and prints a summary of the operations
+// performed, skipped and left pending when the outermost call returns.
+func (bot *Stalebot) performPending(ctx context.Context, pending []PlannedOperation) error {
+	bot.performing++
+	defer func() {
+		bot.performing--
+		if bot.performing == 0 && bot.stopped {
+			bot.prompter.printSummary()
+		}
+	}()
+	for i := range pending {
+		if bot.stopped {
+			bot.prompter.pending += len(pending) - i
+			return nil
+		}
+		p := &pending[i]
+		if bot.Prompt && bot.prompter != nil {
+			decision, err := bot.prompter.confirm(ctx, p.Operation, &p.Issue)
+			if err != nil {
+				return fmt.Errorf("confirm operation: %v", err)
+			}
+			switch decision {
+			case decisionSkip:
+				bot.prompter.skipped++
+				continue
+			case decisionQuit:
+				bot.Logger.Info("stopping at user request", "remaining", len(pending)-i)
+				bot.prompter.pending += len(pending) - i
+				bot.stopped = true
+				return nil
+			}
+		}
+		if err := bot.perform(ctx, p); err != nil {
+			return err
+		}
+		if bot.Prompt && bot.prompter != nil {
+			bot.prompter.performed++
+		}
+	}
+	return nil
+}
+
+// PlannedOperation is the operation determined for an eligible issue.
+type PlannedOperation struct {
+	Issue     jira.Issue
+	Operation Operation
+	Reason    string
+	Relatives *Relatives
+}
+
+// Plan fetches all eligible issues and determines the operation for each of
+// them, without performing any operation.
+func (bot *Stalebot) Plan(ctx context.Context, now time.Time) ([]PlannedOperation, error) {
+	fields := bot.Config.SearchFields()
+	if bot.Review {
+		fields = append(fields, "description")
+	}
+	return bot.plan(ctx, now, fields)
+}
+
+// plan is Plan, fetching the given fields of eligible issues.
+func (bot *Stalebot) plan(ctx context.Context, now time.Time, fields []string) (plan []PlannedOperation, err error) {
+	ctx, span := startSpan(ctx, "Plan", attrProject.String(bot.Config.Project))
+	defer func() {
+		span.SetAttributes(attrProcessed.Int(len(plan)))
+		endSpan(span, err)
+	}()
+
+	if err := bot.identify(ctx); err != nil {
+		return nil, err
+	}
+	eligibleIssuesQuery := bot.Config.EligibleIssuesQuery()
+	last := 0
 
 	bot.Logger.Info("querying jira", "jql", eligibleIssuesQuery)
 	for {
 		opt := &jira.SearchOptions{
 			MaxResults: 1000, // Max results can go up to 1000
 			StartAt:    last,
-			Fields:     []string{"key,issuetype,summary,labels,status,changelog,updated"},
+			Fields:     fields,
 			Expand:     "changelog",
 		}
 
 		chunk, resp, err := bot.Client.Issue.Search(ctx, eligibleIssuesQuery, opt)
 		if err != nil {
-			return fmt.Errorf("search for eligible issues: %v", err)
+			return nil, fmt.Errorf("search for eligible issues: %v", err)
+		}
+
+		relatives, err := bot.fetchRelatives(ctx, chunk)
+		if err != nil {
+			return nil, fmt.Errorf("fetch related issues: %v", err)
 		}
 
 		for _, issue := range chunk {
-			issueLogger := bot.Logger.WithValues("key", issue.Key)
-			op := bot.Config.IssueOperation(now, &issue)
-			opCounts[op] += 1
+			op, reason := bot.Config.ExplainIssueOperation(now, &issue, relatives[issue.Key])
+			plan = append(plan, PlannedOperation{
+				Issue:     issue,
+				Operation: op,
+				Reason:    reason,
+				Relatives: relatives[issue.Key],
+			})
+		}
 
-			if op == None {
-				continue
-			}
+		total := resp.Total
+		last = resp.StartAt + len(chunk)
+		if len(chunk) == 0 || last >= total {
+			break
+		}
+	}
+	return plan, nil
+}
 
-			if bot.Prompt {
-				confirmed, err := promptToConfirm(ctx, op, &issue)
-				if err != nil {
-					return fmt.Errorf("confirm operation: %v", err)
-				}
-				if !confirmed {
-					continue
-				}
-			}
+// perform performs a planned operation, or logs it in dry-run mode.
+func (bot *Stalebot) perform(ctx context.Context, p *PlannedOperation) (performErr error) {
+	ctx, span := startSpan(ctx, "perform "+string(p.Operation), attrIssueKey.String(p.Issue.Key), attrOperation.String(string(p.Operation)))
+	defer func() { endSpan(span, performErr) }()
 
-			if bot.DryRun {
-				issueLogger.Info("dry-run operation", "op", op)
-				continue
-			}
+	issueLogger := bot.Logger.WithValues("key", p.Issue.Key, "reason", p.Reason)
+	op := p.Operation
+	if bot.DryRun {
+		issueLogger.Info("dry-run operation", "op", op)
+		bot.recordEvent(p.Issue.Key, op, p.Reason, nil)
+		bot.recordOperation(&p.Issue, op, nil)
+		return nil
+	}
 
-			issueLogger.Info("performing operation", "op", op)
-			var err error
-			switch op {
-			case None:
-				continue
-			case AddStaleLabel:
-				err = bot.addStaleLabel(ctx, &issue)
-			case RemoveStaleLabel:
-				err = bot.removeStaleLabel(ctx, &issue)
-			case Close:
-				err = bot.closeIssue(ctx, &issue)
-			}
-			if err != nil {
-				return fmt.Errorf("operation %q failed on issue %q: %v", op, issue.Key, err)
-			}
-			issueLogger.Info("operation succeeded", "op", op)
+	issueLogger.Info("performing operation", "op", op)
+	var err error
+	switch op {
+	case None:
+		return nil
+	case AddStaleLabel:
+		err = bot.addStaleLabel(ctx, &p.Issue)
+	case RemoveStaleLabel:
+		err = bot.removeStaleLabel(ctx, &p.Issue)
+	case Close:
+		err = bot.closeIssue(ctx, &p.Issue)
+	case Purge:
+		err = bot.purgeIssue(ctx, &p.Issue)
+	case Reopen:
+		err = bot.reopenIssue(ctx, &p.Issue)
+	case MigrateLabel:
+		err = bot.migrateLabel(ctx, &p.Issue)
+	}
+	bot.recordEvent(p.Issue.Key, op, p.Reason, err)
+	bot.recordOperation(&p.Issue, op, err)
+	if err != nil {
+		return fmt.Errorf("operation %q failed on issue %q: %v", op, p.Issue.Key, err)
+	}
+	issueLogger.Info("operation succeeded", "op", op)
 
+	if op == Close {
+		if err := bot.cascadeClose(ctx, &p.Issue, p.Relatives); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		processed += len(chunk)
+func (bot *Stalebot) recordEvent(key string, op Operation, reason string, err error) {
+	previous := bot.previous
+	bot.previous = nil
+	if bot.Store == nil || bot.DryRun {
+		return
+	}
+	e := Event{
+		Time:      time.Now(),
+		RunID:     bot.runID,
+		Key:       key,
+		Operation: op,
+		Reason:    reason,
+		Previous:  previous,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	bot.Store.RecordEvent(e)
+}
 
-		total := resp.Total
-		last = resp.StartAt + len(chunk)
-		if last >= total {
-			break
-		}
+func (bot *Stalebot) recordOperation(issue *jira.Issue, op Operation, err error) {
+	if bot.purge != nil {
+		bot.purge.report.recordOperation(bot.Config.JiraBaseURL, issue, op, len(bot.purgedComments(issue)), err)
 	}
-	bot.Logger.Info("found eligible issues", "count", processed)
-	bot.Logger.Info("operations", string(AddStaleLabel), opCounts[AddStaleLabel], string(RemoveStaleLabel), opCounts[RemoveStaleLabel], string(Close), opCounts[Close])
-	return nil
+	if bot.report == nil {
+		return
+	}
+	bot.report.recordOperation(bot.Config.JiraBaseURL, issue, op, err)
 }
 
 type update struct {
-	Labels []labels `json:"labels" structs:"labels"`
+	Labels     []labels          `json:"labels,omitempty" structs:"labels,omitempty"`
+	Components []componentUpdate `json:"components,omitempty" structs:"components,omitempty"`
+	Comment    []commentUpdate   `json:"comment,omitempty" structs:"comment,omitempty"`
 }
 
 type labels struct {
@@ -114,96 +358,215 @@ type labels struct {
 	Remove string `json:"remove,omitempty" structs:"remove"`
 }
 
+type componentUpdate struct {
+	Add *jira.Component `json:"add,omitempty" structs:"add"`
+}
+
+type commentUpdate struct {
+	Add commentAdd `json:"add" structs:"add"`
+}
+
+type commentAdd struct {
+	Body       string                  `json:"body" structs:"body"`
+	Visibility *jira.CommentVisibility `json:"visibility,omitempty" structs:"visibility,omitempty"`
+}
+
+// addStaleLabel marks an issue stale. The mark comment is posted with the
+// label update in a single request where possible. Otherwise, it is posted
+// before the label is added, so that a run retrying after a failed label
+// update finds the comment by its marker instead of posting it again.
 func (bot *Stalebot) addStaleLabel(ctx context.Context, issue *jira.Issue) error {
-	if _, _, err := bot.Client.Issue.AddComment(ctx, issue.ID, &jira.Comment{Body: bot.Config.MarkComment}); err != nil {
-		return fmt.Errorf("add mark comment to issue: %v", err)
+	current, err := bot.currentIssue(ctx, issue)
+	if err != nil {
+		return err
+	}
+	if bot.Config.isMarked(current, time.Now()) {
+		bot.Logger.Info("issue is already marked stale", "key", issue.Key)
+		return nil
+	}
+
+	mutations, err := bot.fieldMutations(ctx, current, bot.Config.MarkActions)
+	if err != nil {
+		return fmt.Errorf("compute mark actions: %v", err)
 	}
 
-	reqBody := map[string]interface{}{"update": update{Labels: []labels{{Add: bot.Config.StaleLabel}}}}
-	resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, reqBody)
+	cycle := bot.Config.markCycles(issue) + 1
+	markComment, err := bot.Config.renderMarkComment(cycle)
 	if err != nil {
-		return fmt.Errorf("add stale label %q to issue: %v", bot.Config.StaleLabel, jira.NewJiraError(resp, err))
+		return fmt.Errorf("render mark comment: %v", err)
+	}
+	comment := pendingComment(current, withNote(markComment, mutations.previousValuesNote()), commentMarker(AddStaleLabel, cycle))
+
+	upd := update{Labels: []labels{{Add: bot.Config.StaleLabel}}, Components: mutations.Components}
+	if err := bot.updateIssueWithComment(ctx, issue.ID, upd, mutations.Fields, comment); err != nil {
+		return fmt.Errorf("add stale label %q to issue: %v", bot.Config.StaleLabel, err)
+	}
+	if len(mutations.Previous) > 0 {
+		bot.previous = mutations.Previous
+		bot.Logger.Info("applied mark actions", "key", issue.Key, "previous", mutations.Previous)
 	}
 	return nil
 }
 
+// removeStaleLabel unmarks a stale issue. Like addStaleLabel, it posts the
+// unmark comment with the label update, or first, and skips it if a previous
+// run already posted it.
 func (bot *Stalebot) removeStaleLabel(ctx context.Context, issue *jira.Issue) error {
-	if _, _, err := bot.Client.Issue.AddComment(ctx, issue.ID, &jira.Comment{Body: bot.Config.UnmarkComment}); err != nil {
-		return fmt.Errorf("add unmark comment to issue: %v", err)
+	current, err := bot.currentIssue(ctx, issue)
+	if err != nil {
+		return err
+	}
+	staleLabels := bot.Config.staleLabels(time.Now())
+	if !bot.Config.isMarked(current, time.Now()) {
+		bot.Logger.Info("issue is already unmarked", "key", issue.Key)
+		return nil
 	}
 
-	reqBody := map[string]interface{}{"update": update{Labels: []labels{{Remove: bot.Config.StaleLabel}}}}
-	resp, err := bot.Client.Issue.UpdateIssue(ctx, issue.ID, reqBody)
-	if err != nil {
-		err = jira.NewJiraError(resp, err)
-		return fmt.Errorf("remove stale label %q from issue: %v", bot.Config.StaleLabel, jira.NewJiraError(resp, err))
+	comment := pendingComment(current, bot.Config.UnmarkComment, commentMarker(RemoveStaleLabel, bot.Config.markCycles(issue)))
+
+	var upd update
+	for _, l := range staleLabels {
+		if hasLabel(current, l) {
+			upd.Labels = append(upd.Labels, labels{Remove: l})
+		}
+	}
+	if err := bot.updateIssueWithComment(ctx, issue.ID, upd, nil, comment); err != nil {
+		return fmt.Errorf("remove stale label %q from issue: %v", bot.Config.StaleLabel, err)
 	}
 	return nil
 }
 
+// closeIssue closes an issue with the configured close strategy. The close
+// comment and the close actions are applied with the final close step, so
+// that a failed close leaves no comment behind that a later run would mistake
+// for activity, and the later run retries the whole close instead of
+// unmarking the issue. Where the close step cannot carry them, they are
+// applied in an edit before it, and a retrying run that finds the comment by
+// its marker skips them, so that no close action is applied twice.
 func (bot *Stalebot) closeIssue(ctx context.Context, issue *jira.Issue) error {
-	transitions, _, err := bot.Client.Issue.GetTransitions(ctx, issue.ID)
+	current, err := bot.currentIssue(ctx, issue)
 	if err != nil {
-		return fmt.Errorf("get transitions for issue: %v", err)
+		return err
 	}
-	tID, err := transitionID(transitions, bot.Config.CloseStatus)
-	if err != nil {
-		return fmt.Errorf("get transition ID: %v", err)
+	if bot.Config.isClosed(current) {
+		bot.Logger.Info("issue is already closed", "key", issue.Key)
+		return nil
+	}
+
+	marker := commentMarker(Close, bot.Config.markCycles(issue))
+	var (
+		mutations fieldMutations
+		comment   string
+	)
+	if markedComment(current, marker) == nil {
+		mutations, err = bot.fieldMutations(ctx, current, bot.Config.CloseActions)
+		if err != nil {
+			return fmt.Errorf("compute close actions: %v", err)
+		}
+		note, err := bot.prepareClose(ctx, issue, current)
+		if err != nil {
+			return err
+		}
+		comment = withMarker(withNote(withNote(bot.Config.CloseComment, note), mutations.previousValuesNote()), marker)
 	}
-	if _, err := bot.Client.Issue.DoTransition(ctx, issue.ID, tID); err != nil {
-		return fmt.Errorf("transition to status %q: %v", bot.Config.CloseStatus, err)
+	if err := bot.finishClose(ctx, issue, mutations, comment); err != nil {
+		return err
 	}
-	if _, _, err := bot.Client.Issue.AddComment(ctx, issue.ID, &jira.Comment{Body: bot.Config.CloseComment}); err != nil {
-		return fmt.Errorf("add close comment to issue: %v", err)
+	if len(mutations.Previous) > 0 {
+		bot.previous = mutations.Previous
+		bot.Logger.Info("applied close actions", "key", issue.Key, "previous", mutations.Previous)
 	}
 	return nil
 }
 
-func transitionID(transitions []jira.Transition, statusName string) (string, error) {
-	for _, t := range transitions {
-		if t.To.Name == statusName {
-			return t.ID, nil
+// updateIssueWithComment updates an issue and posts comment, unless it is
+// empty, in a single request using the edit endpoint's comment operation, so
+// that both land atomically in one history entry. If the instance rejects the
+// comment (e.g. because the comment field is not on the edit screen), the
+// comment is posted separately before the update, for this and all later
+// updates.
+func (bot *Stalebot) updateIssueWithComment(ctx context.Context, issueID string, upd update, fields map[string]interface{}, comment string) error {
+	reqBody := func(upd update) map[string]interface{} {
+		body := map[string]interface{}{"update": upd}
+		if len(fields) > 0 {
+			body["fields"] = fields
 		}
+		return body
 	}
-	return "", fmt.Errorf("no transition found to status %q", statusName)
-}
 
-func promptToConfirm(ctx context.Context, op Operation, issue *jira.Issue) (bool, error) {
-	reader := bufio.NewReader(os.Stdin)
+	if comment != "" && !bot.separateComments {
+		combined := upd
+		combined.Comment = bot.Config.commentUpdate(comment)
+		resp, err := bot.Client.Issue.UpdateIssue(ctx, issueID, reqBody(combined))
+		if err == nil {
+			return nil
+		}
+		err = jira.NewJiraError(resp, err)
+		if !commentRejected(resp, err) {
+			return err
+		}
+		bot.Logger.Info("jira rejected comment in issue update, posting comments separately", "reason", err.Error())
+		bot.separateComments = true
+	}
 
-	type result struct {
-		answer bool
-		err    error
+	if comment != "" {
+		if _, resp, err := bot.Client.Issue.AddComment(ctx, issueID, bot.Config.newComment(comment)); err != nil {
+			return fmt.Errorf("add comment: %v", jira.NewJiraError(resp, err))
+		}
+	}
+	resp, err := bot.Client.Issue.UpdateIssue(ctx, issueID, reqBody(upd))
+	if err != nil {
+		return jira.NewJiraError(resp, err)
 	}
-	res := make(chan result)
+	return nil
+}
 
-	go func() {
-		for {
-			msg := fmt.Sprintf("Perform operation %q on %s %s: %s?", op, issue.Fields.Type.Name, issue.Key, issue.Fields.Summary)
-			fmt.Printf("%s [y/N]: ", msg)
+// commentRejected returns true if an issue update failed because the comment
+// operation is not allowed.
+func commentRejected(resp *jira.Response, err error) bool {
+	return updateRejected(resp, err, "comment")
+}
 
-			response, err := reader.ReadString('\n')
-			if err != nil {
-				res <- result{answer: false, err: fmt.Errorf("read input from prompt: %v", err)}
-				return
+// updateRejected returns true if a request failed because it sets one of the
+// given fields, e.g. because the field is not on the screen of the edit or
+// transition.
+func updateRejected(resp *jira.Response, err error, fields ...string) bool {
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	var jerr *jira.Error
+	if !errors.As(err, &jerr) {
+		return false
+	}
+	for _, f := range fields {
+		if _, ok := jerr.Errors[f]; ok {
+			return true
+		}
+		for _, msg := range jerr.ErrorMessages {
+			if strings.Contains(strings.ToLower(msg), strings.ToLower(f)) {
+				return true
 			}
+		}
+	}
+	return false
+}
 
-			response = strings.ToLower(strings.TrimSpace(response))
+// withNote appends note to a comment body as a separate paragraph.
+func withNote(body, note string) string {
+	if note == "" {
+		return body
+	}
+	if body == "" {
+		return note
+	}
+	return body + "\n\n" + note
+}
 
-			if response == "y" || response == "yes" {
-				res <- result{answer: true, err: nil}
-				return
-			} else if response == "" || response == "n" || response == "no" {
-				res <- result{answer: false, err: nil}
-				return
-			}
+func transitionID(transitions []jira.Transition, statusName string) (string, error) {
+	for _, t := range transitions {
+		if t.To.Name == statusName {
+			return t.ID, nil
 		}
-	}()
-	select {
-	case <-ctx.Done():
-		fmt.Printf("\n")
-		return false, ctx.Err()
-	case r := <-res:
-		return r.answer, r.err
 	}
+	return "", fmt.Errorf("no transition found to status %q", statusName)
 }
@@ -0,0 +1,151 @@
+package stalebot_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Label updates with comments", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		puts int
+	)
+	issue := func(key string, updated time.Time, labels ...string) map[string]interface{} {
+		var histories []interface{}
+		for _, l := range labels {
+			histories = append(histories, map[string]interface{}{
+				"author":  map[string]interface{}{"name": "stalebot"},
+				"created": time.Now().Add(-5 * day).Format(jiraTime),
+				"items":   []interface{}{map[string]interface{}{"field": "labels", "toString": l}},
+			})
+		}
+		return map[string]interface{}{
+			"id":  key,
+			"key": key,
+			"fields": map[string]interface{}{
+				"updated": updated.Format(jiraTime),
+				"labels":  append([]string{}, labels...),
+				"status":  map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+			"changelog": map[string]interface{}{"histories": histories},
+		}
+	}
+	requests := func() []jiratest.Request {
+		var out []jiratest.Request
+		for _, r := range fake.Requests() {
+			if r.Method != http.MethodGet {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	rejectComments := func(status int, body string) {
+		fake.Handlers["PUT /rest/api/2/issue/TEST-1"] = func(w http.ResponseWriter, r *http.Request) {
+			puts++
+			if puts == 1 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(body))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	BeforeEach(func() {
+		puts = 0
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:   fake.URL,
+				Project:       "TEST",
+				CloseStatus:   "Closed",
+				StaleLabel:    "lifecycle-stale",
+				StaleAfter:    &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:    &stalebot.Duration{Duration: 10 * day},
+				ExemptLabels:  []string{"lifecycle-frozen"},
+				MarkComment:   "Stale.",
+				UnmarkComment: "No longer stale.",
+				MarkActions:   []stalebot.FieldAction{{Type: stalebot.SetCustomField, Field: "customfield_1", Value: "x"}},
+			},
+			Logger: logr.Discard(),
+		}
+		fake.Issues = append(fake.Issues, issue("TEST-1", time.Now().Add(-40*day)))
+	})
+
+	It("adds the label and the comment in a single request", func() {
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(requests()).To(Equal([]jiratest.Request{{
+			Method: http.MethodPut,
+			Path:   "/rest/api/2/issue/TEST-1",
+			Body: map[string]interface{}{
+				"update": map[string]interface{}{
+					"labels":  []interface{}{map[string]interface{}{"add": "lifecycle-stale"}},
+					"comment": []interface{}{map[string]interface{}{"add": map[string]interface{}{"body": "Stale.\n{anchor:jira-stalebot-addstalelabel-1}"}}},
+				},
+				"fields": map[string]interface{}{"customfield_1": "x"},
+			},
+		}}))
+	})
+	It("removes the label and adds the comment in a single request", func() {
+		fake.Issues[0] = issue("TEST-1", time.Now().Add(-day), "lifecycle-stale")
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(requests()).To(HaveLen(1))
+		Expect(requests()[0].Body).To(Equal(map[string]interface{}{
+			"update": map[string]interface{}{
+				"labels":  []interface{}{map[string]interface{}{"remove": "lifecycle-stale"}},
+				"comment": []interface{}{map[string]interface{}{"add": map[string]interface{}{"body": "No longer stale.\n{anchor:jira-stalebot-removestalelabel-1}"}}},
+			},
+		}))
+	})
+	It("falls back to separate requests if the comment is rejected", func() {
+		fake.Issues = append(fake.Issues, issue("TEST-2", time.Now().Add(-40*day)))
+		rejectComments(http.StatusBadRequest, `{"errorMessages": [], "errors": {"comment": "Field 'comment' cannot be set. It is not on the appropriate screen, or unknown."}}`)
+		Expect(bot.Run(context.Background())).To(Succeed())
+
+		reqs := requests()
+		Expect(reqs).To(HaveLen(5))
+		Expect(reqs[0].Body["update"]).To(HaveKey("comment"))
+		Expect(reqs[1].Method + " " + reqs[1].Path).To(Equal("POST /rest/api/2/issue/TEST-1/comment"))
+		Expect(reqs[1].Body["body"]).To(HaveSuffix("{anchor:jira-stalebot-addstalelabel-1}"))
+		Expect(reqs[2].Method + " " + reqs[2].Path).To(Equal("PUT /rest/api/2/issue/TEST-1"))
+		Expect(reqs[2].Body["update"]).NotTo(HaveKey("comment"))
+		Expect(reqs[2].Body["fields"]).To(Equal(map[string]interface{}{"customfield_1": "x"}))
+
+		By("posting comments separately from then on")
+		Expect(reqs[3].Method + " " + reqs[3].Path).To(Equal("POST /rest/api/2/issue/TEST-2/comment"))
+		Expect(reqs[4].Method + " " + reqs[4].Path).To(Equal("PUT /rest/api/2/issue/TEST-2"))
+		Expect(reqs[4].Body["update"]).NotTo(HaveKey("comment"))
+	})
+	It("does not fall back on other errors", func() {
+		rejectComments(http.StatusBadRequest, `{"errorMessages": [], "errors": {"labels": "Field 'labels' cannot be set."}}`)
+		Expect(bot.Run(context.Background())).To(MatchError(ContainSubstring("Field 'labels' cannot be set")))
+		Expect(requests()).To(HaveLen(1))
+
+		By("still posting comments with label updates")
+		Expect(bot.Run(context.Background())).To(Succeed())
+		reqs := requests()[1:]
+		Expect(reqs).To(HaveLen(1))
+		Expect(reqs[0].Body["update"]).To(HaveKey("comment"))
+	})
+	It("does not send a comment that was already posted", func() {
+		fake.Issues[0]["fields"].(map[string]interface{})["comment"] = map[string]interface{}{"comments": []interface{}{
+			map[string]interface{}{"id": "10", "body": "Stale.\n{anchor:jira-stalebot-addstalelabel-1}"},
+		}}
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(requests()).To(HaveLen(1))
+		Expect(requests()[0].Body["update"]).NotTo(HaveKey("comment"))
+	})
+})
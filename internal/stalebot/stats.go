@@ -0,0 +1,220 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// inactivityBuckets are the upper bounds, in days, of the inactivity
+// histogram buckets. Issues inactive for longer fall into a final, unbounded
+// bucket.
+var inactivityBuckets = []int{7, 30, 90, 180, 365}
+
+// projectionHorizons are the periods for which operations are projected.
+var projectionHorizons = []time.Duration{7 * day, 30 * day}
+
+// statsFields are the issue fields needed for stats, in addition to the
+// config's search fields.
+var statsFields = []string{"assignee", "components", "issuetype", "priority"}
+
+// Stats describes the staleness of the eligible issues of a project.
+type Stats struct {
+	Time   time.Time `json:"time"`
+	Issues int       `json:"issues"`
+
+	// Inactivity is a histogram of the days since the last activity on each
+	// issue.
+	Inactivity []InactivityBucket `json:"inactivity"`
+
+	ByType      map[string]int `json:"byType"`
+	ByPriority  map[string]int `json:"byPriority"`
+	ByComponent map[string]int `json:"byComponent"`
+	ByAssignee  map[string]int `json:"byAssignee"`
+
+	// NearMark and NearClose count the issues that are not due an operation
+	// now, but will be marked stale or closed within Within if they see no
+	// activity.
+	Within    Duration `json:"within"`
+	NearMark  int      `json:"nearMark"`
+	NearClose int      `json:"nearClose"`
+
+	// Projections count the operations daily runs would perform over the
+	// coming periods, assuming no further activity.
+	Projections []Projection `json:"projections"`
+}
+
+// InactivityBucket counts the issues inactive for between MinDays and MaxDays
+// days. A MaxDays of zero means the bucket is unbounded.
+type InactivityBucket struct {
+	MinDays int `json:"minDays"`
+	MaxDays int `json:"maxDays,omitempty"`
+	Count   int `json:"count"`
+}
+
+func (b InactivityBucket) String() string {
+	if b.MaxDays == 0 {
+		return fmt.Sprintf("%d+", b.MinDays)
+	}
+	return fmt.Sprintf("%d-%d", b.MinDays, b.MaxDays)
+}
+
+// Projection counts the operations projected over a period starting now.
+type Projection struct {
+	Horizon    Duration          `json:"horizon"`
+	Operations map[Operation]int `json:"operations"`
+}
+
+// Stats computes stats for the eligible issues, without performing any
+// operation. within is how far ahead issues count as near being marked or
+// closed.
+func (bot *Stalebot) Stats(ctx context.Context, now time.Time, within time.Duration) (*Stats, error) {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+	if err := bot.Config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid stalebot config: %v", err)
+	}
+
+	fields := sets.NewString(bot.Config.SearchFields()...).Insert(statsFields...).List()
+	plan, err := bot.plan(ctx, now, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		Time:        now,
+		Issues:      len(plan),
+		ByType:      map[string]int{},
+		ByPriority:  map[string]int{},
+		ByComponent: map[string]int{},
+		ByAssignee:  map[string]int{},
+		Within:      Duration{Duration: within},
+	}
+	min := 0
+	for _, max := range inactivityBuckets {
+		stats.Inactivity = append(stats.Inactivity, InactivityBucket{MinDays: min, MaxDays: max})
+		min = max + 1
+	}
+	stats.Inactivity = append(stats.Inactivity, InactivityBucket{MinDays: min})
+	for _, h := range projectionHorizons {
+		stats.Projections = append(stats.Projections, Projection{Horizon: Duration{Duration: h}, Operations: map[Operation]int{}})
+	}
+
+	horizon := within
+	for _, h := range projectionHorizons {
+		if h > horizon {
+			horizon = h
+		}
+	}
+
+	for _, p := range plan {
+		i := &p.Issue
+		stats.Inactivity[inactivityBucket(bot.Config.lastActivity(i, p.Relatives), now)].Count++
+		stats.ByType[issueTypeName(i)]++
+		stats.ByPriority[priorityName(i)]++
+		stats.ByAssignee[assigneeName(i)]++
+		if len(i.Fields.Components) == 0 {
+			stats.ByComponent["(none)"]++
+		}
+		for _, c := range i.Fields.Components {
+			stats.ByComponent[c.Name]++
+		}
+
+		projected := bot.Config.projectOperations(now, horizon, i, p.Relatives)
+		for j, h := range projectionHorizons {
+			for _, op := range projected {
+				if !op.at.After(now.Add(h)) {
+					stats.Projections[j].Operations[op.op]++
+				}
+			}
+		}
+		if p.Operation == None && len(projected) > 0 && !projected[0].at.After(now.Add(within)) {
+			switch {
+			case bot.Config.isMarked(i, now) && projected[0].op == Close:
+				stats.NearClose++
+			case !bot.Config.isMarked(i, now) && projected[0].op != RemoveStaleLabel:
+				stats.NearMark++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// lastActivity returns the time of the last activity on an issue, including
+// the activity of its children if child activity is enabled.
+func (c *Config) lastActivity(i *jira.Issue, rel *Relatives) time.Time {
+	last := c.issueActivity(i)
+	if c.ChildActivity {
+		if child := c.childActivity(rel); child.After(last) {
+			last = child
+		}
+	}
+	return last
+}
+
+func inactivityBucket(lastActivity, now time.Time) int {
+	inactive := int(now.Sub(lastActivity) / day)
+	for i, max := range inactivityBuckets {
+		if inactive <= max {
+			return i
+		}
+	}
+	return len(inactivityBuckets)
+}
+
+func issueTypeName(i *jira.Issue) string {
+	if i.Fields.Type.Name == "" {
+		return "(none)"
+	}
+	return i.Fields.Type.Name
+}
+
+func priorityName(i *jira.Issue) string {
+	if i.Fields.Priority == nil || i.Fields.Priority.Name == "" {
+		return "(none)"
+	}
+	return i.Fields.Priority.Name
+}
+
+type projectedOperation struct {
+	at time.Time
+	op Operation
+}
+
+// projectOperations returns the operations daily runs would perform on an
+// issue from now until now+horizon, assuming the issue sees no further
+// activity.
+func (c *Config) projectOperations(now time.Time, horizon time.Duration, issue *jira.Issue, rel *Relatives) []projectedOperation {
+	fields := *issue.Fields
+	changelog := &jira.Changelog{}
+	if issue.Changelog != nil {
+		changelog.Histories = append(changelog.Histories, issue.Changelog.Histories...)
+	}
+	i := &jira.Issue{ID: issue.ID, Key: issue.Key, Fields: &fields, Changelog: changelog}
+
+	var projected []projectedOperation
+	for t := now; !t.After(now.Add(horizon)); t = t.Add(day) {
+		op := c.IssueOperation(t, i, rel)
+		if op == None {
+			continue
+		}
+		projected = append(projected, projectedOperation{at: t, op: op})
+		if op == Close {
+			break
+		}
+		labels := sets.NewString(fields.Labels...)
+		if op == AddStaleLabel {
+			labels.Insert(c.StaleLabel)
+		} else {
+			labels.Delete(c.StaleLabel)
+		}
+		fields.Labels = labels.List()
+		fields.Updated = jira.Time(t)
+		changelog.Histories = append(changelog.Histories, staleLabelHistory(t, c.StaleLabel, op == AddStaleLabel))
+	}
+	return projected
+}
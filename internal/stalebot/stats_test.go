@@ -0,0 +1,109 @@
+package stalebot_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Stats", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		now  = time.Now().Truncate(time.Second)
+	)
+	issue := func(key string, updated time.Time, labels ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":  key,
+			"key": key,
+			"fields": map[string]interface{}{
+				"updated":   updated.Format(jiraTime),
+				"labels":    append([]string{}, labels...),
+				"issuetype": map[string]interface{}{"name": "Bug"},
+				"status":    map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+			"changelog": map[string]interface{}{"histories": []interface{}{}},
+		}
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:  fake.URL,
+				Project:      "TEST",
+				CloseStatus:  "Closed",
+				StaleLabel:   "lifecycle-stale",
+				StaleAfter:   &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:   &stalebot.Duration{Duration: 10 * day},
+				ExemptLabels: []string{"lifecycle-frozen"},
+			},
+			Logger: logr.Discard(),
+		}
+
+		fake.Issues = append(fake.Issues, issue("TEST-1", now.Add(-100*day)))
+		fake.Issues = append(fake.Issues, issue("TEST-2", now.Add(-25*day)))
+		fake.Issues[1]["fields"].(map[string]interface{})["priority"] = map[string]interface{}{"name": "Major"}
+		fake.Issues[1]["fields"].(map[string]interface{})["components"] = []interface{}{map[string]interface{}{"name": "api"}, map[string]interface{}{"name": "cli"}}
+		fake.Issues[1]["fields"].(map[string]interface{})["assignee"] = map[string]interface{}{"name": "jdoe"}
+		fake.Issues = append(fake.Issues, issue("TEST-3", now.Add(-5*day), bot.Config.StaleLabel))
+		fake.Issues[2]["changelog"] = map[string]interface{}{"histories": []interface{}{map[string]interface{}{
+			"author":  map[string]interface{}{"name": "stalebot"},
+			"created": now.Add(-5 * day).Format(jiraTime),
+			"items":   []interface{}{map[string]interface{}{"field": "labels", "toString": bot.Config.StaleLabel}},
+		}}}
+	})
+
+	It("counts issues by inactivity and fields", func() {
+		stats, err := bot.Stats(context.Background(), now, 7*day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Issues).To(Equal(3))
+		Expect(stats.Inactivity).To(Equal([]stalebot.InactivityBucket{
+			{MinDays: 0, MaxDays: 7, Count: 1},
+			{MinDays: 8, MaxDays: 30, Count: 1},
+			{MinDays: 31, MaxDays: 90, Count: 0},
+			{MinDays: 91, MaxDays: 180, Count: 1},
+			{MinDays: 181, MaxDays: 365, Count: 0},
+			{MinDays: 366, Count: 0},
+		}))
+		Expect(stats.ByType).To(Equal(map[string]int{"Bug": 3}))
+		Expect(stats.ByPriority).To(Equal(map[string]int{"(none)": 2, "Major": 1}))
+		Expect(stats.ByComponent).To(Equal(map[string]int{"(none)": 2, "api": 1, "cli": 1}))
+		Expect(stats.ByAssignee).To(Equal(map[string]int{"unassigned": 2, "jdoe": 1}))
+	})
+	It("counts issues near being marked or closed", func() {
+		stats, err := bot.Stats(context.Background(), now, 7*day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.NearMark).To(Equal(1))
+		Expect(stats.NearClose).To(Equal(1))
+
+		stats, err = bot.Stats(context.Background(), now, 2*day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.NearMark).To(Equal(0))
+		Expect(stats.NearClose).To(Equal(0))
+	})
+	It("projects operations", func() {
+		stats, err := bot.Stats(context.Background(), now, 7*day)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Projections).To(Equal([]stalebot.Projection{
+			{Horizon: stalebot.Duration{Duration: 7 * day}, Operations: map[stalebot.Operation]int{stalebot.AddStaleLabel: 2, stalebot.Close: 1}},
+			{Horizon: stalebot.Duration{Duration: 30 * day}, Operations: map[stalebot.Operation]int{stalebot.AddStaleLabel: 2, stalebot.Close: 3}},
+		}))
+	})
+	It("does not modify issues", func() {
+		_, err := bot.Stats(context.Background(), now, 7*day)
+		Expect(err).NotTo(HaveOccurred())
+		for _, r := range fake.Requests() {
+			Expect(r.Method).To(Equal("GET"))
+		}
+	})
+})
@@ -0,0 +1,177 @@
+package stalebot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+const xdgStateFilePath = "jira-stalebot/state.json"
+
+const (
+	// eventRetention is how long lifecycle events are kept in the store.
+	eventRetention = 365 * 24 * time.Hour
+	// maxRuns is the number of most recent run summaries kept in the store.
+	maxRuns = 500
+)
+
+// Event is a lifecycle event recorded for an issue. Only operations that were
+// actually performed are recorded; dry runs record no events.
+type Event struct {
+	Time      time.Time `json:"time"`
+	RunID     string    `json:"runID"`
+	Key       string    `json:"key"`
+	Operation Operation `json:"operation"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// Previous holds the values of the fields mutated by the operation's field
+	// actions before the mutation, keyed by field name, so that the mutation
+	// can be reverted.
+	Previous map[string]string `json:"previous,omitempty"`
+}
+
+// RunSummary summarizes a single stalebot run.
+type RunSummary struct {
+	ID        string    `json:"id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Project   string    `json:"project"`
+	DryRun    bool      `json:"dryRun,omitempty"`
+	Processed int       `json:"processed"`
+	// Operations counts the operations performed successfully (or logged, in
+	// dry-run mode), like RunReport.Operations.
+	Operations map[Operation]int `json:"operations"`
+	// Answers holds the answer given to the confirmation prompt for each
+	// prompted issue, keyed by issue key.
+	Answers map[string]string `json:"answers,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+type storeData struct {
+	Events []Event      `json:"events"`
+	Runs   []RunSummary `json:"runs"`
+}
+
+// Store is a file-backed store of issue lifecycle events and run summaries.
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	data storeData
+}
+
+// DefaultStorePath returns the path of the state file in the XDG config
+// directory, creating the directory if necessary.
+func DefaultStorePath() (string, error) {
+	return xdg.ConfigFile(xdgStateFilePath)
+}
+
+// OpenStore loads the store at path. A missing file results in an empty store.
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, fmt.Errorf("decode state file %q: %v", path, err)
+	}
+	return s, nil
+}
+
+// RecordEvent adds a lifecycle event to the store. Events are not persisted
+// until Save is called.
+func (s *Store) RecordEvent(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, e)
+}
+
+// RecordRun adds a run summary to the store. Runs are not persisted until Save
+// is called.
+func (s *Store) RecordRun(r RunSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Runs = append(s.data.Runs, r)
+}
+
+// History returns the lifecycle events recorded for the issue with the given
+// key, oldest first.
+func (s *Store) History(key string) []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []Event
+	for _, e := range s.data.Events {
+		if e.Key == key {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Runs returns the recorded run summaries, oldest first.
+func (s *Store) Runs() []RunSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RunSummary(nil), s.data.Runs...)
+}
+
+// Save atomically writes the store to its file, dropping events older than
+// the retention period and all but the most recent runs.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now())
+
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(s.path, data)
+}
+
+// writePrivateFile atomically replaces the file at path with data, readable
+// and writable only by the current user.
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-eventRetention)
+	events := s.data.Events[:0]
+	for _, e := range s.data.Events {
+		if e.Time.After(cutoff) {
+			events = append(events, e)
+		}
+	}
+	s.data.Events = events
+	if len(s.data.Runs) > maxRuns {
+		s.data.Runs = append([]RunSummary(nil), s.data.Runs[len(s.data.Runs)-maxRuns:]...)
+	}
+}
@@ -0,0 +1,110 @@
+package stalebot_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		dir  string
+		path string
+	)
+	operations := func(events []stalebot.Event) []stalebot.Operation {
+		var ops []stalebot.Operation
+		for _, e := range events {
+			ops = append(ops, e.Operation)
+		}
+		return ops
+	}
+	ids := func(runs []stalebot.RunSummary) []string {
+		var ids []string
+		for _, r := range runs {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, "state.json")
+	})
+
+	It("opens a missing file as an empty store", func() {
+		store, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.History("TEST-1")).To(BeEmpty())
+		Expect(store.Runs()).To(BeEmpty())
+	})
+	It("fails to open a corrupt file", func() {
+		Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+		_, err := stalebot.OpenStore(path)
+		Expect(err).To(MatchError(ContainSubstring("decode state file")))
+	})
+	It("loads what it saved", func() {
+		store, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		store.RecordEvent(stalebot.Event{Time: time.Now(), RunID: "run-1", Key: "TEST-1", Operation: stalebot.AddStaleLabel})
+		store.RecordEvent(stalebot.Event{Time: time.Now(), RunID: "run-1", Key: "TEST-2", Operation: stalebot.Close})
+		store.RecordEvent(stalebot.Event{Time: time.Now(), RunID: "run-2", Key: "TEST-1", Operation: stalebot.RemoveStaleLabel})
+		store.RecordRun(stalebot.RunSummary{ID: "run-1", Project: "TEST", Answers: map[string]string{"TEST-1": "y"}})
+		store.RecordRun(stalebot.RunSummary{ID: "run-2", Project: "TEST"})
+		Expect(store.Save()).To(Succeed())
+
+		loaded, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operations(loaded.History("TEST-1"))).To(Equal([]stalebot.Operation{stalebot.AddStaleLabel, stalebot.RemoveStaleLabel}))
+		Expect(loaded.History("TEST-3")).To(BeEmpty())
+		Expect(ids(loaded.Runs())).To(Equal([]string{"run-1", "run-2"}))
+		Expect(loaded.Runs()[0].Answers).To(Equal(map[string]string{"TEST-1": "y"}))
+	})
+	It("replaces the file without leaving temporary files behind", func() {
+		Expect(os.WriteFile(path, []byte(`{"events": [], "runs": [{"id": "old"}]}`), 0600)).To(Succeed())
+		store, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		store.RecordRun(stalebot.RunSummary{ID: "new"})
+		Expect(store.Save()).To(Succeed())
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("state.json"))
+		loaded, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(loaded.Runs())).To(Equal([]string{"old", "new"}))
+	})
+	It("leaves the existing file intact when saving fails", func() {
+		Expect(os.WriteFile(path, []byte(`{"runs": [{"id": "old"}]}`), 0600)).To(Succeed())
+		store, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(os.Mkdir(path, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(path, "keep"), nil, 0600)).To(Succeed())
+
+		Expect(store.Save()).NotTo(Succeed())
+		Expect(filepath.Join(path, "keep")).To(BeAnExistingFile())
+	})
+	It("drops expired events and old runs when saving", func() {
+		store, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		store.RecordEvent(stalebot.Event{Time: time.Now().AddDate(-2, 0, 0), Key: "TEST-1", Operation: stalebot.AddStaleLabel})
+		store.RecordEvent(stalebot.Event{Time: time.Now(), Key: "TEST-1", Operation: stalebot.Close})
+		for i := 0; i < 600; i++ {
+			store.RecordRun(stalebot.RunSummary{ID: fmt.Sprintf("run-%d", i)})
+		}
+		Expect(store.Save()).To(Succeed())
+
+		loaded, err := stalebot.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operations(loaded.History("TEST-1"))).To(Equal([]stalebot.Operation{stalebot.Close}))
+		runs := loaded.Runs()
+		Expect(runs).To(HaveLen(500))
+		Expect(runs[0].ID).To(Equal("run-100"))
+	})
+})
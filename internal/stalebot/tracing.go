@@ -0,0 +1,164 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "github.com/joelanford/jira-stalebot/internal/stalebot"
+	defaultServiceName = "jira-stalebot"
+)
+
+// Span attribute keys.
+const (
+	attrProject   = attribute.Key("jira.project")
+	attrIssueKey  = attribute.Key("jira.issue.key")
+	attrOperation = attribute.Key("stalebot.operation")
+	attrDryRun    = attribute.Key("stalebot.dry_run")
+	attrProcessed = attribute.Key("stalebot.processed")
+)
+
+type TraceExporter string
+
+const (
+	// OTLPExporter exports spans with OTLP over HTTP.
+	OTLPExporter TraceExporter = "otlp"
+	// StdoutExporter writes spans as JSON to standard error, so that they do
+	// not interleave with stalebot's output.
+	StdoutExporter TraceExporter = "stdout"
+	// FileExporter writes spans as JSON to a file.
+	FileExporter TraceExporter = "file"
+)
+
+// TracingConfig configures the export of OpenTelemetry traces of runs,
+// operations and Jira API calls.
+type TracingConfig struct {
+	Exporter TraceExporter `json:"exporter"`
+
+	// Endpoint is the host:port of the OTLP/HTTP collector. It defaults to
+	// the OTEL_EXPORTER_OTLP_ENDPOINT environment variable, or localhost:4318.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Insecure disables TLS for the OTLP exporter.
+	Insecure bool `json:"insecure,omitempty"`
+	// Headers are sent with each OTLP export request.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Path is the file spans are written to by the file exporter.
+	Path string `json:"path,omitempty"`
+
+	// ServiceName defaults to "jira-stalebot".
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+func (c *TracingConfig) validate() error {
+	switch c.Exporter {
+	case OTLPExporter, StdoutExporter:
+	case FileExporter:
+		if c.Path == "" {
+			return fmt.Errorf("exporter %q requires a path", c.Exporter)
+		}
+	default:
+		return fmt.Errorf("unknown exporter %q", c.Exporter)
+	}
+	return nil
+}
+
+// SetupTracing installs a global tracer provider that exports spans as
+// configured. The returned function flushes and stops the exporter. If c is
+// nil, tracing is disabled and the returned function does nothing.
+func SetupTracing(ctx context.Context, c *TracingConfig) (func(context.Context) error, error) {
+	if c == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	closeFile := func() error { return nil }
+	switch c.Exporter {
+	case OTLPExporter:
+		var opts []otlptracehttp.Option
+		if c.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(c.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(c.Headers))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case StdoutExporter:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case FileExporter:
+		f, ferr := os.OpenFile(c.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if ferr != nil {
+			return nil, fmt.Errorf("open trace file: %v", ferr)
+		}
+		closeFile = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	}
+	if err != nil {
+		_ = closeFile()
+		return nil, fmt.Errorf("create %s trace exporter: %v", c.Exporter, err)
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if cerr := closeFile(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// TracingTransport wraps an HTTP transport so that each request is traced,
+// with the response status code as an attribute. A nil base uses
+// http.DefaultTransport.
+func TracingTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return fmt.Sprintf("HTTP %s %s", r.Method, r.URL.Path)
+	}))
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,141 @@
+package stalebot
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+)
+
+var _ = Describe("Tracing", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake     *jiratest.Server
+		recorder *tracetest.SpanRecorder
+		bot      *Stalebot
+	)
+
+	// spanNamed looks up spans among the started spans, since the spans of
+	// HTTP calls only end once the response body is closed.
+	spanNamed := func(name string) sdktrace.ReadOnlySpan {
+		for _, s := range recorder.Started() {
+			if s.Name() == name {
+				return s
+			}
+		}
+		Fail("no span named " + name)
+		return nil
+	}
+	attributes := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		return attrs
+	}
+
+	BeforeEach(func() {
+		previous := otel.GetTracerProvider()
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		DeferCleanup(otel.SetTracerProvider, previous)
+
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		httpClient := fake.Client()
+		httpClient.Transport = TracingTransport(httpClient.Transport)
+		cl, err := jira.NewClient(fake.URL, httpClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		bot = &Stalebot{
+			Client: cl,
+			Config: Config{
+				JiraBaseURL:  fake.URL,
+				Project:      "TEST",
+				CloseStatus:  "Closed",
+				ExemptLabels: []string{"lifecycle-frozen"},
+			},
+			Logger: logr.Discard(),
+		}
+		bot.Config.setDefaults()
+		fake.Issues = append(fake.Issues, map[string]interface{}{
+			"id":  "TEST-1",
+			"key": "TEST-1",
+			"fields": map[string]interface{}{
+				"updated": time.Now().Add(-100 * day).Format(jiraTime),
+				"labels":  []string{},
+				"status":  map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+			},
+		})
+	})
+
+	It("traces runs, operations and Jira API calls", func() {
+		Expect(bot.Run(context.Background())).To(Succeed())
+
+		run := spanNamed("Run")
+		Expect(run.Status().Code).To(Equal(codes.Unset))
+		Expect(attributes(run)).To(HaveKeyWithValue(attrProcessed, attribute.IntValue(1)))
+
+		plan := spanNamed("Plan")
+		Expect(plan.Parent().SpanID()).To(Equal(run.SpanContext().SpanID()))
+
+		search := spanNamed("HTTP GET /rest/api/2/search")
+		Expect(search.Parent().SpanID()).To(Equal(plan.SpanContext().SpanID()))
+		Expect(attributes(search)).To(HaveKeyWithValue(attribute.Key("http.status_code"), attribute.IntValue(http.StatusOK)))
+
+		perform := spanNamed("perform AddStaleLabel")
+		Expect(perform.Parent().SpanID()).To(Equal(run.SpanContext().SpanID()))
+		Expect(attributes(perform)).To(And(
+			HaveKeyWithValue(attrIssueKey, attribute.StringValue("TEST-1")),
+			HaveKeyWithValue(attrOperation, attribute.StringValue(string(AddStaleLabel))),
+		))
+
+		update := spanNamed("HTTP PUT /rest/api/2/issue/TEST-1")
+		Expect(update.Parent().SpanID()).To(Equal(perform.SpanContext().SpanID()))
+		Expect(attributes(update)).To(HaveKeyWithValue(attribute.Key("http.status_code"), attribute.IntValue(http.StatusNoContent)))
+	})
+	It("records failures", func() {
+		fake.Handlers["PUT /rest/api/2/issue/TEST-1"] = func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"errorMessages": ["boom"]}`, http.StatusInternalServerError)
+		}
+		Expect(bot.Run(context.Background())).NotTo(Succeed())
+
+		Expect(spanNamed("perform AddStaleLabel").Status().Code).To(Equal(codes.Error))
+		Expect(spanNamed("Run").Status().Code).To(Equal(codes.Error))
+		Expect(attributes(spanNamed("HTTP PUT /rest/api/2/issue/TEST-1"))).To(HaveKeyWithValue(attribute.Key("http.status_code"), attribute.IntValue(http.StatusInternalServerError)))
+	})
+	It("exports spans to a file", func() {
+		previous := otel.GetTracerProvider()
+		DeferCleanup(otel.SetTracerProvider, previous)
+
+		path := filepath.Join(GinkgoT().TempDir(), "traces.json")
+		shutdown, err := SetupTracing(context.Background(), &TracingConfig{Exporter: FileExporter, Path: path})
+		Expect(err).NotTo(HaveOccurred())
+		_, span := startSpan(context.Background(), "test span", attrIssueKey.String("TEST-1"))
+		span.End()
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(And(ContainSubstring(`"Name":"test span"`), ContainSubstring(`"TEST-1"`), ContainSubstring(`"jira-stalebot"`)))
+	})
+	It("rejects invalid tracing configs", func() {
+		_, err := SetupTracing(context.Background(), &TracingConfig{Exporter: "zipkin"})
+		Expect(err).To(MatchError(`unknown exporter "zipkin"`))
+		_, err = SetupTracing(context.Background(), &TracingConfig{Exporter: FileExporter})
+		Expect(err).To(MatchError(`exporter "file" requires a path`))
+	})
+})
@@ -0,0 +1,238 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "PASS"
+	CheckWarn CheckStatus = "WARN"
+	CheckFail CheckStatus = "FAIL"
+)
+
+// CheckResult is the result of a single online config check.
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+// requiredPermissions are the project permissions stalebot needs to perform
+// its operations.
+var requiredPermissions = []string{"BROWSE_PROJECTS", "EDIT_ISSUES", "TRANSITION_ISSUES", "ADD_COMMENTS"}
+
+// ValidateOnline checks the config against the Jira instance. Checks that
+// depend on a failed check are skipped.
+func (bot *Stalebot) ValidateOnline(ctx context.Context) []CheckResult {
+	if bot.Client == nil {
+		panic("stalebot requires a client: client is nil")
+	}
+
+	results := []CheckResult{}
+	pass := func(name, msg string, args ...interface{}) {
+		results = append(results, CheckResult{Name: name, Status: CheckPass, Message: fmt.Sprintf(msg, args...)})
+	}
+	warn := func(name, msg string, args ...interface{}) {
+		results = append(results, CheckResult{Name: name, Status: CheckWarn, Message: fmt.Sprintf(msg, args...)})
+	}
+	fail := func(name, msg string, args ...interface{}) {
+		results = append(results, CheckResult{Name: name, Status: CheckFail, Message: fmt.Sprintf(msg, args...)})
+	}
+
+	project, _, err := bot.Client.Project.Get(ctx, bot.Config.Project)
+	if err != nil {
+		fail("project", "get project %q: %v", bot.Config.Project, err)
+		return results
+	}
+	pass("project", "project %q exists (%s)", project.Key, project.Name)
+
+	missing, err := bot.missingPermissions(ctx)
+	switch {
+	case err != nil:
+		fail("permissions", "get permissions: %v", err)
+	case len(missing) > 0:
+		fail("permissions", "missing project permissions: %s", strings.Join(missing, ", "))
+	default:
+		pass("permissions", "user has permissions: %s", strings.Join(requiredPermissions, ", "))
+	}
+
+	if bot.Config.CloseStrategy != ArchiveStrategy {
+		bot.checkCloseStatus(ctx, pass, warn, fail)
+	}
+
+	if v := bot.Config.CommentVisibility; v != nil {
+		if err := bot.checkCommentVisibility(ctx); err != nil {
+			fail("commentVisibility", "%v", err)
+		} else {
+			pass("commentVisibility", "comments are restricted to %s %q", v.Type, v.Value)
+		}
+	}
+
+	jql := bot.Config.EligibleIssuesQuery()
+	if total, err := bot.countIssues(ctx, jql); err != nil {
+		fail("jql", "query %q is invalid: %v", jql, err)
+	} else {
+		pass("jql", "query matches %d issues", total)
+	}
+
+	labels := append([]string{bot.Config.StaleLabel}, bot.Config.ExemptLabels...)
+	labels = append(labels, bot.Config.OnlyLabels...)
+	for _, l := range labels {
+		name := fmt.Sprintf("label %s", l)
+		total, err := bot.countIssues(ctx, fmt.Sprintf("project = %s AND labels = %s", bot.Config.Project, l))
+		switch {
+		case err != nil:
+			fail(name, "query label: %v", err)
+		case total == 0:
+			warn(name, "label is not used by any issue in the project")
+		default:
+			pass(name, "label is used by %d issues", total)
+		}
+	}
+	return results
+}
+
+func (bot *Stalebot) countIssues(ctx context.Context, jql string) (int, error) {
+	_, resp, err := bot.Client.Issue.Search(ctx, jql, &jira.SearchOptions{MaxResults: 1, Fields: []string{"key"}, ValidateQuery: "strict"})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Total, nil
+}
+
+func (bot *Stalebot) missingPermissions(ctx context.Context) ([]string, error) {
+	u := fmt.Sprintf("rest/api/2/mypermissions?projectKey=%s&permissions=%s",
+		url.QueryEscape(bot.Config.Project), url.QueryEscape(strings.Join(requiredPermissions, ",")))
+	req, err := bot.Client.NewRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Permissions map[string]struct {
+			HavePermission bool `json:"havePermission"`
+		} `json:"permissions"`
+	}
+	if resp, err := bot.Client.Do(req, &result); err != nil {
+		return nil, jira.NewJiraError(resp, err)
+	}
+	var missing []string
+	for _, p := range requiredPermissions {
+		if !result.Permissions[p].HavePermission {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+// checkCloseStatus checks that CloseStatus is in the workflows of all of the
+// project's issue types, and that it is reachable from every open status of
+// those workflows.
+func (bot *Stalebot) checkCloseStatus(ctx context.Context, pass, warn, fail func(name, msg string, args ...interface{})) {
+	status := bot.Config.CloseStatus
+	issueTypes, err := bot.projectStatuses(ctx)
+	if err != nil {
+		fail("closeStatus", "get project statuses: %v", err)
+		return
+	}
+	if missing := issueTypesWithoutStatus(issueTypes, status); len(missing) > 0 {
+		fail("closeStatus", "status %q is not in the workflows of issue types: %s", status, strings.Join(missing, ", "))
+		return
+	}
+	pass("closeStatus", "status %q is in the workflows of all issue types", status)
+
+	unreachable, unverified, err := bot.statusesWithoutCloseTransition(ctx, issueTypes, status)
+	switch {
+	case err != nil:
+		fail("closeTransitions", "check transitions: %v", err)
+	case len(unreachable) > 0:
+		fail("closeTransitions", "status %q is not reachable from: %s", status, strings.Join(unreachable, ", "))
+	case len(unverified) > 0:
+		warn("closeTransitions", "status %q is reachable from all checked statuses, but no issue exists to check: %s", status, strings.Join(unverified, ", "))
+	default:
+		pass("closeTransitions", "status %q is reachable from all open statuses", status)
+	}
+}
+
+// issueTypeStatuses are the statuses in the workflow of an issue type.
+type issueTypeStatuses struct {
+	Name     string        `json:"name"`
+	Statuses []jira.Status `json:"statuses"`
+}
+
+// projectStatuses returns the statuses in the workflows of the project's issue
+// types.
+func (bot *Stalebot) projectStatuses(ctx context.Context) ([]issueTypeStatuses, error) {
+	req, err := bot.Client.NewRequest(ctx, http.MethodGet, fmt.Sprintf("rest/api/2/project/%s/statuses", url.PathEscape(bot.Config.Project)), nil)
+	if err != nil {
+		return nil, err
+	}
+	var issueTypes []issueTypeStatuses
+	if resp, err := bot.Client.Do(req, &issueTypes); err != nil {
+		return nil, jira.NewJiraError(resp, err)
+	}
+	return issueTypes, nil
+}
+
+// issueTypesWithoutStatus returns the names of the issue types whose workflow
+// does not include the named status.
+func issueTypesWithoutStatus(issueTypes []issueTypeStatuses, status string) []string {
+	var missing []string
+	for _, it := range issueTypes {
+		found := false
+		for _, s := range it.Statuses {
+			if s.Name == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, it.Name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// statusesWithoutCloseTransition returns the open statuses of each issue type,
+// as "<issue type>/<status>", from which there is no transition to the named
+// status, and those that could not be checked. Workflows can only be read by
+// administrators, so the transitions are checked on an issue of the type in
+// the status, and statuses without such an issue cannot be checked.
+func (bot *Stalebot) statusesWithoutCloseTransition(ctx context.Context, issueTypes []issueTypeStatuses, status string) (unreachable, unverified []string, err error) {
+	for _, it := range issueTypes {
+		for _, s := range it.Statuses {
+			if s.Name == status || s.StatusCategory.Key == jira.StatusCategoryComplete {
+				continue
+			}
+			name := it.Name + "/" + s.Name
+			jql := fmt.Sprintf("project = %s AND issuetype = %q AND status = %q", bot.Config.Project, it.Name, s.Name)
+			issues, _, err := bot.Client.Issue.Search(ctx, jql, &jira.SearchOptions{MaxResults: 1, Fields: []string{"key"}})
+			if err != nil {
+				return nil, nil, fmt.Errorf("find issue in status %s: %v", name, err)
+			}
+			if len(issues) == 0 {
+				unverified = append(unverified, name)
+				continue
+			}
+			transitions, resp, err := bot.Client.Issue.GetTransitions(ctx, issues[0].ID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("get transitions for issue %s: %v", issues[0].Key, jira.NewJiraError(resp, err))
+			}
+			if _, err := transitionID(transitions, status); err != nil {
+				unreachable = append(unreachable, name)
+			}
+		}
+	}
+	sort.Strings(unreachable)
+	sort.Strings(unverified)
+	return unreachable, unverified, nil
+}
@@ -0,0 +1,179 @@
+package stalebot_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("ValidateOnline", func() {
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+		// issuesByStatus maps a status to the ID of the issue found in it.
+		issuesByStatus map[string]string
+		// transitions maps an issue ID to the statuses it can transition to.
+		transitions map[string][]string
+		// labelCounts maps a label to the number of issues that have it.
+		labelCounts map[string]int
+		permissions map[string]bool
+	)
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	// statuses returns the status of each check by name.
+	statuses := func() map[string]stalebot.CheckStatus {
+		out := map[string]stalebot.CheckStatus{}
+		for _, r := range bot.ValidateOnline(context.Background()) {
+			out[r.Name] = r.Status
+		}
+		return out
+	}
+	message := func(name string) string {
+		for _, r := range bot.ValidateOnline(context.Background()) {
+			if r.Name == name {
+				return r.Message
+			}
+		}
+		return ""
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		issuesByStatus = map[string]string{"New": "1", "In Progress": "2"}
+		transitions = map[string][]string{"1": {"In Progress", "Closed"}, "2": {"Closed"}}
+		labelCounts = map[string]int{"lifecycle-stale": 3, "lifecycle-frozen": 1}
+		permissions = map[string]bool{"BROWSE_PROJECTS": true, "EDIT_ISSUES": true, "TRANSITION_ISSUES": true, "ADD_COMMENTS": true}
+
+		fake.Handlers["GET /rest/api/2/project/TEST"] = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"key": "TEST", "name": "Test project"})
+		}
+		fake.Handlers["GET /rest/api/2/mypermissions"] = func(w http.ResponseWriter, r *http.Request) {
+			perms := map[string]interface{}{}
+			for p, have := range permissions {
+				perms[p] = map[string]interface{}{"havePermission": have}
+			}
+			writeJSON(w, map[string]interface{}{"permissions": perms})
+		}
+		fake.Handlers["GET /rest/api/2/project/TEST/statuses"] = func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, []interface{}{map[string]interface{}{
+				"name": "Bug",
+				"statuses": []interface{}{
+					map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+					map[string]interface{}{"name": "In Progress", "statusCategory": map[string]interface{}{"key": "indeterminate"}},
+					map[string]interface{}{"name": "Done", "statusCategory": map[string]interface{}{"key": "done"}},
+					map[string]interface{}{"name": "Closed", "statusCategory": map[string]interface{}{"key": "done"}},
+				},
+			}})
+		}
+		fake.Handlers["GET /rest/api/2/search"] = func(w http.ResponseWriter, r *http.Request) {
+			jql := r.URL.Query().Get("jql")
+			var issues []interface{}
+			for status, id := range issuesByStatus {
+				if strings.Contains(jql, `status = "`+status+`"`) {
+					issues = append(issues, map[string]interface{}{"id": id, "key": "TEST-" + id})
+				}
+			}
+			total := len(issues)
+			for label, n := range labelCounts {
+				if strings.HasSuffix(jql, "labels = "+label) {
+					total = n
+				}
+			}
+			if strings.Contains(jql, "ORDER BY") {
+				total = 42
+			}
+			writeJSON(w, map[string]interface{}{"total": total, "issues": issues})
+		}
+		for _, id := range []string{"1", "2"} {
+			id := id
+			fake.Handlers["GET /rest/api/2/issue/"+id+"/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+				var ts []interface{}
+				for i, to := range transitions[id] {
+					ts = append(ts, map[string]interface{}{"id": strconv.Itoa(i + 1), "name": to, "to": map[string]interface{}{"name": to}})
+				}
+				writeJSON(w, map[string]interface{}{"transitions": ts})
+			}
+		}
+
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:  fake.URL,
+				Project:      "TEST",
+				CloseStatus:  "Closed",
+				StaleLabel:   "lifecycle-stale",
+				ExemptLabels: []string{"lifecycle-frozen"},
+			},
+			Logger: logr.Discard(),
+		}
+	})
+
+	It("passes all checks", func() {
+		Expect(statuses()).To(Equal(map[string]stalebot.CheckStatus{
+			"project":                stalebot.CheckPass,
+			"permissions":            stalebot.CheckPass,
+			"closeStatus":            stalebot.CheckPass,
+			"closeTransitions":       stalebot.CheckPass,
+			"jql":                    stalebot.CheckPass,
+			"label lifecycle-stale":  stalebot.CheckPass,
+			"label lifecycle-frozen": stalebot.CheckPass,
+		}))
+		Expect(message("jql")).To(Equal("query matches 42 issues"))
+	})
+	It("fails and skips the remaining checks for a missing project", func() {
+		delete(fake.Handlers, "GET /rest/api/2/project/TEST")
+		Expect(statuses()).To(Equal(map[string]stalebot.CheckStatus{"project": stalebot.CheckFail}))
+	})
+	It("fails for missing permissions", func() {
+		permissions["TRANSITION_ISSUES"] = false
+		Expect(statuses()).To(HaveKeyWithValue("permissions", stalebot.CheckFail))
+		Expect(message("permissions")).To(Equal("missing project permissions: TRANSITION_ISSUES"))
+	})
+	It("fails for a close status missing from a workflow", func() {
+		bot.Config.CloseStatus = "Resolved"
+		Expect(statuses()).To(And(HaveKeyWithValue("closeStatus", stalebot.CheckFail), Not(HaveKey("closeTransitions"))))
+		Expect(message("closeStatus")).To(Equal(`status "Resolved" is not in the workflows of issue types: Bug`))
+	})
+	It("fails for a close status that is not reachable from an open status", func() {
+		transitions["2"] = []string{"New"}
+		Expect(statuses()).To(HaveKeyWithValue("closeTransitions", stalebot.CheckFail))
+		Expect(message("closeTransitions")).To(Equal(`status "Closed" is not reachable from: Bug/In Progress`))
+	})
+	It("warns when a status has no issue to check the transitions of", func() {
+		delete(issuesByStatus, "In Progress")
+		Expect(statuses()).To(HaveKeyWithValue("closeTransitions", stalebot.CheckWarn))
+		Expect(message("closeTransitions")).To(ContainSubstring("no issue exists to check: Bug/In Progress"))
+	})
+	It("does not check the close status when archiving", func() {
+		bot.Config.CloseStrategy = stalebot.ArchiveStrategy
+		Expect(statuses()).NotTo(Or(HaveKey("closeStatus"), HaveKey("closeTransitions")))
+	})
+	It("fails for an invalid query", func() {
+		search := fake.Handlers["GET /rest/api/2/search"]
+		fake.Handlers["GET /rest/api/2/search"] = func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Query().Get("jql"), "ORDER BY") {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errorMessages": ["Error in the JQL Query"]}`))
+				return
+			}
+			search(w, r)
+		}
+		Expect(statuses()).To(HaveKeyWithValue("jql", stalebot.CheckFail))
+	})
+	It("warns for unused labels", func() {
+		delete(labelCounts, "lifecycle-frozen")
+		Expect(statuses()).To(HaveKeyWithValue("label lifecycle-frozen", stalebot.CheckWarn))
+	})
+})
@@ -0,0 +1,132 @@
+package stalebot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+)
+
+type VisibilityType string
+
+const (
+	// RoleVisibility restricts comments to the members of a project role.
+	RoleVisibility VisibilityType = "role"
+	// GroupVisibility restricts comments to the members of a group.
+	GroupVisibility VisibilityType = "group"
+)
+
+// CommentVisibility restricts the visibility of stalebot's comments to a
+// project role or a group.
+type CommentVisibility struct {
+	Type VisibilityType `json:"type"`
+	// Value is the name of the role or group, e.g. "Developers".
+	Value string `json:"value"`
+}
+
+func (v CommentVisibility) validate() error {
+	switch v.Type {
+	case RoleVisibility, GroupVisibility:
+	default:
+		return fmt.Errorf("unknown visibility type %q", v.Type)
+	}
+	if v.Value == "" {
+		return fmt.Errorf("visibility %q requires a value", v.Type)
+	}
+	return nil
+}
+
+// restrictedVisibility returns the visibility of stalebot's comments, or nil
+// if they are visible to all.
+func (c *Config) restrictedVisibility() *jira.CommentVisibility {
+	if c.CommentVisibility == nil {
+		return nil
+	}
+	return &jira.CommentVisibility{Type: string(c.CommentVisibility.Type), Value: c.CommentVisibility.Value}
+}
+
+// newComment returns a comment with the configured visibility.
+func (c *Config) newComment(body string) *jira.Comment {
+	comment := &jira.Comment{Body: body}
+	if v := c.restrictedVisibility(); v != nil {
+		comment.Visibility = *v
+	}
+	return comment
+}
+
+// checkCommentVisibility checks that the role or group comments are
+// restricted to exists. It does nothing if comment visibility is not
+// configured.
+func (bot *Stalebot) checkCommentVisibility(ctx context.Context) error {
+	v := bot.Config.CommentVisibility
+	if v == nil {
+		return nil
+	}
+	var found bool
+	var err error
+	switch v.Type {
+	case RoleVisibility:
+		found, err = bot.projectRoleExists(ctx, v.Value)
+	case GroupVisibility:
+		found, err = bot.groupExists(ctx, v.Value)
+	}
+	if err != nil {
+		return fmt.Errorf("look up %s %q: %v", v.Type, v.Value, err)
+	}
+	if !found {
+		if v.Type == RoleVisibility {
+			return fmt.Errorf("role %q does not exist in project %s", v.Value, bot.Config.Project)
+		}
+		return fmt.Errorf("group %q does not exist", v.Value)
+	}
+	return nil
+}
+
+func (bot *Stalebot) projectRoleExists(ctx context.Context, role string) (bool, error) {
+	req, err := bot.Client.NewRequest(ctx, http.MethodGet, fmt.Sprintf("rest/api/2/project/%s/role", url.PathEscape(bot.Config.Project)), nil)
+	if err != nil {
+		return false, err
+	}
+	// The response maps role names to role URLs.
+	roles := map[string]string{}
+	if resp, err := bot.Client.Do(req, &roles); err != nil {
+		return false, jira.NewJiraError(resp, err)
+	}
+	_, ok := roles[role]
+	return ok, nil
+}
+
+// groupPickerMaxResults is the number of matches requested from the group
+// picker, which returns 20 matches by default.
+const groupPickerMaxResults = 1000
+
+// groupExists looks up the group by exact name among the groups matching it
+// in the group picker. If the picker truncated the matches without including
+// the group, the group may still exist, so an error is returned.
+func (bot *Stalebot) groupExists(ctx context.Context, group string) (bool, error) {
+	u := fmt.Sprintf("rest/api/2/groups/picker?query=%s&maxResults=%d", url.QueryEscape(group), groupPickerMaxResults)
+	req, err := bot.Client.NewRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	var result struct {
+		Total  int `json:"total"`
+		Groups []struct {
+			Name string `json:"name"`
+		} `json:"groups"`
+	}
+	if resp, err := bot.Client.Do(req, &result); err != nil {
+		return false, jira.NewJiraError(resp, err)
+	}
+	for _, g := range result.Groups {
+		if g.Name == group {
+			return true, nil
+		}
+	}
+	if result.Total > len(result.Groups) {
+		return false, fmt.Errorf("group picker returned only %d of %d matching groups", len(result.Groups), result.Total)
+	}
+	return false, nil
+}
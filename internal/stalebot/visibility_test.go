@@ -0,0 +1,175 @@
+package stalebot_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/joelanford/jira-stalebot/internal/jiratest"
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var _ = Describe("Comment visibility", func() {
+	const jiraTime = "2006-01-02T15:04:05.000-0700"
+	var (
+		fake *jiratest.Server
+		bot  *stalebot.Stalebot
+	)
+	restricted := map[string]interface{}{"type": "role", "value": "Developers"}
+	// plan makes the search find an issue that is due for op.
+	plan := func(op stalebot.Operation) {
+		fields := map[string]interface{}{
+			"updated": time.Now().Add(-40 * day).Format(jiraTime),
+			"labels":  []string{},
+			"status":  map[string]interface{}{"name": "New", "statusCategory": map[string]interface{}{"key": "new"}},
+		}
+		var histories []interface{}
+		if op == stalebot.Close {
+			fields["labels"] = []string{"lifecycle-stale"}
+			histories = append(histories, map[string]interface{}{
+				"author":  map[string]interface{}{"name": "stalebot"},
+				"created": time.Now().Add(-40 * day).Format(jiraTime),
+				"items":   []interface{}{map[string]interface{}{"field": "labels", "toString": "lifecycle-stale"}},
+			})
+		}
+		fake.Issues = append(fake.Issues, map[string]interface{}{
+			"id":        "TEST-1",
+			"key":       "TEST-1",
+			"fields":    fields,
+			"changelog": map[string]interface{}{"histories": histories},
+		})
+	}
+	// rejectUpdateComments makes the instance reject comments with label
+	// updates, so that they are posted separately.
+	rejectUpdateComments := func() {
+		fake.Handlers["PUT /rest/api/2/issue/TEST-1"] = func(w http.ResponseWriter, r *http.Request) {
+			if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"comment"`) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors": {"comment": "Field 'comment' cannot be set. It is not on the appropriate screen, or unknown."}}`))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	// lastChange returns the last request that modified the issue.
+	lastChange := func() jiratest.Request {
+		var last jiratest.Request
+		for _, r := range fake.Requests() {
+			if r.Method != http.MethodGet {
+				last = r
+			}
+		}
+		return last
+	}
+	// postedComment returns the request that posted a comment on its own.
+	postedComment := func() jiratest.Request {
+		for _, r := range fake.Requests() {
+			if r.Method == http.MethodPost && r.Path == "/rest/api/2/issue/TEST-1/comment" {
+				return r
+			}
+		}
+		return jiratest.Request{}
+	}
+
+	BeforeEach(func() {
+		fake = jiratest.NewServer()
+		DeferCleanup(fake.Close)
+		fake.Handlers["GET /rest/api/2/project/TEST/role"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"Developers": "https://jira.example.com/rest/api/2/project/TEST/role/10001"}`))
+		}
+		fake.Handlers["GET /rest/api/2/groups/picker"] = func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("maxResults") != "1000" {
+				_, _ = w.Write([]byte(`{"total": 2, "groups": [{"name": "jira-developers-emea"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"total": 2, "groups": [{"name": "jira-developers-emea"}, {"name": "jira-developers"}]}`))
+		}
+		fake.Handlers["GET /rest/api/2/issue/TEST-1/transitions"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"transitions": [{"id": "2", "name": "Close", "to": {"name": "Closed"}}]}`))
+		}
+		bot = &stalebot.Stalebot{
+			Client: fake.JiraClient(),
+			Config: stalebot.Config{
+				JiraBaseURL:       fake.URL,
+				Project:           "TEST",
+				CloseStatus:       "Closed",
+				StaleLabel:        "lifecycle-stale",
+				StaleAfter:        &stalebot.Duration{Duration: 30 * day},
+				CloseAfter:        &stalebot.Duration{Duration: 10 * day},
+				ExemptLabels:      []string{"lifecycle-frozen"},
+				MarkComment:       "Stale.",
+				CloseComment:      "Closing.",
+				CommentVisibility: &stalebot.CommentVisibility{Type: stalebot.RoleVisibility, Value: "Developers"},
+			},
+			Logger: logr.Discard(),
+		}
+	})
+
+	It("restricts comments added with label updates", func() {
+		plan(stalebot.AddStaleLabel)
+		Expect(bot.Run(context.Background())).To(Succeed())
+		r := lastChange()
+		Expect(r.Method).To(Equal(http.MethodPut))
+		comment := r.Body["update"].(map[string]interface{})["comment"].([]interface{})[0].(map[string]interface{})["add"]
+		Expect(comment).To(HaveKeyWithValue("visibility", restricted))
+	})
+	It("restricts comments posted separately", func() {
+		plan(stalebot.AddStaleLabel)
+		rejectUpdateComments()
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(postedComment().Body).To(HaveKeyWithValue("visibility", restricted))
+	})
+	It("restricts close comments", func() {
+		plan(stalebot.Close)
+		Expect(bot.Run(context.Background())).To(Succeed())
+		r := lastChange()
+		Expect(r.Path).To(Equal("/rest/api/2/issue/TEST-1/transitions"))
+		comment := r.Body["update"].(map[string]interface{})["comment"].([]interface{})[0].(map[string]interface{})["add"]
+		Expect(comment).To(HaveKeyWithValue("visibility", restricted))
+	})
+	It("does not restrict comments by default", func() {
+		bot.Config.CommentVisibility = nil
+		plan(stalebot.AddStaleLabel)
+		rejectUpdateComments()
+		Expect(bot.Run(context.Background())).To(Succeed())
+		Expect(postedComment().Body).To(HaveKey("body"))
+		Expect(postedComment().Body).NotTo(HaveKeyWithValue("visibility", HaveKey("type")))
+	})
+
+	DescribeTable("checks that the role or group exists before running",
+		func(v *stalebot.CommentVisibility, expectedErr string) {
+			bot.Config.CommentVisibility = v
+			err := bot.Run(context.Background())
+			if expectedErr == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError("invalid comment visibility: " + expectedErr))
+			}
+		},
+		Entry("unset", nil, ""),
+		Entry("existing role", &stalebot.CommentVisibility{Type: stalebot.RoleVisibility, Value: "Developers"}, ""),
+		Entry("missing role", &stalebot.CommentVisibility{Type: stalebot.RoleVisibility, Value: "Administrators"}, `role "Administrators" does not exist in project TEST`),
+		Entry("existing group", &stalebot.CommentVisibility{Type: stalebot.GroupVisibility, Value: "jira-developers"}, ""),
+		Entry("missing group", &stalebot.CommentVisibility{Type: stalebot.GroupVisibility, Value: "jira-dev"}, `group "jira-dev" does not exist`),
+	)
+	It("does not report a group missing from truncated picker results", func() {
+		fake.Handlers["GET /rest/api/2/groups/picker"] = func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"total": 1500, "groups": [{"name": "jira-developers-emea"}]}`))
+		}
+		bot.Config.CommentVisibility = &stalebot.CommentVisibility{Type: stalebot.GroupVisibility, Value: "jira-developers"}
+		Expect(bot.Run(context.Background())).To(MatchError(`invalid comment visibility: look up group "jira-developers": group picker returned only 1 of 1500 matching groups`))
+	})
+	It("rejects invalid visibility configs", func() {
+		bot.Config.CommentVisibility = &stalebot.CommentVisibility{Type: "user"}
+		Expect(bot.Config.Validate()).To(MatchError(`config contains invalid commentVisibility: unknown visibility type "user"`))
+		bot.Config.CommentVisibility = &stalebot.CommentVisibility{Type: stalebot.GroupVisibility}
+		Expect(bot.Config.Validate()).To(MatchError(`config contains invalid commentVisibility: visibility "group" requires a value`))
+	})
+})
@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/go-logr/logr"
@@ -49,32 +54,23 @@ func main() {
 
 func rootCmd(log logr.Logger) *cobra.Command {
 	var (
-		configFile string
+		clientOpts clientOptions
+		stateFile  string
 		dryRun     bool
 		verbosity  uint
 		skipPrompt bool
+		review     bool
 	)
 	cmd := &cobra.Command{
 		Use: "jira-stalebot",
-		Run: func(cmd *cobra.Command, args []string) {
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			zapLevel.SetLevel(-zapcore.Level(verbosity))
-
+		},
+		Run: func(cmd *cobra.Command, args []string) {
 			setupLog := log.WithName("setup")
-			pat, err := stalebot.LoadPersonalAccessToken()
-			if err != nil {
-				exitError(setupLog, "load personal access token", err)
-			}
+			cfg, cl := setupClient(setupLog, clientOpts)
 
-			cfg, err := stalebot.LoadConfig(configFile)
-			if err != nil {
-				exitError(setupLog, "load stalebot config", err)
-			}
-
-			tp := &jira.PATAuthTransport{Token: pat}
-			cl, err := jira.NewClient(cfg.JiraBaseURL, tp.Client())
-			if err != nil {
-				exitError(setupLog, "create jira client", err)
-			}
+			store := openStore(setupLog, stateFile)
 
 			stalebotLog := log.WithName("stalebot")
 			bot := stalebot.Stalebot{
@@ -82,20 +78,209 @@ func rootCmd(log logr.Logger) *cobra.Command {
 				Config: *cfg,
 				DryRun: dryRun,
 				Prompt: !skipPrompt,
+				Review: review,
 				Logger: stalebotLog,
+				Store:  store,
 			}
-			if err := bot.Run(cmd.Context()); err != nil {
+			shutdownTracing := setupTracing(cmd.Context(), setupLog, cfg)
+			err := bot.Run(cmd.Context())
+			shutdownTracing()
+			if err != nil {
 				exitError(stalebotLog, "run stalebot", err)
 			}
 		},
 	}
-	cmd.Flags().StringVar(&configFile, "config", "config.yaml", "Stalebot config file")
+	cmd.PersistentFlags().StringVar(&clientOpts.configFile, "config", "config.yaml", "Stalebot config file")
+	cmd.PersistentFlags().StringVar(&clientOpts.profile, "profile", "", "Credential profile to use (defaults to the profile matching the config's jiraBaseURL)")
+	cmd.PersistentFlags().StringVar(&stateFile, "state-file", "", "Local state file (defaults to $XDG_CONFIG_HOME/jira-stalebot/state.json)")
+	cmd.PersistentFlags().UintVarP(&verbosity, "verbosity", "v", 0, "Log verbosity (higher number is more verbose)")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Dry run (don't make any changes)")
-	cmd.Flags().UintVarP(&verbosity, "verbosity", "v", 0, "Log verbosity (higher number is more verbose)")
 	cmd.Flags().BoolVarP(&skipPrompt, "yes", "y", false, "skip confirmation prompts for operations")
+	cmd.Flags().BoolVar(&review, "review", false, "Review and select planned operations in a terminal UI before performing them")
+
+	cmd.AddCommand(
+		explainCmd(log, &clientOpts),
+		historyCmd(log, &stateFile),
+		runsCmd(log, &stateFile),
+		authCmd(log, &clientOpts),
+		validateCmd(log, &clientOpts),
+		schemaCmd(log),
+		simulateCmd(log, &clientOpts),
+		statsCmd(log, &clientOpts),
+		digestCmd(log, &clientOpts),
+		purgeCmd(log, &clientOpts, &stateFile),
+		migrateLabelCmd(log, &clientOpts, &stateFile),
+	)
 	return cmd
 }
 
+func explainCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain <issue-key>...",
+		Short: "Explain the operation stalebot would perform on issues",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			setupLog := log.WithName("setup")
+			cfg, cl := setupClient(setupLog, *clientOpts)
+
+			explainLog := log.WithName("explain")
+			bot := stalebot.Stalebot{
+				Client: cl,
+				Config: *cfg,
+				Logger: explainLog,
+			}
+			explanations, err := bot.Explain(cmd.Context(), args)
+			if err != nil {
+				exitError(explainLog, "explain issues", err)
+			}
+			for _, e := range explanations {
+				fmt.Printf("%s: %s (%s)\n", e.Key, e.Operation, e.Reason)
+			}
+		},
+	}
+}
+
+func historyCmd(log logr.Logger, stateFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "history <issue-key>",
+		Short: "Show the recorded lifecycle events of an issue",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			store := loadStore(log.WithName("setup"), *stateFile)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tRUN\tOPERATION\tREASON\tPREVIOUS\tERROR")
+			for _, e := range store.History(args[0]) {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.RunID, e.Operation, e.Reason, formatValues(e.Previous), e.Error)
+			}
+			w.Flush()
+		},
+	}
+}
+
+func runsCmd(log logr.Logger, stateFile *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "runs",
+		Short: "Show the recorded stalebot runs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			store := loadStore(log.WithName("setup"), *stateFile)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "RUN\tPROJECT\tDURATION\tDRY-RUN\tPROCESSED\tMARKED\tUNMARKED\tCLOSED\tANSWERS\tERROR")
+			for _, r := range store.Runs() {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%d\t%d\t%d\t%s\t%s\n", r.ID, r.Project, r.End.Sub(r.Start).Round(time.Second), r.DryRun, r.Processed,
+					r.Operations[stalebot.AddStaleLabel], r.Operations[stalebot.RemoveStaleLabel], r.Operations[stalebot.Close], formatAnswers(r.Answers), r.Error)
+			}
+			w.Flush()
+		},
+	}
+}
+
+// formatAnswers formats prompt answers as the number of times each answer was
+// given, e.g. "n=1,y=3".
+func formatAnswers(answers map[string]string) string {
+	counts := map[string]int{}
+	for _, a := range answers {
+		counts[a]++
+	}
+	pairs := make([]string, 0, len(counts))
+	for a, n := range counts {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", a, n))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// formatValues formats field values as a sorted, comma-separated list of
+// field=value pairs.
+func formatValues(values map[string]string) string {
+	pairs := make([]string, 0, len(values))
+	for k, v := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// openStore opens the state store of commands that operate on issues. The
+// store only records history, so if the default state file is unusable, the
+// error is logged and the command continues without recording history. A
+// state file given with --state-file must be usable.
+func openStore(setupLog logr.Logger, stateFile string) *stalebot.Store {
+	if stateFile != "" {
+		return loadStore(setupLog, stateFile)
+	}
+	path, err := stalebot.DefaultStorePath()
+	if err == nil {
+		var store *stalebot.Store
+		if store, err = stalebot.OpenStore(path); err == nil {
+			return store
+		}
+	}
+	setupLog.Error(err, "open default state store, continuing without recording history")
+	return nil
+}
+
+// loadStore opens the state store of commands that show its contents, which
+// fail if it is unusable.
+func loadStore(setupLog logr.Logger, stateFile string) *stalebot.Store {
+	if stateFile == "" {
+		path, err := stalebot.DefaultStorePath()
+		if err != nil {
+			exitError(setupLog, "locate state file", err)
+		}
+		stateFile = path
+	}
+	store, err := stalebot.OpenStore(stateFile)
+	if err != nil {
+		exitError(setupLog, "open state store", err)
+	}
+	return store
+}
+
+// clientOptions are the options used to configure stalebot and its Jira client.
+type clientOptions struct {
+	configFile string
+	profile    string
+}
+
+func setupClient(setupLog logr.Logger, opts clientOptions) (*stalebot.Config, *jira.Client) {
+	cfg, err := stalebot.LoadConfig(opts.configFile)
+	if err != nil {
+		exitError(setupLog, "load stalebot config", err)
+	}
+
+	creds, err := stalebot.LoadCredentials(setupLog, cfg, opts.profile)
+	if err != nil {
+		exitError(setupLog, "load credentials", err)
+	}
+
+	httpClient := creds.HTTPClient()
+	httpClient.Transport = stalebot.TracingTransport(httpClient.Transport)
+	cl, err := jira.NewClient(cfg.JiraBaseURL, httpClient)
+	if err != nil {
+		exitError(setupLog, "create jira client", err)
+	}
+	return cfg, cl
+}
+
+// setupTracing starts exporting traces as configured. The returned function
+// flushes the exported spans.
+func setupTracing(ctx context.Context, setupLog logr.Logger, cfg *stalebot.Config) func() {
+	shutdown, err := stalebot.SetupTracing(ctx, cfg.Tracing)
+	if err != nil {
+		exitError(setupLog, "setup tracing", err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			setupLog.Error(err, "flush traces")
+		}
+	}
+}
+
 func exitError(l logr.Logger, msg string, err error) {
 	l.Error(err, msg)
 	os.Exit(1)
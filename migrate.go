@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+func migrateLabelCmd(log logr.Logger, clientOpts *clientOptions, stateFile *string) *cobra.Command {
+	var (
+		dryRun     bool
+		skipPrompt bool
+	)
+	cmd := &cobra.Command{
+		Use:   "migrate-label",
+		Short: "Replace the previous stale label with the current one",
+		Long: `Replace the previous stale label with the current one.
+
+The labels are taken from the config, which must already use the new label as
+staleLabel, and name the old one in its labelMigration section. Until the end of the migration's transition
+window, stalebot treats issues with either label as stale, and the migration
+does not reset how long issues have been stale.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			migrateLog := log.WithName("migrate-label")
+			setupLog := log.WithName("setup")
+			cfg, cl := setupClient(setupLog, *clientOpts)
+
+			bot := stalebot.Stalebot{
+				Client: cl,
+				Config: *cfg,
+				DryRun: dryRun,
+				Prompt: !skipPrompt,
+				Logger: migrateLog,
+				Store:  openStore(setupLog, *stateFile),
+			}
+			shutdownTracing := setupTracing(cmd.Context(), setupLog, cfg)
+			report, err := bot.MigrateLabels(cmd.Context(), time.Now())
+			shutdownTracing()
+			if report != nil {
+				verb := "Migrated"
+				if report.DryRun {
+					verb = "Would migrate"
+				}
+				fmt.Printf("%s %d of %d issues from %q to %q\n", verb, report.Operations[stalebot.MigrateLabel], report.Processed, cfg.LabelMigration.From, cfg.StaleLabel)
+				if len(report.Failures) > 0 {
+					w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(w, "\nKEY\tERROR")
+					for _, f := range report.Failures {
+						fmt.Fprintf(w, "%s\t%s\n", f.Key, f.Error)
+					}
+					w.Flush()
+				}
+			}
+			if err != nil {
+				exitError(migrateLog, "migrate label", err)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Dry run (don't make any changes)")
+	cmd.Flags().BoolVarP(&skipPrompt, "yes", "y", false, "skip confirmation prompts for operations")
+	return cmd
+}
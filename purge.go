@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+func purgeCmd(log logr.Logger, clientOpts *clientOptions, stateFile *string) *cobra.Command {
+	var (
+		opts         stalebot.PurgeOptions
+		reopenWithin string
+		dryRun       bool
+		skipPrompt   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Remove stalebot's labels and comments from the project",
+		Long: `Remove stalebot's labels and comments from the project.
+
+The stale label is removed from all open issues that stalebot labeled. With
+--delete-comments, stalebot's comments on those issues are deleted, and with
+--reopen-within, issues that stalebot closed within that duration are
+reopened. Issues whose stale label was added by another account are reported
+and left untouched.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			purgeLog := log.WithName("purge")
+			if reopenWithin != "" {
+				d, err := stalebot.ParseDuration(reopenWithin)
+				if err != nil {
+					exitError(purgeLog, "parse --reopen-within", err)
+				}
+				opts.ReopenWithin = d
+			}
+
+			setupLog := log.WithName("setup")
+			cfg, cl := setupClient(setupLog, *clientOpts)
+			bot := stalebot.Stalebot{
+				Client: cl,
+				Config: *cfg,
+				DryRun: dryRun,
+				Prompt: !skipPrompt,
+				Logger: purgeLog,
+				Store:  openStore(setupLog, *stateFile),
+			}
+			shutdownTracing := setupTracing(cmd.Context(), setupLog, cfg)
+			report, err := bot.Purge(cmd.Context(), time.Now(), opts)
+			shutdownTracing()
+			if report != nil {
+				writePurgeReport(os.Stdout, report)
+			}
+			if err != nil {
+				exitError(purgeLog, "purge stalebot", err)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&opts.DeleteComments, "delete-comments", false, "Delete stalebot's comments from purged issues")
+	cmd.Flags().StringVar(&reopenWithin, "reopen-within", "", "Reopen issues that stalebot closed within this duration")
+	cmd.Flags().StringVar(&opts.ReopenStatus, "reopen-status", "", "Status to transition reopened issues to (not needed for the archive close strategy)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Dry run (don't make any changes)")
+	cmd.Flags().BoolVarP(&skipPrompt, "yes", "y", false, "skip confirmation prompts for operations")
+	return cmd
+}
+
+func writePurgeReport(out io.Writer, report *stalebot.PurgeReport) {
+	verb := "Purged"
+	if report.DryRun {
+		verb = "Would purge"
+	}
+	fmt.Fprintf(out, "%s %d issues: %d unlabeled, %d reopened, %d comments deleted\n", verb,
+		len(report.Unlabeled)+len(report.Reopened), len(report.Unlabeled), len(report.Reopened), report.DeletedComments)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nKEY\tRESULT\tSUMMARY")
+	for _, i := range report.Reopened {
+		fmt.Fprintf(w, "%s\treopened\t%s\n", i.Key, i.Summary)
+	}
+	for _, i := range report.Unlabeled {
+		fmt.Fprintf(w, "%s\tunlabeled\t%s\n", i.Key, i.Summary)
+	}
+	for _, i := range report.Skipped {
+		fmt.Fprintf(w, "%s\tskipped (not labeled by stalebot)\t%s\n", i.Key, i.Summary)
+	}
+	for _, f := range report.Failures {
+		fmt.Fprintf(w, "%s\tfailed (%s: %s)\t%s\n", f.Key, f.Operation, f.Error, f.Summary)
+	}
+	w.Flush()
+}
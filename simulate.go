@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+func simulateCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	var from, to, step string
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Replay the stalebot lifecycle against the project's history",
+		Long: `Replay the stalebot lifecycle against the project's history.
+
+Issues are fetched with their full changelog, and their state is reconstructed
+at each step between --from and --to. The operations stalebot would have
+performed are reported by calendar month, or by step for steps longer than
+four weeks, along with closed issues that later received real activity (false
+positives). Nothing is modified.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			simulateLog := log.WithName("simulate")
+			fromTime, err := time.Parse("2006-01-02", from)
+			if err != nil {
+				exitError(simulateLog, "parse --from", err)
+			}
+			toTime := time.Now()
+			if to != "" {
+				if toTime, err = time.Parse("2006-01-02", to); err != nil {
+					exitError(simulateLog, "parse --to", err)
+				}
+			}
+			stepDuration, err := stalebot.ParseDuration(step)
+			if err != nil {
+				exitError(simulateLog, "parse --step", err)
+			}
+
+			cfg, cl := setupClient(log.WithName("setup"), *clientOpts)
+			bot := stalebot.Stalebot{
+				Client: cl,
+				Config: *cfg,
+				Logger: simulateLog,
+			}
+			report, err := bot.Simulate(cmd.Context(), fromTime, toTime, stepDuration)
+			if err != nil {
+				exitError(simulateLog, "simulate", err)
+			}
+
+			fmt.Printf("Simulated %d issues from %s to %s in steps of %s\n\n", report.Issues,
+				report.From.Format("2006-01-02"), report.To.Format("2006-01-02"), report.Step)
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			header, layout := "MONTH", "2006-01"
+			if !report.Monthly {
+				header, layout = "STEP", "2006-01-02 15:04"
+			}
+			fmt.Fprintf(w, "%s\tMARKED\tUNMARKED\tCLOSED\n", header)
+			for _, p := range report.Periods {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", p.Start.Format(layout), p.Marked, p.Unmarked, p.Closed)
+			}
+			fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\n", report.Marked, report.Unmarked, report.Closed)
+			w.Flush()
+			fmt.Printf("\nFalse positives (closed, then updated): %d\n", len(report.FalsePositives))
+			if len(report.FalsePositives) > 0 {
+				fmt.Printf("  %s\n", strings.Join(report.FalsePositives, ", "))
+			}
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "Start date of the simulation (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&to, "to", "", "End date of the simulation (YYYY-MM-DD, defaults to today)")
+	cmd.Flags().StringVar(&step, "step", "1d", "Simulation step")
+	_ = cmd.MarkFlagRequired("from")
+	return cmd
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+var projectedOperations = []stalebot.Operation{stalebot.AddStaleLabel, stalebot.RemoveStaleLabel, stalebot.Close}
+
+func statsCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	var (
+		within string
+		output string
+	)
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show staleness statistics of the project's eligible issues",
+		Long: `Show staleness statistics of the project's eligible issues.
+
+The stats include a histogram of the days since each issue's last activity,
+issue counts per type, priority, component and assignee, the number of issues
+that will be marked stale or closed within --within, and the operations daily
+runs would perform over the next 7 and 30 days if the issues see no further
+activity. Nothing is modified.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			statsLog := log.WithName("stats")
+			withinDuration, err := stalebot.ParseDuration(within)
+			if err != nil {
+				exitError(statsLog, "parse --within", err)
+			}
+			var write func(io.Writer, *stalebot.Stats) error
+			switch output {
+			case "table":
+				write = writeStatsTable
+			case "json":
+				write = writeStatsJSON
+			case "csv":
+				write = writeStatsCSV
+			default:
+				exitError(statsLog, "parse --output", fmt.Errorf("unknown output format %q: must be one of table, json or csv", output))
+			}
+
+			cfg, cl := setupClient(log.WithName("setup"), *clientOpts)
+			bot := stalebot.Stalebot{
+				Client: cl,
+				Config: *cfg,
+				Logger: statsLog,
+			}
+			stats, err := bot.Stats(cmd.Context(), time.Now(), withinDuration)
+			if err != nil {
+				exitError(statsLog, "compute stats", err)
+			}
+			if err := write(os.Stdout, stats); err != nil {
+				exitError(statsLog, "write stats", err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&within, "within", "7d", "Count issues that will be marked stale or closed within this duration")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json or csv)")
+	return cmd
+}
+
+func writeStatsTable(out io.Writer, stats *stalebot.Stats) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Eligible issues: %d\n\n", stats.Issues)
+
+	fmt.Fprintln(w, "DAYS INACTIVE\tISSUES")
+	for _, b := range stats.Inactivity {
+		fmt.Fprintf(w, "%s\t%d\n", b, b.Count)
+	}
+
+	for _, c := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"TYPE", stats.ByType},
+		{"PRIORITY", stats.ByPriority},
+		{"COMPONENT", stats.ByComponent},
+		{"ASSIGNEE", stats.ByAssignee},
+	} {
+		fmt.Fprintf(w, "\n%s\tISSUES\n", c.name)
+		for _, k := range sortedCounts(c.counts) {
+			fmt.Fprintf(w, "%s\t%d\n", k, c.counts[k])
+		}
+	}
+
+	fmt.Fprintf(w, "\nWITHIN %s\tISSUES\n", stats.Within)
+	fmt.Fprintf(w, "near mark\t%d\n", stats.NearMark)
+	fmt.Fprintf(w, "near close\t%d\n", stats.NearClose)
+
+	fmt.Fprint(w, "\nPROJECTED")
+	for _, op := range projectedOperations {
+		fmt.Fprintf(w, "\t%s", op)
+	}
+	fmt.Fprintln(w)
+	for _, p := range stats.Projections {
+		fmt.Fprintf(w, "next %s", p.Horizon)
+		for _, op := range projectedOperations {
+			fmt.Fprintf(w, "\t%d", p.Operations[op])
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func writeStatsJSON(out io.Writer, stats *stalebot.Stats) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// writeStatsCSV writes the stats as rows of section, name and value.
+func writeStatsCSV(out io.Writer, stats *stalebot.Stats) error {
+	w := csv.NewWriter(out)
+	row := func(section, name string, value int) {
+		_ = w.Write([]string{section, name, strconv.Itoa(value)})
+	}
+	_ = w.Write([]string{"section", "name", "value"})
+	row("issues", "eligible", stats.Issues)
+	for _, b := range stats.Inactivity {
+		row("daysInactive", b.String(), b.Count)
+	}
+	for _, c := range []struct {
+		section string
+		counts  map[string]int
+	}{
+		{"type", stats.ByType},
+		{"priority", stats.ByPriority},
+		{"component", stats.ByComponent},
+		{"assignee", stats.ByAssignee},
+	} {
+		for _, k := range sortedCounts(c.counts) {
+			row(c.section, k, c.counts[k])
+		}
+	}
+	row("within", "nearMark", stats.NearMark)
+	row("within", "nearClose", stats.NearClose)
+	for _, p := range stats.Projections {
+		for _, op := range projectedOperations {
+			row("projected "+p.Horizon.String(), string(op), p.Operations[op])
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// sortedCounts returns the keys of counts, ordered by descending count and
+// then by key.
+func sortedCounts(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
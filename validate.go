@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/joelanford/jira-stalebot/internal/stalebot"
+)
+
+func validateCmd(log logr.Logger, clientOpts *clientOptions) *cobra.Command {
+	var online bool
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the stalebot config",
+		Long: `Validate the stalebot config.
+
+With --online, the config is also checked against the Jira instance, and the
+results are printed as a table. The command exits non-zero if any check fails.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			results := []stalebot.CheckResult{}
+			if _, err := stalebot.LoadConfig(clientOpts.configFile); err != nil {
+				results = append(results, stalebot.CheckResult{Name: "config", Status: stalebot.CheckFail, Message: err.Error()})
+			} else {
+				results = append(results, stalebot.CheckResult{Name: "config", Status: stalebot.CheckPass, Message: "config is valid"})
+				if online {
+					cfg, cl := setupClient(log.WithName("setup"), *clientOpts)
+					bot := stalebot.Stalebot{
+						Client: cl,
+						Config: *cfg,
+						Logger: log.WithName("validate"),
+					}
+					results = append(results, bot.ValidateOnline(cmd.Context())...)
+				}
+			}
+
+			failed := false
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "CHECK\tRESULT\tMESSAGE")
+			for _, r := range results {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Status, r.Message)
+				failed = failed || r.Status == stalebot.CheckFail
+			}
+			w.Flush()
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&online, "online", false, "Check the config against the Jira instance")
+	return cmd
+}
+
+func schemaCmd(log logr.Logger) *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the stalebot config",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(stalebot.JSONSchema()); err != nil {
+				exitError(log.WithName("schema"), "encode schema", err)
+			}
+		},
+	}
+}